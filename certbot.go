@@ -0,0 +1,52 @@
+package main
+
+import (
+	"fmt"
+	"nginx_tool/internal/config"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// certbotDomains returns the server names certbot can validate over HTTP.
+// Wildcards need a DNS challenge and regex names are not hostnames, so both
+// are skipped.
+func certbotDomains(cfg *config.ServerConfig) (domains, skipped []string) {
+	for _, name := range cfg.Names() {
+		if strings.HasPrefix(name, "~") || strings.Contains(name, "*") || name == "_" {
+			skipped = append(skipped, name)
+			continue
+		}
+		domains = append(domains, name)
+	}
+	return domains, skipped
+}
+
+func runCertbot(nginxPath string, cfg *config.ServerConfig) error {
+	domains, skipped := certbotDomains(cfg)
+	for _, name := range skipped {
+		fmt.Fprintf(stderr, "%sSkipping %s for certbot: wildcard and regex names cannot be validated over HTTP\n", sym("⚠️"), name)
+	}
+	if len(domains) == 0 {
+		return nil
+	}
+
+	args := []string{"--nginx", "--nginx-server-root", filepath.Dir(nginxPath)}
+	for _, domain := range domains {
+		args = append(args, "-d", domain)
+	}
+	debugf("running certbot %s", strings.Join(args, " "))
+	fmt.Fprintf(stderr, "%sRequesting a certificate for %s\n", sym("🔐"), strings.Join(domains, ", "))
+
+	cmd := exec.Command("certbot", args...)
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = stderr
+	cmd.Stderr = stderr
+	if err := cmd.Run(); err != nil {
+		return withExitCode(exitFailure, "certbot failed for %s (the server block was added): %w", strings.Join(domains, " "), err)
+	}
+
+	fmt.Fprintf(stderr, "%sCertificate installed for %s\n", sym("✅"), strings.Join(domains, ", "))
+	return nil
+}
@@ -0,0 +1,31 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os/exec"
+	"strings"
+	"time"
+)
+
+// commandTimeout bounds every call to nginx and the other helpers the tool
+// shells out to, so a hung binary cannot hang the tool with it.
+const commandTimeout = 10 * time.Second
+
+// runTimed runs name with args through run, which is one of exec.Cmd's
+// Output or CombinedOutput, and kills it after commandTimeout.
+func runTimed(run func(*exec.Cmd) ([]byte, error), name string, args ...string) ([]byte, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), commandTimeout)
+	defer cancel()
+
+	cmd := exec.CommandContext(ctx, name, args...)
+	// Children that inherited the output pipes must not keep us waiting
+	// once the command itself has been killed.
+	cmd.WaitDelay = time.Second
+	output, err := run(cmd)
+	if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		return output, fmt.Errorf("%s timed out after %s", strings.Join(append([]string{name}, args...), " "), commandTimeout)
+	}
+	return output, err
+}
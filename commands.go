@@ -0,0 +1,759 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"nginx_tool/internal/config"
+	"nginx_tool/internal/generator"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"gopkg.in/yaml.v2"
+)
+
+func runUpdate(args []string) error {
+	fs := flag.NewFlagSet("update", flag.ContinueOnError)
+	var (
+		configPath   = fs.String("config", "", "Path to server configuration JSON/YAML/.env file")
+		serverType   = fs.String("type", "static", "Server type: 'static', 'proxy', 'grpc' or 'redirect'")
+		preview      = fs.Bool("preview", true, "Show the current and regenerated blocks and ask for confirmation")
+		backup       = fs.Bool("backup", true, "Create backup of nginx.conf before modification")
+		backupReuse  = fs.Duration("backup-reuse", 0, "Reuse the latest backup instead of creating one if it is younger than this (e.g. 5m)")
+		noBanner     = fs.Bool("no-banner", false, "Omit the 'Generated by' comment from the regenerated server block")
+		templatePath = fs.String("template", "", "Go text/template file used to render the server block instead of the built-in one")
+		indent       = fs.String("indent", "auto", "Indentation of the regenerated block: 'auto' (match nginx.conf), 'tab' or a number of spaces")
+		strict       = fs.Bool("strict", false, "Fail on configuration keys that do not match any known field instead of ignoring them")
+		configFormat = fs.String("config-format", "", "Format of -config: 'json', 'yaml', 'env' or 'auto' to detect it from the contents (default: by extension)")
+		explain      = fs.Bool("explain", false, "Annotate the updated block in the preview with comments explaining each directive")
+		preHook      = fs.String("pre-hook", "", "Shell command to run before writing; a failure aborts the update")
+		postHook     = fs.String("post-hook", "", "Shell command to run after the block was written, e.g. to reload nginx")
+		resultFile   = fs.String("result-file", "", "Append a JSON record of the update (time, server, backup, outcome) to this file")
+		patch        = fs.Bool("patch", false, "Merge the fields set in -config over the settings read from the existing block")
+		proxyFrom    = fs.String("proxy-from", "", "Fetch the backend address from this discovery URL (e.g. a Consul service) and use it as proxy_pass")
+	)
+	var appendRaw stringList
+	fs.Var(&appendRaw, "append-raw", "Directive(s) to insert verbatim at the end of the server block, or @file to read them from a file; repeatable")
+	nginxPath, autoDetect := addNginxFlags(fs)
+	addConfirmFlags(fs)
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+
+	if *configPath == "" {
+		return withExitCode(exitUsage, "-config is required")
+	}
+	if err := requireRoot(); err != nil {
+		return err
+	}
+	switch *serverType {
+	case "static", "proxy", "grpc", "redirect":
+	default:
+		return withExitCode(exitValidation, "type must be one of 'static', 'proxy', 'grpc' or 'redirect'")
+	}
+	if err := resolveNginxPath(nginxPath, *autoDetect); err != nil {
+		return err
+	}
+	if generator.IsRemote(*nginxPath) {
+		return withExitCode(exitUsage, "remote nginx configurations are read-only")
+	}
+
+	gen := generator.New()
+	gen.Banner = !*noBanner
+	gen.Version = version
+	gen.TemplatePath = *templatePath
+	gen.BackupReuse = *backupReuse
+	gen.OnBackup = reportBackup
+	var err error
+	if gen.Indent, err = indentUnit(*indent, *nginxPath); err != nil {
+		return err
+	}
+
+	var cfgs []*config.ServerConfig
+	var current string
+	if *patch {
+		typeSet := false
+		fs.Visit(func(f *flag.Flag) { typeSet = typeSet || f.Name == "type" })
+		var cfg *config.ServerConfig
+		cfg, current, err = loadPatch(gen, *configPath, *configFormat, *strict, *nginxPath)
+		cfgs = []*config.ServerConfig{cfg}
+		if err == nil && !typeSet {
+			*serverType = serverTypeOf(cfg)
+		}
+	} else {
+		cfgs, err = loadConfigs(*configPath, "", *configFormat, false, *strict, *serverType)
+	}
+	if err != nil {
+		return err
+	}
+	if err := appendRawDirectives(cfgs, appendRaw); err != nil {
+		return err
+	}
+	if err := applyProxyFrom(cfgs, *proxyFrom, *serverType); err != nil {
+		return err
+	}
+	gen.HTTP2Listen = usesHTTP2(cfgs, *serverType) && legacyHTTP2()
+	warnMissingPaths(cfgs, false)
+	warnUnknownUpstreams(cfgs, *nginxPath)
+	warnMissingBrotli(cfgs, *nginxPath)
+	cfg := cfgs[0]
+	if *patch {
+		if err := warnChangedDefinitions(gen, cfg, *serverType, current); err != nil {
+			return err
+		}
+	}
+
+	if *preview {
+		current, updated, err := gen.PreviewUpdate(cfg, *nginxPath, *serverType)
+		if err != nil {
+			return withExitCode(applyExitCode(err), "preparing update: %w", err)
+		}
+
+		fmt.Fprintln(stdout, sym("📄")+"Current server block")
+		fmt.Fprintln(stdout, "="+strings.Repeat("=", 50))
+		fmt.Fprintln(stdout, current)
+		fmt.Fprintln(stdout, "="+strings.Repeat("=", 50))
+		fmt.Fprintln(stdout, sym("✏️")+"Updated server block")
+		fmt.Fprintln(stdout, "="+strings.Repeat("=", 50))
+		if *explain {
+			updated = generator.Explain(updated)
+		}
+		fmt.Fprintln(stdout, updated)
+		fmt.Fprintln(stdout, "="+strings.Repeat("=", 50))
+
+		shouldProceed, err := confirm("Do you want to replace this server block?")
+		if err != nil {
+			return err
+		}
+		if !shouldProceed {
+			return errCancelled
+		}
+	}
+
+	if err := runHook("pre", *preHook, *nginxPath, "", cfgs); err != nil {
+		return withExitCode(exitApply, "pre-hook failed, nothing was written: %w", err)
+	}
+
+	result, err := gen.UpdateServerBlock(cfg, *nginxPath, *serverType, *backup)
+	appendResult(*resultFile, "update", newApplyResult(cfgs, *nginxPath, *serverType, result, err))
+	if err != nil {
+		return withExitCode(applyExitCode(err), "updating server in nginx config: %w", err)
+	}
+
+	fmt.Fprintf(stderr, "%sUpdated server block for %s in: %s\n", sym("✅"), strings.Join(cfg.Names(), " "), *nginxPath)
+	if err := runHook("post", *postHook, *nginxPath, result.BackupPath, cfgs); err != nil {
+		return withExitCode(exitFailure, "post-hook failed (the block was written): %w", err)
+	}
+	printNextSteps(*nginxPath, cfgs, result)
+	return nil
+}
+
+// loadPatch reads the partial configuration at path and merges it over the
+// settings parsed from the block it names, so only the fields it sets change.
+// It also returns the block as it was read, with the http-level definitions
+// it uses.
+func loadPatch(gen *generator.Generator, path, format string, strict bool, nginxPath string) (*config.ServerConfig, string, error) {
+	if !config.IsConfigFormat(format) {
+		return nil, "", withExitCode(exitUsage, "-config-format must be 'json', 'yaml', 'env' or 'auto'")
+	}
+	patch, err := config.LoadPatch(path, strict, format)
+	if err != nil {
+		return nil, "", withExitCode(exitConfig, "loading configuration: %w", err)
+	}
+	if len(patch.Names()) == 0 {
+		return nil, "", withExitCode(exitConfig, "a patch needs server_name to find the block it applies to")
+	}
+
+	block, err := gen.CurrentServerBlock(nginxPath, patch.Names())
+	if err != nil {
+		return nil, "", withExitCode(applyExitCode(err), "finding the block to patch: %w", err)
+	}
+	cfg, err := config.ParseServerBlock(block)
+	if err != nil {
+		return nil, "", withExitCode(exitApply, "reading the block to patch: %w", err)
+	}
+	for _, warning := range cfg.Warnings {
+		fmt.Fprintf(stderr, "%s%s: %s\n", sym("⚠️"), strings.Join(cfg.Names(), " "), warning)
+	}
+	cfg.Warnings = nil
+	cfg.Merge(patch)
+	if err := checkConfig(cfg, serverTypeOf(cfg)); err != nil {
+		return nil, "", err
+	}
+	return cfg, block, nil
+}
+
+// warnChangedDefinitions warns about every http-level definition of current,
+// such as an upstream or zone, that the patched configuration regenerates
+// differently, since the update replaces it.
+func warnChangedDefinitions(gen *generator.Generator, cfg *config.ServerConfig, serverType, current string) error {
+	serverBlock, err := gen.GenerateServerBlock(cfg, serverType)
+	if err != nil {
+		return withExitCode(exitValidation, "rendering %s: %w", strings.Join(cfg.Names(), " "), err)
+	}
+	changes, err := generator.ChangedDefinitions(current, serverBlock)
+	if err != nil {
+		return withExitCode(exitApply, "comparing http-level blocks: %w", err)
+	}
+	for _, change := range changes {
+		fmt.Fprintf(stderr, "%s%s: the patch changes an http-level block: %s\n", sym("⚠️"), strings.Join(cfg.Names(), " "), change)
+	}
+	return nil
+}
+
+// serverTypeOf picks the template for cfg from the target it sets.
+func serverTypeOf(cfg *config.ServerConfig) string {
+	switch {
+	case cfg.GRPCPass != "":
+		return "grpc"
+	case cfg.RedirectTo != "":
+		return "redirect"
+	case cfg.ProxyPass != "" || cfg.ProxyPort != "" || cfg.ProxySocket != "" || len(cfg.Upstreams) > 0:
+		return "proxy"
+	}
+	return "static"
+}
+
+func runRemove(args []string) error {
+	fs := flag.NewFlagSet("remove", flag.ContinueOnError)
+	var (
+		serverName  = fs.String("server-name", "", "server_name of the block(s) to remove")
+		preview     = fs.Bool("preview", true, "Show the matching blocks and ask for confirmation")
+		backup      = fs.Bool("backup", true, "Create backup of nginx.conf before modification")
+		backupReuse = fs.Duration("backup-reuse", 0, "Reuse the latest backup instead of creating one if it is younger than this (e.g. 5m)")
+		commentOut  = fs.Bool("comment-out", false, "Comment the matching blocks out instead of deleting them")
+		resultFile  = fs.String("result-file", "", "Append a JSON record of the removal (time, server, backup, outcome) to this file")
+	)
+	nginxPath, autoDetect := addNginxFlags(fs)
+	addConfirmFlags(fs)
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+
+	if *serverName == "" {
+		return withExitCode(exitUsage, "-server-name is required")
+	}
+	if err := requireRoot(); err != nil {
+		return err
+	}
+	if err := resolveNginxPath(nginxPath, *autoDetect); err != nil {
+		return err
+	}
+	if generator.IsRemote(*nginxPath) {
+		return withExitCode(exitUsage, "remote nginx configurations are read-only")
+	}
+
+	gen := generator.New()
+	gen.BackupReuse = *backupReuse
+	gen.OnBackup = reportBackup
+	gen.CommentOut = *commentOut
+
+	action := "remove"
+	if *commentOut {
+		action = "comment out"
+	}
+
+	if *preview {
+		blocks, err := gen.FindServerBlocks(*nginxPath, *serverName)
+		if err != nil {
+			return withExitCode(exitApply, "finding server blocks: %w", err)
+		}
+		if len(blocks) == 0 {
+			return withExitCode(exitValidation, "no server block with server_name %q found", *serverName)
+		}
+
+		fmt.Fprintf(stdout, "%sServer blocks to %s\n", sym("🗑️"), action)
+		fmt.Fprintln(stdout, "="+strings.Repeat("=", 50))
+		fmt.Fprintln(stdout, strings.Join(blocks, "\n\n"))
+		fmt.Fprintln(stdout, "="+strings.Repeat("=", 50))
+		if !*commentOut {
+			definitions, err := gen.FindOrphanedDefinitions(*nginxPath, *serverName)
+			if err != nil {
+				return withExitCode(exitApply, "finding server blocks: %w", err)
+			}
+			if len(definitions) > 0 {
+				fmt.Fprintln(stdout, "http-level blocks only these servers use, removed with them:")
+				fmt.Fprintln(stdout, strings.Join(definitions, "\n"))
+				fmt.Fprintln(stdout, "="+strings.Repeat("=", 50))
+			}
+		}
+
+		shouldProceed, err := confirm(fmt.Sprintf("Do you want to %s these server blocks?", action))
+		if err != nil {
+			return err
+		}
+		if !shouldProceed {
+			return errCancelled
+		}
+	}
+
+	result, err := gen.RemoveServerFromNginx(*nginxPath, *serverName, *backup)
+	appendResult(*resultFile, "remove", newApplyResult([]*config.ServerConfig{{ServerName: *serverName}}, *nginxPath, "", result, err))
+	if err != nil {
+		return withExitCode(exitApply, "removing server from nginx config: %w", err)
+	}
+
+	if *commentOut {
+		fmt.Fprintf(stderr, "%sCommented out %d server block(s) for %s in: %s\n", sym("✅"), len(result.ServerBlocks), *serverName, *nginxPath)
+		return nil
+	}
+	fmt.Fprintf(stderr, "%sRemoved %d server block(s) for %s from: %s\n", sym("✅"), len(result.ServerBlocks), *serverName, *nginxPath)
+	return nil
+}
+
+func runList(args []string) error {
+	fs := flag.NewFlagSet("list", flag.ContinueOnError)
+	format := fs.String("format", "", "Output format: 'table', 'json' or 'yaml' (default: table on a terminal, json otherwise)")
+	jsonOutput := fs.Bool("json", false, "Print the server blocks as a JSON array; same as -format json")
+	lint := fs.Bool("lint", false, "Warn about deprecated directives on stderr before the list")
+	nginxPath, autoDetect := addNginxFlags(fs)
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+
+	switch {
+	case *jsonOutput && *format != "" && *format != "json":
+		return withExitCode(exitUsage, "-json cannot be combined with -format %s", *format)
+	case *jsonOutput:
+		*format = "json"
+	case *format == "" && isTerminal(os.Stdout):
+		*format = "table"
+	case *format == "":
+		*format = "json"
+	}
+	switch *format {
+	case "table", "json", "yaml":
+	default:
+		return withExitCode(exitUsage, "-format must be 'table', 'json' or 'yaml'")
+	}
+
+	if err := resolveNginxPath(nginxPath, *autoDetect); err != nil {
+		return err
+	}
+
+	servers, err := generator.New().ListServerBlocks(*nginxPath)
+	if err != nil {
+		return withExitCode(exitApply, "listing server blocks: %w", err)
+	}
+	if *lint {
+		printLint(*nginxPath)
+	}
+
+	infos := make([]ServerInfo, 0, len(servers))
+	for _, server := range servers {
+		infos = append(infos, ServerInfo{
+			Line:        server.Line,
+			Type:        server.Type,
+			Listen:      server.Listens,
+			ServerNames: server.ServerNames,
+			Root:        server.Root,
+			ProxyPass:   server.ProxyPass,
+			Return:      server.Return,
+		})
+	}
+
+	switch *format {
+	case "json":
+		return writeJSON(infos)
+	case "yaml":
+		data, err := yaml.Marshal(infos)
+		if err != nil {
+			return withExitCode(exitFailure, "encoding server blocks: %w", err)
+		}
+		fmt.Print(string(data))
+		return nil
+	}
+
+	w := tabwriter.NewWriter(stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "LINE\tTYPE\tLISTEN\tSERVER_NAME\tTARGET")
+	for _, info := range infos {
+		target := info.Root
+		switch info.Type {
+		case "proxy":
+			target = info.ProxyPass
+		case "redirect":
+			target = info.Return
+		}
+		fmt.Fprintf(w, "%d\t%s\t%s\t%s\t%s\n", info.Line, info.Type,
+			strings.Join(info.Listen, ", "), strings.Join(info.ServerNames, " "), target)
+	}
+	return w.Flush()
+}
+
+func runValidate(args []string) error {
+	fs := flag.NewFlagSet("validate", flag.ContinueOnError)
+	lint := fs.Bool("lint", false, "Also warn about deprecated directives such as 'ssl on;'")
+	nginxPath, autoDetect := addNginxFlags(fs)
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+
+	if err := resolveNginxPath(nginxPath, *autoDetect); err != nil {
+		return err
+	}
+
+	if err := generator.New().ValidateNginxConfig(*nginxPath); err != nil {
+		return withExitCode(exitValidation, "%s: %w", *nginxPath, err)
+	}
+	fmt.Fprintf(stderr, "%sStructure is valid: %s\n", sym("✅"), *nginxPath)
+	if *lint {
+		if n := printLint(*nginxPath); n == 0 {
+			fmt.Fprintln(stderr, sym("✅")+"No deprecated directives found")
+		}
+	}
+
+	if generator.IsRemote(*nginxPath) {
+		return nil
+	}
+
+	nginxBinary, err := findNginxBinary()
+	if err != nil {
+		fmt.Fprintln(stderr, sym("⚠️")+"nginx binary not found, skipping 'nginx -t'")
+		return nil
+	}
+
+	return testNginx(nginxBinary, *nginxPath)
+}
+
+// testNginx runs 'nginx -t' on nginxPath and passes its output on to stderr.
+func testNginx(nginxBinary, nginxPath string) error {
+	output, err := runTimed((*exec.Cmd).CombinedOutput, nginxBinary, "-t", "-c", nginxPath)
+	fmt.Fprint(stderr, string(output))
+	if err != nil {
+		return withExitCode(exitValidation, "nginx -t failed: %w", err)
+	}
+	return nil
+}
+
+// runCheckReload tests the configuration on disk as nginx would on reload,
+// without changing it, and with -reload signals the running nginx too.
+func runCheckReload(args []string) error {
+	fs := flag.NewFlagSet("check-reload", flag.ContinueOnError)
+	reload := fs.Bool("reload", false, "After a successful test, tell the running nginx to reload with 'nginx -s reload'")
+	nginxPath, autoDetect := addNginxFlags(fs)
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+
+	if *reload {
+		if err := requireRoot(); err != nil {
+			return err
+		}
+	}
+	if err := resolveNginxPath(nginxPath, *autoDetect); err != nil {
+		return err
+	}
+	if generator.IsRemote(*nginxPath) {
+		return withExitCode(exitUsage, "check-reload needs the nginx.conf of this machine, not a URL")
+	}
+	nginxBinary, err := findNginxBinary()
+	if err != nil {
+		return withExitCode(exitNginxNotFound, "%w; check-reload needs nginx installed", err)
+	}
+
+	if err := testNginx(nginxBinary, *nginxPath); err != nil {
+		return err
+	}
+	fmt.Fprintf(stderr, "%s%s would reload cleanly\n", sym("✅"), *nginxPath)
+	if !*reload {
+		return nil
+	}
+
+	output, err := runTimed((*exec.Cmd).CombinedOutput, nginxBinary, "-s", "reload", "-c", *nginxPath)
+	fmt.Fprint(stderr, string(output))
+	if err != nil {
+		return withExitCode(exitApply, "nginx -s reload failed (is nginx running?): %w", err)
+	}
+	fmt.Fprintln(stderr, sym("🔄")+"Sent reload to nginx")
+	return nil
+}
+
+func runFormat(args []string) error {
+	fs := flag.NewFlagSet("format", flag.ContinueOnError)
+	var (
+		write  = fs.Bool("write", false, "Rewrite nginx.conf in place instead of printing the formatted result")
+		backup = fs.Bool("backup", true, "Create backup of nginx.conf before rewriting it with -write")
+		indent = fs.String("indent", "4", "Indentation: 'auto' (keep the file's own), 'tab' or a number of spaces")
+	)
+	nginxPath, autoDetect := addNginxFlags(fs)
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+
+	if *write {
+		if err := requireRoot(); err != nil {
+			return err
+		}
+	}
+	if err := resolveNginxPath(nginxPath, *autoDetect); err != nil {
+		return err
+	}
+
+	gen := generator.New()
+	gen.OnBackup = reportBackup
+	unit, err := indentUnit(*indent, *nginxPath)
+	if err != nil {
+		return err
+	}
+	gen.Indent = unit
+	if !*write {
+		formatted, err := gen.FormatConfig(*nginxPath)
+		if err != nil {
+			return withExitCode(exitValidation, "%s: %w", *nginxPath, err)
+		}
+		fmt.Fprint(stdout, formatted)
+		return nil
+	}
+
+	if generator.IsRemote(*nginxPath) {
+		return withExitCode(exitUsage, "remote nginx configurations are read-only")
+	}
+	if _, err := gen.FormatNginxFile(*nginxPath, *backup); err != nil {
+		return withExitCode(exitApply, "formatting nginx config: %w", err)
+	}
+	fmt.Fprintf(stderr, "%sFormatted: %s\n", sym("✅"), *nginxPath)
+	return nil
+}
+
+func runRollback(args []string) error {
+	fs := flag.NewFlagSet("rollback", flag.ContinueOnError)
+	var (
+		backupFile = fs.String("backup-file", "", "Backup to restore (defaults to the most recent one)")
+		preview    = fs.Bool("preview", true, "Ask for confirmation before restoring")
+	)
+	nginxPath, autoDetect := addNginxFlags(fs)
+	addConfirmFlags(fs)
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+
+	if err := requireRoot(); err != nil {
+		return err
+	}
+	if err := resolveNginxPath(nginxPath, *autoDetect); err != nil {
+		return err
+	}
+	if generator.IsRemote(*nginxPath) {
+		return withExitCode(exitUsage, "remote nginx configurations are read-only")
+	}
+
+	gen := generator.New()
+
+	if *backupFile == "" {
+		backups, err := gen.ListBackups(*nginxPath)
+		if err != nil {
+			return withExitCode(exitApply, "%w", err)
+		}
+		if len(backups) == 0 {
+			return withExitCode(exitApply, "no backups found for %s", *nginxPath)
+		}
+		*backupFile = backups[len(backups)-1].Path
+	}
+
+	switch err := generator.VerifyBackup(*backupFile); {
+	case errors.Is(err, generator.ErrNoChecksum):
+		fmt.Fprintf(stderr, "%sNo checksum recorded for %s; restoring without verification\n", sym("⚠️"), *backupFile)
+	case err != nil:
+		return withExitCode(exitApply, "refusing to restore: %w", err)
+	default:
+		fmt.Fprintf(stderr, "%sBackup checksum verified: %s\n", sym("🔒"), *backupFile)
+	}
+
+	if *preview {
+		shouldProceed, err := confirm(fmt.Sprintf("Restore %s over %s?", *backupFile, *nginxPath))
+		if err != nil {
+			return err
+		}
+		if !shouldProceed {
+			return errCancelled
+		}
+	}
+
+	restored, err := gen.Rollback(*nginxPath, *backupFile)
+	if err != nil {
+		return withExitCode(exitApply, "%w", err)
+	}
+
+	fmt.Fprintf(stderr, "%sRestored %s from: %s\n", sym("✅"), *nginxPath, restored)
+	return nil
+}
+
+func runBackups(args []string) error {
+	fs := flag.NewFlagSet("backups", flag.ContinueOnError)
+	var (
+		since      = fs.Duration("since", 0, "Only list backups taken within this duration (e.g. 24h)")
+		jsonOutput = fs.Bool("json", false, "Print the backups as a JSON array")
+	)
+	nginxPath, autoDetect := addNginxFlags(fs)
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+	if *since < 0 {
+		return withExitCode(exitUsage, "-since must be a positive duration such as 24h")
+	}
+	if err := resolveNginxPath(nginxPath, *autoDetect); err != nil {
+		return err
+	}
+	if generator.IsRemote(*nginxPath) {
+		return withExitCode(exitUsage, "remote nginx configurations have no local backups")
+	}
+
+	all, err := generator.New().ListBackups(*nginxPath)
+	if err != nil {
+		return withExitCode(exitApply, "%w", err)
+	}
+	type backupInfo struct {
+		Path     string    `json:"path"`
+		Created  time.Time `json:"created"`
+		Size     int64     `json:"size"`
+		Checksum string    `json:"checksum"`
+	}
+	backups := []backupInfo{}
+	for _, backup := range all {
+		if *since > 0 && time.Since(backup.Created) > *since {
+			continue
+		}
+		checksum := "ok"
+		switch err := generator.VerifyBackup(backup.Path); {
+		case errors.Is(err, generator.ErrNoChecksum):
+			checksum = "none"
+		case err != nil:
+			checksum = "mismatch"
+		}
+		backups = append(backups, backupInfo{backup.Path, backup.Created, backup.Size, checksum})
+	}
+
+	if *jsonOutput {
+		return writeJSON(backups)
+	}
+	if len(backups) == 0 {
+		if *since > 0 {
+			fmt.Fprintf(stderr, "No backups of %s in the last %s\n", *nginxPath, *since)
+		} else {
+			fmt.Fprintf(stderr, "No backups of %s\n", *nginxPath)
+		}
+		return nil
+	}
+	w := tabwriter.NewWriter(stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "CREATED\tAGE\tSIZE\tCHECKSUM\tPATH")
+	for _, backup := range backups {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n", backup.Created.Format("2006-01-02 15:04:05"),
+			formatAge(time.Since(backup.Created)), formatSize(backup.Size), backup.Checksum, backup.Path)
+	}
+	return w.Flush()
+}
+
+func runDiffBackups(args []string) error {
+	fs := flag.NewFlagSet("diff-backups", flag.ContinueOnError)
+	nginxPath, autoDetect := addNginxFlags(fs)
+	refs, err := parseFlagsAndArgs(fs, args)
+	if err != nil {
+		return err
+	}
+	if len(refs) > 2 {
+		return withExitCode(exitUsage, "diff-backups compares two versions; got %d: %s", len(refs), strings.Join(refs, " "))
+	}
+	if err := resolveNginxPath(nginxPath, *autoDetect); err != nil {
+		return err
+	}
+	if generator.IsRemote(*nginxPath) {
+		return withExitCode(exitUsage, "remote nginx configurations have no local backups")
+	}
+
+	backups, err := generator.New().ListBackups(*nginxPath)
+	if err != nil {
+		return withExitCode(exitApply, "%w", err)
+	}
+	// With no arguments the latest backup is compared with nginx.conf, and
+	// with one the given backup is.
+	switch len(refs) {
+	case 0:
+		refs = []string{"latest", "current"}
+	case 1:
+		refs = append(refs, "current")
+	}
+	var paths, contents [2]string
+	for i, ref := range refs {
+		if paths[i], err = resolveBackupRef(*nginxPath, backups, ref); err != nil {
+			return err
+		}
+		data, err := os.ReadFile(paths[i])
+		if err != nil {
+			return withExitCode(exitFailure, "reading %s: %w", paths[i], err)
+		}
+		contents[i] = string(data)
+	}
+
+	diff := generator.UnifiedDiff(paths[0], paths[1], contents[0], contents[1])
+	if diff == "" {
+		fmt.Fprintf(stderr, "No differences between %s and %s\n", paths[0], paths[1])
+		return nil
+	}
+	fmt.Fprint(stdout, diff)
+	return nil
+}
+
+// resolveBackupRef turns a diff-backups argument into a file: "current" is
+// nginx.conf itself, "latest" the newest backup and "latest~N" the one N
+// before it ("previous" is latest~1), a number the backup with that Unix
+// timestamp, and anything else a path.
+func resolveBackupRef(nginxPath string, backups []generator.Backup, ref string) (string, error) {
+	back := 0
+	switch {
+	case ref == "current":
+		return nginxPath, nil
+	case ref == "latest":
+	case ref == "previous":
+		back = 1
+	case strings.HasPrefix(ref, "latest~"):
+		n, err := strconv.Atoi(strings.TrimPrefix(ref, "latest~"))
+		if err != nil || n < 0 {
+			return "", withExitCode(exitUsage, "invalid %s: use latest~N with N a number of backups back, such as latest~2", ref)
+		}
+		back = n
+	default:
+		if n, err := strconv.ParseInt(ref, 10, 64); err == nil {
+			for _, backup := range backups {
+				if backup.Created.Unix() == n {
+					return backup.Path, nil
+				}
+			}
+			return "", withExitCode(exitUsage, "no backup of %s was taken at %d", nginxPath, n)
+		}
+		if _, err := os.Stat(ref); err != nil {
+			return "", withExitCode(exitUsage, "%s is neither a file nor current, latest, latest~N, previous or a backup timestamp", ref)
+		}
+		return ref, nil
+	}
+	if back >= len(backups) {
+		return "", withExitCode(exitApply, "%s has %d backup(s), so there is no %s", nginxPath, len(backups), ref)
+	}
+	return backups[len(backups)-1-back].Path, nil
+}
+
+// formatAge renders d in its largest whole unit, such as 45s, 12m, 5h or 3d.
+func formatAge(d time.Duration) string {
+	switch {
+	case d < time.Minute:
+		return fmt.Sprintf("%ds", int(d.Seconds()))
+	case d < time.Hour:
+		return fmt.Sprintf("%dm", int(d.Minutes()))
+	case d < 48*time.Hour:
+		return fmt.Sprintf("%dh", int(d.Hours()))
+	}
+	return fmt.Sprintf("%dd", int(d.Hours()/24))
+}
+
+func formatSize(n int64) string {
+	switch {
+	case n < 1024:
+		return fmt.Sprintf("%d B", n)
+	case n < 1024*1024:
+		return fmt.Sprintf("%.1f KiB", float64(n)/1024)
+	}
+	return fmt.Sprintf("%.1f MiB", float64(n)/(1024*1024))
+}
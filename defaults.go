@@ -0,0 +1,161 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+
+	"gopkg.in/yaml.v2"
+)
+
+// defaultsPaths lists the files flag defaults are read from, in order of
+// preference: $NGINX_TOOL_DEFAULTS when set, else the user's config
+// directory and ~/.nginx-tool.yaml.
+func defaultsPaths() []string {
+	if path := os.Getenv("NGINX_TOOL_DEFAULTS"); path != "" {
+		return []string{path}
+	}
+	var paths []string
+	if dir, err := os.UserConfigDir(); err == nil {
+		paths = append(paths, filepath.Join(dir, "nginx-tool", "config.yaml"))
+	}
+	if home, err := os.UserHomeDir(); err == nil {
+		paths = append(paths, filepath.Join(home, ".nginx-tool.yaml"))
+	}
+	return paths
+}
+
+// loadDefaults reads the first defaults file that exists. Top-level keys
+// are flag names applied to every command that has the flag; a key naming a
+// command holds values for that command only. It returns a nil map when
+// there is no file. Naming a missing file in $NGINX_TOOL_DEFAULTS is an
+// error.
+func loadDefaults() (string, map[string]any, error) {
+	explicit := os.Getenv("NGINX_TOOL_DEFAULTS") != ""
+	for _, path := range defaultsPaths() {
+		data, err := os.ReadFile(path)
+		if errors.Is(err, fs.ErrNotExist) && !explicit {
+			continue
+		}
+		if err != nil {
+			return path, nil, fmt.Errorf("failed to read defaults file: %w", err)
+		}
+		var values map[string]any
+		if err := yaml.Unmarshal(data, &values); err != nil {
+			return path, nil, fmt.Errorf("failed to parse defaults file %s: %w", path, err)
+		}
+		return path, values, nil
+	}
+	return "", nil, nil
+}
+
+// commandNames are the commands a defaults file may hold a section for.
+var commandNames = []string{
+	"add", "update", "remove", "list", "manage", "validate", "format",
+	"rollback", "check-reload", "backups", "diff-backups",
+}
+
+// applyDefaults seeds the flags of set from the defaults file, so that flags
+// given on the command line still win. Keys that are not flags of set are
+// ignored, since the same file serves every command. A mapping under a
+// command name is that command's section; any other mapping is an error, so
+// the format section never reaches list's -format flag. A list sets a
+// repeatable flag once per item.
+func applyDefaults(set *flag.FlagSet) error {
+	path, values, err := loadDefaults()
+	if err != nil {
+		return withExitCode(exitUsage, "%w", err)
+	}
+
+	global := make(map[string]any, len(values))
+	var command map[string]any
+	for name, value := range values {
+		section, isSection := value.(map[any]any)
+		switch {
+		case !isSection:
+			global[name] = value
+		case !slices.Contains(commandNames, name):
+			return withExitCode(exitUsage, "defaults file %s: %s is not a command, so it cannot hold a section", path, name)
+		case name == set.Name():
+			command = make(map[string]any, len(section))
+			for key, value := range section {
+				command[fmt.Sprint(key)] = value
+			}
+		}
+	}
+
+	if err := seedFlags(set, path, global); err != nil {
+		return err
+	}
+	return seedFlags(set, path, command)
+}
+
+// seedFlags sets the flags named in values through their Value, which
+// leaves them out of set.Visit, so commands can still tell which flags the
+// command line gave. A repeatable flag drops its seeded items once the
+// command line sets it.
+func seedFlags(set *flag.FlagSet, path string, values map[string]any) error {
+	names := make([]string, 0, len(values))
+	for name := range values {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		f := set.Lookup(name)
+		if f == nil {
+			continue
+		}
+		items, ok := values[name].([]any)
+		if !ok {
+			items = []any{values[name]}
+		}
+		value := f.Value
+		if seeded, ok := value.(*seededList); ok {
+			// A command section replaces the top-level items.
+			*seeded.list = nil
+			value = seeded.list
+		}
+		for _, item := range items {
+			if _, nested := item.(map[any]any); nested || item == nil {
+				return withExitCode(exitUsage, "defaults file %s: %s must be a single value or a list of values", path, name)
+			}
+			if err := value.Set(fmt.Sprint(item)); err != nil {
+				return withExitCode(exitUsage, "defaults file %s: %s: %w", path, name, err)
+			}
+		}
+		if list, ok := f.Value.(*stringList); ok {
+			f.Value = &seededList{list: list}
+		}
+		f.DefValue = f.Value.String()
+	}
+	return nil
+}
+
+// seededList is a repeatable flag holding items from the defaults file.
+// The first value given on the command line replaces them instead of being
+// added to them.
+type seededList struct {
+	list     *stringList
+	explicit bool
+}
+
+func (l *seededList) String() string {
+	if l.list == nil {
+		return ""
+	}
+	return l.list.String()
+}
+
+func (l *seededList) Set(value string) error {
+	if !l.explicit {
+		*l.list = nil
+		l.explicit = true
+	}
+	return l.list.Set(value)
+}
@@ -0,0 +1,149 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"nginx_tool/internal/config"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// discoveryTimeout bounds the request to a -proxy-from endpoint, so an
+// unreachable registry fails the run instead of hanging it.
+const discoveryTimeout = 10 * time.Second
+
+// discoveredService is one entry of a discovery response. It covers a plain
+// {"address": ..., "port": ...} or {"url": ...} object as well as the
+// entries of Consul's catalog and health APIs.
+type discoveredService struct {
+	URL            string `json:"url"`
+	Address        string `json:"address"`
+	Host           string `json:"host"`
+	Port           int    `json:"port"`
+	ServiceAddress string `json:"ServiceAddress"`
+	ServicePort    int    `json:"ServicePort"`
+	Service        *struct {
+		Address string `json:"Address"`
+		Port    int    `json:"Port"`
+	} `json:"Service"`
+	Node *struct {
+		Address string `json:"Address"`
+	} `json:"Node"`
+}
+
+// target returns the backend URL of s, or "" when it names no address.
+func (s discoveredService) target() string {
+	if s.URL != "" {
+		return s.URL
+	}
+	host, port := s.Address, s.Port
+	switch {
+	case s.Service != nil:
+		host, port = s.Service.Address, s.Service.Port
+		if host == "" && s.Node != nil {
+			host = s.Node.Address
+		}
+	case s.ServiceAddress != "" || s.ServicePort != 0:
+		host, port = s.ServiceAddress, s.ServicePort
+		if host == "" {
+			host = s.Address
+		}
+	case host == "":
+		host = s.Host
+	}
+	if host == "" {
+		return ""
+	}
+	if strings.Contains(host, ":") && !strings.HasPrefix(host, "[") {
+		host = "[" + host + "]"
+	}
+	if port != 0 {
+		host += ":" + strconv.Itoa(port)
+	}
+	return host
+}
+
+// fetchProxyTarget asks the discovery endpoint at url for the backend
+// address. The response may be a bare address or URL as text, a JSON
+// object, or a JSON list of them, of which the first is used. An address
+// without a scheme gets http://.
+func fetchProxyTarget(url string) (string, error) {
+	client := &http.Client{Timeout: discoveryTimeout}
+	resp, err := client.Get(url)
+	if err != nil {
+		return "", fmt.Errorf("failed to reach discovery endpoint: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("discovery endpoint %s returned %s", url, resp.Status)
+	}
+	data, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return "", fmt.Errorf("failed to read discovery response: %w", err)
+	}
+
+	body := strings.TrimSpace(string(data))
+	var target string
+	switch {
+	case strings.HasPrefix(body, "["):
+		var services []discoveredService
+		if err := json.Unmarshal(data, &services); err != nil {
+			return "", fmt.Errorf("failed to parse discovery response: %w", err)
+		}
+		if len(services) == 0 {
+			return "", fmt.Errorf("discovery endpoint %s lists no instances", url)
+		}
+		if len(services) > 1 {
+			fmt.Fprintf(stderr, "%s%s lists %d instances; using the first\n", sym("⚠️"), url, len(services))
+		}
+		target = services[0].target()
+	case strings.HasPrefix(body, "{"):
+		var service discoveredService
+		if err := json.Unmarshal(data, &service); err != nil {
+			return "", fmt.Errorf("failed to parse discovery response: %w", err)
+		}
+		target = service.target()
+	case strings.HasPrefix(body, `"`):
+		if err := json.Unmarshal(data, &target); err != nil {
+			return "", fmt.Errorf("failed to parse discovery response: %w", err)
+		}
+	default:
+		target = body
+	}
+
+	target = strings.TrimSpace(target)
+	if target == "" || strings.ContainsAny(target, " \t\r\n;{}") {
+		return "", fmt.Errorf("discovery endpoint %s did not return a backend address, such as 10.0.0.5:8080 or {\"address\": \"10.0.0.5\", \"port\": 8080}", url)
+	}
+	if !strings.Contains(target, "://") {
+		target = "http://" + target
+	}
+	return target, nil
+}
+
+// applyProxyFrom sets the proxy_pass of every config to the backend the
+// discovery endpoint returns, replacing proxy_pass, proxy_port and
+// proxy_socket from the files.
+func applyProxyFrom(cfgs []*config.ServerConfig, url, serverType string) error {
+	if url == "" {
+		return nil
+	}
+	if serverType != "proxy" {
+		return withExitCode(exitUsage, "-proxy-from sets proxy_pass and needs -type proxy")
+	}
+	target, err := fetchProxyTarget(url)
+	if err != nil {
+		return withExitCode(exitConfig, "-proxy-from: %w", err)
+	}
+	fmt.Fprintf(stderr, "%sBackend from %s: %s\n", sym("🔎"), url, target)
+	for _, cfg := range cfgs {
+		cfg.ProxyPass, cfg.ProxyPort, cfg.ProxySocket = target, "", ""
+		if err := cfg.Validate(); err != nil {
+			return withExitCode(exitValidation, "invalid configuration for %s with the discovered backend: %w", strings.Join(cfg.Names(), " "), err)
+		}
+	}
+	return nil
+}
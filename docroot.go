@@ -0,0 +1,138 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"html"
+	"io/fs"
+	"nginx_tool/internal/config"
+	"os"
+	"os/user"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"syscall"
+)
+
+// detectNginxUser returns the user named by the user directive of
+// nginx.conf. It fails when the file cannot be read or has no such
+// directive.
+func detectNginxUser(nginxPath string) (string, error) {
+	content, err := os.ReadFile(nginxPath)
+	if err != nil {
+		return "", fmt.Errorf("failed to read nginx config: %w", err)
+	}
+	root, err := config.ParseNginx(string(content))
+	if err != nil {
+		return "", fmt.Errorf("failed to parse nginx config: %w", err)
+	}
+	for _, directive := range root.Find("user") {
+		if len(directive.Args) > 0 {
+			return directive.Args[0], nil
+		}
+	}
+	return "", fmt.Errorf("no user directive in %s", nginxPath)
+}
+
+// nginxUser returns the account the nginx workers run as. Without a user
+// directive it picks the first of the usual distribution accounts that
+// exists, and finally nginx's built-in default "nobody".
+func nginxUser(nginxPath string) string {
+	name, err := detectNginxUser(nginxPath)
+	if err == nil {
+		return name
+	}
+	debugf("nginx user: %v", err)
+	for _, candidate := range []string{"www-data", "nginx"} {
+		if _, err := user.Lookup(candidate); err == nil {
+			return candidate
+		}
+	}
+	return "nobody"
+}
+
+// ensureDocumentRoot creates cfg.Root with a placeholder index file when it
+// does not exist yet, and warns when an existing root cannot be read by the
+// nginx workers.
+func ensureDocumentRoot(cfg *config.ServerConfig, workerUser string) error {
+	if cfg.Root == "" {
+		return nil
+	}
+
+	info, err := os.Stat(cfg.Root)
+	switch {
+	case errors.Is(err, fs.ErrNotExist):
+	case err != nil:
+		return fmt.Errorf("failed to check document root: %w", err)
+	case !info.IsDir():
+		return fmt.Errorf("document root %s exists but is not a directory", cfg.Root)
+	default:
+		if !readableBy(info, workerUser) {
+			fmt.Fprintf(stderr, "%s%s is not readable by the nginx user %s; requests will fail with 403\n", sym("⚠️"), cfg.Root, workerUser)
+		}
+		return nil
+	}
+
+	if err := os.MkdirAll(cfg.Root, 0755); err != nil {
+		return fmt.Errorf("failed to create document root: %w", err)
+	}
+	fmt.Fprintf(stderr, "%sCreated document root %s\n", sym("📁"), cfg.Root)
+	chownTo(cfg.Root, workerUser)
+
+	index := cfg.IndexList()
+	if len(index) == 0 {
+		return nil
+	}
+	name := html.EscapeString(strings.Join(cfg.Names(), " "))
+	page := fmt.Sprintf("<!DOCTYPE html>\n<html>\n<head><title>%s</title></head>\n<body><h1>%s is ready</h1></body>\n</html>\n", name, name)
+	indexPath := filepath.Join(cfg.Root, index[0])
+	if err := os.WriteFile(indexPath, []byte(page), 0644); err != nil {
+		return fmt.Errorf("failed to write placeholder index: %w", err)
+	}
+	chownTo(indexPath, workerUser)
+	fmt.Fprintf(stderr, "%sWrote placeholder %s\n", sym("📄"), indexPath)
+	return nil
+}
+
+// chownTo hands path to username. Failing to do so only warns: the file is
+// still usable as long as the nginx workers can read it.
+func chownTo(path, username string) {
+	u, err := user.Lookup(username)
+	if err != nil {
+		fmt.Fprintf(stderr, "%sCannot look up nginx user %s; leaving %s owned by the current user\n", sym("⚠️"), username, path)
+		return
+	}
+	uid, _ := strconv.Atoi(u.Uid)
+	gid, _ := strconv.Atoi(u.Gid)
+	if err := os.Chown(path, uid, gid); err != nil {
+		fmt.Fprintf(stderr, "%sCould not change the owner of %s to %s: %v\n", sym("⚠️"), path, username, err)
+	}
+}
+
+// readableBy reports whether username may list and enter the directory
+// described by info, judged by its owner, group and permission bits.
+func readableBy(info fs.FileInfo, username string) bool {
+	stat, ok := info.Sys().(*syscall.Stat_t)
+	if !ok {
+		return true
+	}
+	u, err := user.Lookup(username)
+	if err != nil {
+		debugf("cannot look up nginx user %s: %v", username, err)
+		return info.Mode().Perm()&0005 == 0005
+	}
+	if u.Uid == "0" {
+		return true
+	}
+
+	mode := info.Mode().Perm()
+	if u.Uid == strconv.FormatUint(uint64(stat.Uid), 10) {
+		return mode&0500 == 0500
+	}
+	groups, _ := u.GroupIds()
+	if slices.Contains(append(groups, u.Gid), strconv.FormatUint(uint64(stat.Gid), 10)) {
+		return mode&0050 == 0050
+	}
+	return mode&0005 == 0005
+}
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"nginx_tool/internal/generator"
+)
+
+const (
+	exitOK            = 0
+	exitFailure       = 1
+	exitUsage         = 2
+	exitConfig        = 3
+	exitNginxNotFound = 4
+	exitValidation    = 5
+	exitApply         = 6
+	exitCancelled     = 7
+	exitPermission    = 8
+)
+
+var errCancelled = &exitError{code: exitCancelled, err: errors.New("operation cancelled")}
+
+type exitError struct {
+	code int
+	err  error
+}
+
+func (e *exitError) Error() string {
+	return e.err.Error()
+}
+
+func (e *exitError) Unwrap() error {
+	return e.err
+}
+
+func withExitCode(code int, format string, args ...any) error {
+	return &exitError{code: code, err: fmt.Errorf(format, args...)}
+}
+
+func exitCode(err error) int {
+	if err == nil {
+		return exitOK
+	}
+	var exitErr *exitError
+	if errors.As(err, &exitErr) {
+		return exitErr.code
+	}
+	return exitFailure
+}
+
+func applyExitCode(err error) int {
+	if errors.Is(err, generator.ErrConflict) || errors.Is(err, generator.ErrNoMatchingServer) {
+		return exitValidation
+	}
+	return exitApply
+}
@@ -0,0 +1,48 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"nginx_tool/internal/generator"
+	"testing"
+)
+
+func TestExitCode(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want int
+	}{
+		{"success", nil, exitOK},
+		{"plain error", errors.New("failed"), exitFailure},
+		{"config error", withExitCode(exitConfig, "bad config"), exitConfig},
+		{"wrapped", fmt.Errorf("reading: %w", withExitCode(exitPermission, "denied")), exitPermission},
+		{"cancelled", errCancelled, exitCancelled},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := exitCode(tt.err); got != tt.want {
+				t.Errorf("exitCode(%v) = %d, want %d", tt.err, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestApplyExitCode(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want int
+	}{
+		{"conflict", fmt.Errorf("failed to add server block: %w", generator.ErrConflict), exitValidation},
+		{"no matching server", fmt.Errorf("%w for example.com", generator.ErrNoMatchingServer), exitValidation},
+		{"write failure", errors.New("failed to write nginx config"), exitApply},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := applyExitCode(tt.err); got != tt.want {
+				t.Errorf("applyExitCode(%v) = %d, want %d", tt.err, got, tt.want)
+			}
+		})
+	}
+}
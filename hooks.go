@@ -0,0 +1,43 @@
+package main
+
+import (
+	"fmt"
+	"nginx_tool/internal/config"
+	"os"
+	"os/exec"
+	"strings"
+)
+
+// hookEnv describes the apply to a hook: the server names and config files
+// involved, nginx.conf and, after the apply, the backup taken.
+func hookEnv(stage, nginxPath, backupPath string, cfgs []*config.ServerConfig) []string {
+	var names, sources []string
+	for _, cfg := range cfgs {
+		names = append(names, cfg.Names()...)
+		if cfg.Source != "" {
+			sources = append(sources, cfg.Source)
+		}
+	}
+	return append(os.Environ(),
+		"NGINX_TOOL_HOOK="+stage,
+		"NGINX_TOOL_SERVER_NAME="+strings.Join(names, " "),
+		"NGINX_TOOL_CONFIG="+strings.Join(sources, " "),
+		"NGINX_TOOL_NGINX_CONF="+nginxPath,
+		"NGINX_TOOL_BACKUP="+backupPath,
+	)
+}
+
+// runHook runs command with sh -c for the pre or post stage of an apply.
+// Its output goes to stderr so that stdout stays free for -json.
+func runHook(stage, command, nginxPath, backupPath string, cfgs []*config.ServerConfig) error {
+	if command == "" {
+		return nil
+	}
+	fmt.Fprintf(stderr, "%sRunning %s-hook: %s\n", sym("🪝"), stage, command)
+	cmd := exec.Command("sh", "-c", command)
+	cmd.Env = hookEnv(stage, nginxPath, backupPath, cfgs)
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = stderr
+	cmd.Stderr = stderr
+	return cmd.Run()
+}
@@ -0,0 +1,61 @@
+package config
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+var logFormatPattern = regexp.MustCompile(`^[A-Za-z0-9_]+$`)
+
+// AccessLogConfig sets the server's access_log. Format, if set, is defined
+// at http level as a log_format named FormatName; a FormatName without
+// Format refers to a format defined elsewhere, such as nginx's built-in
+// combined. Buffer and Flush turn on buffered writes.
+type AccessLogConfig struct {
+	Path       string `json:"path" yaml:"path"`
+	FormatName string `json:"format_name" yaml:"format_name"`
+	Format     string `json:"format" yaml:"format"`
+	Escape     string `json:"escape" yaml:"escape"`
+	Buffer     string `json:"buffer" yaml:"buffer"`
+	Flush      string `json:"flush" yaml:"flush"`
+}
+
+func (a *AccessLogConfig) validate() error {
+	if a.Path == "off" {
+		if a.FormatName != "" || a.Format != "" || a.Buffer != "" || a.Flush != "" {
+			return fmt.Errorf("access_log path off cannot be combined with a format or buffering")
+		}
+		return nil
+	}
+	if a.Path != "" && (!strings.HasPrefix(a.Path, "/") || strings.ContainsAny(a.Path, " \t;{}")) {
+		return fmt.Errorf("access_log path must be an absolute path without spaces or off, got %q", a.Path)
+	}
+	if a.FormatName != "" && !logFormatPattern.MatchString(a.FormatName) {
+		return fmt.Errorf("invalid access_log format_name %q: use letters, digits and '_'", a.FormatName)
+	}
+	if strings.ContainsAny(a.Format, "'\r\n") {
+		return fmt.Errorf("access_log format must not contain single quotes or line breaks")
+	}
+	switch a.Escape {
+	case "":
+	case "default", "json", "none":
+		if a.Format == "" {
+			return fmt.Errorf("access_log escape applies to the format defined with format")
+		}
+	default:
+		return fmt.Errorf("invalid access_log escape %q: must be default, json or none", a.Escape)
+	}
+	if a.Buffer != "" && !sizePattern.MatchString(a.Buffer) {
+		return fmt.Errorf("invalid access_log buffer %q: use a size such as 32k or 1m", a.Buffer)
+	}
+	if a.Flush != "" {
+		if a.Buffer == "" {
+			return fmt.Errorf("access_log flush requires buffer")
+		}
+		if !expiresPattern.MatchString(a.Flush) {
+			return fmt.Errorf("invalid access_log flush %q: use a time such as 5s or 1m", a.Flush)
+		}
+	}
+	return nil
+}
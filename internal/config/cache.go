@@ -0,0 +1,51 @@
+package config
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// CacheConfig enables proxy_cache for the server. Valid maps space-separated
+// status codes, or "any", to how long such responses are cached, e.g.
+// {"200 302": "10m", "404": "1m"}.
+type CacheConfig struct {
+	Zone     string            `json:"zone" yaml:"zone"`
+	Path     string            `json:"path" yaml:"path"`
+	Size     string            `json:"size" yaml:"size"`
+	MaxSize  string            `json:"max_size" yaml:"max_size"`
+	Inactive string            `json:"inactive" yaml:"inactive"`
+	Key      string            `json:"key" yaml:"key"`
+	Valid    map[string]string `json:"valid" yaml:"valid"`
+}
+
+func (c *CacheConfig) validate() error {
+	if c.Zone != "" && !upstreamPattern.MatchString(c.Zone) {
+		return fmt.Errorf("invalid proxy_cache zone %q: use letters, digits, '.', '-' and '_'", c.Zone)
+	}
+	if c.Path != "" && (!strings.HasPrefix(c.Path, "/") || strings.ContainsAny(c.Path, " \t;{}")) {
+		return fmt.Errorf("proxy_cache path must be an absolute path without spaces, got %q", c.Path)
+	}
+	for name, size := range map[string]string{"size": c.Size, "max_size": c.MaxSize} {
+		if size != "" && !sizePattern.MatchString(size) {
+			return fmt.Errorf("invalid proxy_cache %s %q: use a size such as 10m or 1g", name, size)
+		}
+	}
+	if c.Inactive != "" && !expiresPattern.MatchString(c.Inactive) {
+		return fmt.Errorf("invalid proxy_cache inactive %q: use a time such as 60m or 1d", c.Inactive)
+	}
+	if strings.ContainsAny(c.Key, ";{}\"\r\n") {
+		return fmt.Errorf("proxy_cache key must not contain quotes, braces, semicolons or line breaks")
+	}
+	for codes, valid := range c.Valid {
+		for _, code := range strings.Fields(codes) {
+			if n, err := strconv.Atoi(code); code != "any" && (err != nil || n < 100 || n > 599) {
+				return fmt.Errorf("invalid proxy_cache valid status %q: use a status code or any", code)
+			}
+		}
+		if !expiresPattern.MatchString(valid) {
+			return fmt.Errorf("invalid proxy_cache valid time %q for %s: use a time such as 10m", valid, codes)
+		}
+	}
+	return nil
+}
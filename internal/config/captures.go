@@ -0,0 +1,98 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"regexp/syntax"
+	"strings"
+)
+
+var (
+	// captureGroupPattern matches the named groups of a PCRE pattern in the
+	// three spellings nginx accepts: (?<name>), (?P<name>) and (?'name').
+	captureGroupPattern = regexp.MustCompile(`\(\?(?:P?<([A-Za-z_][A-Za-z0-9_]*)>|'([A-Za-z_][A-Za-z0-9_]*)')`)
+	variableRefPattern  = regexp.MustCompile(`\$(?:\{([A-Za-z0-9_]+)\}|([A-Za-z0-9_]+))`)
+)
+
+// compileServerRegex checks a regex server_name (without its "~"). nginx
+// uses PCRE, so lookarounds and other Perl-only groups Go cannot compile
+// are let through; any other syntax error is reported.
+func compileServerRegex(pattern string) error {
+	_, err := regexp.Compile(pattern)
+	var syntaxErr *syntax.Error
+	if err == nil || errors.As(err, &syntaxErr) && syntaxErr.Code == syntax.ErrInvalidPerlOp {
+		return nil
+	}
+	return err
+}
+
+// captures returns the named groups of the regex server names, which nginx
+// makes available as variables in the server block.
+func (c *ServerConfig) captures() []string {
+	var names []string
+	for _, name := range c.Names() {
+		pattern, ok := strings.CutPrefix(name, "~")
+		if !ok {
+			continue
+		}
+		for _, m := range captureGroupPattern.FindAllStringSubmatch(pattern, -1) {
+			names = append(names, m[1]+m[2])
+		}
+	}
+	return names
+}
+
+// proxyHostVariables returns the variables in the host part of ProxyPass.
+func (c *ServerConfig) proxyHostVariables() []string {
+	_, rest, ok := strings.Cut(c.ProxyPass, "://")
+	if !ok {
+		return nil
+	}
+	host, _, _ := strings.Cut(rest, "/")
+	var names []string
+	for _, m := range variableRefPattern.FindAllStringSubmatch(host, -1) {
+		names = append(names, m[1]+m[2])
+	}
+	return names
+}
+
+// usesCaptures reports whether the proxy_pass host is built from server_name
+// captures, such as http://$tenant.internal for ~^(?<tenant>.+)\.example\.com$.
+func (c *ServerConfig) usesCaptures() bool {
+	captures := c.captures()
+	for _, name := range c.proxyHostVariables() {
+		for _, capture := range captures {
+			if name == capture {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// validateCaptures checks a proxy_pass built from server_name captures:
+// every variable in its host must be a capture or a map variable, and the
+// host is looked up per request, so a resolver is required.
+func (c *ServerConfig) validateCaptures() error {
+	captures := c.captures()
+	if len(captures) == 0 {
+		return nil
+	}
+	known := make(map[string]bool)
+	for _, name := range captures {
+		known[name] = true
+	}
+	for _, m := range c.Maps {
+		known[strings.TrimPrefix(m.Variable, "$")] = true
+	}
+	for _, name := range c.proxyHostVariables() {
+		if !known[name] && strings.Trim(name, "0123456789") != "" {
+			return fmt.Errorf("proxy_pass refers to $%s, but server_name only captures $%s", name, strings.Join(captures, ", $"))
+		}
+	}
+	if c.usesCaptures() && c.Resolver == "" {
+		return fmt.Errorf("proxy_pass built from server_name captures needs resolver, since nginx looks the host up for each request")
+	}
+	return nil
+}
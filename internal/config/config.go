@@ -2,37 +2,345 @@ package config
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
-	"io"
+	"io/fs"
+	"net"
+	"net/url"
 	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
 	"strings"
 
 	"gopkg.in/yaml.v2"
 )
 
+var (
+	extensionPattern = regexp.MustCompile(`^[A-Za-z0-9]+$`)
+	variablePattern  = regexp.MustCompile(`^\$[A-Za-z_][A-Za-z0-9_]*$`)
+	headerPattern    = regexp.MustCompile(`^[A-Za-z0-9-]+$`)
+	upstreamPattern  = regexp.MustCompile(`^[A-Za-z0-9_.-]+$`)
+	sizePattern      = regexp.MustCompile(`^[1-9][0-9]*[kKmMgG]?$`)
+	buffersPattern   = regexp.MustCompile(`^([1-9][0-9]* )?[1-9][0-9]*[kKmM]?$`)
+	mimePattern      = regexp.MustCompile(`^[a-z]+/[A-Za-z0-9.+*-]+$`)
+	expiresPattern   = regexp.MustCompile(`^(max|off|epoch|-?([0-9]+(ms|s|m|h|d|w|M|y)?)+)$`)
+	redirectPattern  = regexp.MustCompile(`^(https?|\$scheme)://[^\s/;{}'"]+(/[^\s;{}'"]*)?$`)
+	// certificatePattern finds the certificate and key files a raw
+	// directive points nginx at.
+	certificatePattern = regexp.MustCompile(`(?m)^\s*(ssl_certificate|ssl_certificate_key|ssl_trusted_certificate|ssl_client_certificate|ssl_dhparam)\s+("[^"]*"|'[^']*'|[^\s;]+)\s*;`)
+)
+
 type ServerConfig struct {
-	Listen     string `json:"listen" yaml:"listen"`
-	ServerName string `json:"server_name" yaml:"server_name"`
-	Root       string `json:"root" yaml:"root"`
-	Index      string `json:"index" yaml:"index"`
-	ProxyPass  string `json:"proxy_pass" yaml:"proxy_pass"`
-	ProxyPort  string `json:"proxy_port" yaml:"proxy_port"`
+	Listen          string            `json:"listen" yaml:"listen"`
+	Listens         []ListenSpec      `json:"listens" yaml:"listens"`
+	ServerName      string            `json:"server_name" yaml:"server_name"`
+	ServerNames     NameList          `json:"server_names" yaml:"server_names"`
+	ServerNamesFile string            `json:"server_names_file" yaml:"server_names_file"`
+	Root            string            `json:"root" yaml:"root"`
+	Index           string            `json:"index" yaml:"index"`
+	IndexFiles      []string          `json:"index_files" yaml:"index_files"`
+	ProxyPass       string            `json:"proxy_pass" yaml:"proxy_pass"`
+	ProxyPort       string            `json:"proxy_port" yaml:"proxy_port"`
+	ProxySocket     string            `json:"proxy_socket" yaml:"proxy_socket"`
+	GRPCPass        string            `json:"grpc_pass" yaml:"grpc_pass"`
+	ProxySSLVerify  bool              `json:"proxy_ssl_verify" yaml:"proxy_ssl_verify"`
+	ProxySSLName    string            `json:"proxy_ssl_name" yaml:"proxy_ssl_name"`
+	ProxySSLCA      string            `json:"proxy_ssl_trusted_certificate" yaml:"proxy_ssl_trusted_certificate"`
+	ProxyHost       string            `json:"proxy_host" yaml:"proxy_host"`
+	Resolver        string            `json:"resolver" yaml:"resolver"`
+	Upstream        string            `json:"upstream" yaml:"upstream"`
+	Upstreams       []UpstreamServer  `json:"upstreams" yaml:"upstreams"`
+	UpstreamGroups  []UpstreamGroup   `json:"upstream_groups" yaml:"upstream_groups"`
+	MaxFails        int               `json:"upstream_max_fails" yaml:"upstream_max_fails"`
+	FailTimeout     string            `json:"upstream_fail_timeout" yaml:"upstream_fail_timeout"`
+	NextUpstream    string            `json:"proxy_next_upstream" yaml:"proxy_next_upstream"`
+	Keepalive       int               `json:"keepalive" yaml:"keepalive"`
+	LimitConn       int               `json:"limit_conn" yaml:"limit_conn"`
+	LimitConnZone   string            `json:"limit_conn_zone" yaml:"limit_conn_zone"`
+	LimitConnSize   string            `json:"limit_conn_zone_size" yaml:"limit_conn_zone_size"`
+	ProxyCache      *CacheConfig      `json:"proxy_cache" yaml:"proxy_cache"`
+	AccessLog       *AccessLogConfig  `json:"access_log" yaml:"access_log"`
+	Underscores     bool              `json:"underscores_in_headers" yaml:"underscores_in_headers"`
+	HeaderBuffers   string            `json:"large_client_header_buffers" yaml:"large_client_header_buffers"`
+	ProxyBufferSize string            `json:"proxy_buffer_size" yaml:"proxy_buffer_size"`
+	Gzip            bool              `json:"gzip" yaml:"gzip"`
+	Brotli          bool              `json:"brotli" yaml:"brotli"`
+	BrotliLevel     int               `json:"brotli_comp_level" yaml:"brotli_comp_level"`
+	CompressTypes   []string          `json:"compress_types" yaml:"compress_types"`
+	SecurityHeaders bool              `json:"security_headers" yaml:"security_headers"`
+	Headers         map[string]string `json:"headers" yaml:"headers"`
+	DisableHeaders  []string          `json:"disable_headers" yaml:"disable_headers"`
+	AuthRequest     string            `json:"auth_request" yaml:"auth_request"`
+	AuthService     string            `json:"auth_service" yaml:"auth_service"`
+	AuthHeaders     []string          `json:"auth_headers" yaml:"auth_headers"`
+	AuthBasic       string            `json:"auth_basic" yaml:"auth_basic"`
+	AuthBasicFile   string            `json:"auth_basic_user_file" yaml:"auth_basic_user_file"`
+	AllowIPs        []string          `json:"allow_ips" yaml:"allow_ips"`
+	DenyAll         bool              `json:"deny_all" yaml:"deny_all"`
+	Blocklist       []string          `json:"blocklist" yaml:"blocklist"`
+	BlocklistFile   string            `json:"blocklist_file" yaml:"blocklist_file"`
+	Satisfy         string            `json:"satisfy" yaml:"satisfy"`
+	Maintenance     bool              `json:"maintenance" yaml:"maintenance"`
+	MaintenanceFlag string            `json:"maintenance_flag" yaml:"maintenance_flag"`
+	MaintenancePage string            `json:"maintenance_page" yaml:"maintenance_page"`
+	MaintenanceRoot string            `json:"maintenance_root" yaml:"maintenance_root"`
+	ErrorPages      map[string]string `json:"error_pages" yaml:"error_pages"`
+	ErrorRoot       string            `json:"error_root" yaml:"error_root"`
+	InterceptErrors bool              `json:"proxy_intercept_errors" yaml:"proxy_intercept_errors"`
+	RedirectTo      string            `json:"redirect_to" yaml:"redirect_to"`
+	RedirectCode    int               `json:"redirect_code" yaml:"redirect_code"`
+	StaticCache     bool              `json:"static_cache" yaml:"static_cache"`
+	CacheExtensions []string          `json:"cache_extensions" yaml:"cache_extensions"`
+	CacheExpires    string            `json:"cache_expires" yaml:"cache_expires"`
+	WebDAV          *WebDAVConfig     `json:"webdav" yaml:"webdav"`
+	Maps            []MapConfig       `json:"maps" yaml:"maps"`
+	Conditions      []Condition       `json:"conditions" yaml:"conditions"`
+	Locations       []LocationConfig  `json:"locations" yaml:"locations"`
+	Routes          map[string]string `json:"routes" yaml:"routes"`
+	ACMEChallenge   bool              `json:"acme_challenge" yaml:"acme_challenge"`
+	ACMEWebroot     string            `json:"acme_webroot" yaml:"acme_webroot"`
+	DenyDotfiles    bool              `json:"deny_dotfiles" yaml:"deny_dotfiles"`
+	RawDirectives   []string          `json:"raw_directives" yaml:"raw_directives"`
+	Source          string            `json:"-" yaml:"-"`
+	Warnings        []string          `json:"-" yaml:"-"`
+}
+
+// defaultProxyDirectives are the headers and directives of the built-in
+// proxy block that disable_headers may remove.
+var defaultProxyDirectives = []string{
+	"Upgrade", "Connection", "Host", "X-Real-IP", "X-Forwarded-For",
+	"X-Forwarded-Proto", "X-Forwarded-Host", "X-Forwarded-Port",
+	"proxy_http_version", "proxy_cache_bypass", "proxy_redirect",
+}
+
+// IsDefaultProxyDirective reports whether name is one of the defaults
+// disable_headers can remove, or a prefix pattern such as "X-Forwarded-*"
+// that matches at least one of them. Header names are case-insensitive.
+func IsDefaultProxyDirective(name string) bool {
+	for _, d := range defaultProxyDirectives {
+		if MatchesDirective(name, d) {
+			return true
+		}
+	}
+	return false
+}
+
+// MatchesDirective reports whether the disable_headers entry pattern
+// selects directive.
+func MatchesDirective(pattern, directive string) bool {
+	if prefix, ok := strings.CutSuffix(pattern, "*"); ok {
+		return len(directive) >= len(prefix) && strings.EqualFold(directive[:len(prefix)], prefix)
+	}
+	return strings.EqualFold(pattern, directive)
+}
+
+// NameList holds server names. In JSON and YAML it may be written either as a
+// list or as a single space-separated string.
+type NameList []string
+
+func (n *NameList) UnmarshalJSON(data []byte) error {
+	var single string
+	if err := json.Unmarshal(data, &single); err == nil {
+		*n = strings.Fields(single)
+		return nil
+	}
+	var list []string
+	if err := json.Unmarshal(data, &list); err != nil {
+		return fmt.Errorf("server_names must be a string or a list of strings")
+	}
+	*n = list
+	return nil
+}
+
+func (n *NameList) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	var single string
+	if err := unmarshal(&single); err == nil {
+		*n = strings.Fields(single)
+		return nil
+	}
+	var list []string
+	if err := unmarshal(&list); err != nil {
+		return fmt.Errorf("server_names must be a string or a list of strings")
+	}
+	*n = list
+	return nil
 }
 
-func Load(filepath string) (*ServerConfig, error) {
-	file, err := os.Open(filepath)
+// UnmarshalJSON accepts JSON numbers for the port-like fields listen and
+// proxy_port, so "listen": 80 works like "listen": "80".
+func (c *ServerConfig) UnmarshalJSON(data []byte) error {
+	data, err := quoteNumbers(data, "listen", "proxy_port")
 	if err != nil {
-		return nil, fmt.Errorf("failed to read config file: %w", err)
+		return err
 	}
-	defer file.Close()
+	type plain ServerConfig
+	return json.Unmarshal(data, (*plain)(c))
+}
+
+// quoteNumbers rewrites the numeric values of keys in the JSON object data
+// as strings. Anything that is not an object is returned unchanged for the
+// caller's decoder to report.
+func quoteNumbers(data []byte, keys ...string) ([]byte, error) {
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return data, nil
+	}
+	changed := false
+	for _, key := range keys {
+		var number json.Number
+		if raw, ok := fields[key]; ok && json.Unmarshal(raw, &number) == nil {
+			fields[key], _ = json.Marshal(number.String())
+			changed = true
+		}
+	}
+	if !changed {
+		return data, nil
+	}
+	return json.Marshal(fields)
+}
 
-	data, err := io.ReadAll(file)
+type MapConfig struct {
+	Source   string            `json:"source" yaml:"source"`
+	Variable string            `json:"variable" yaml:"variable"`
+	Default  string            `json:"default" yaml:"default"`
+	Entries  map[string]string `json:"entries" yaml:"entries"`
+}
+
+// Condition is a server-level if block: when Variable compares to Value
+// with Operator ("=", "!=", "~" or "~*"), Action runs, e.g.
+// "return 301 https://new.example.com$request_uri".
+type Condition struct {
+	Variable string `json:"variable" yaml:"variable"`
+	Operator string `json:"operator" yaml:"operator"`
+	Value    string `json:"value" yaml:"value"`
+	Action   string `json:"action" yaml:"action"`
+}
+
+// Statement returns Action terminated by a semicolon.
+func (c Condition) Statement() string {
+	action := strings.TrimSpace(c.Action)
+	if strings.HasSuffix(action, "}") {
+		return action
+	}
+	return strings.TrimSuffix(action, ";") + ";"
+}
+
+func (c Condition) validate() error {
+	if !variablePattern.MatchString(c.Variable) {
+		return fmt.Errorf("condition variable must be an nginx variable such as $host, got %q", c.Variable)
+	}
+	switch c.Operator {
+	case "=", "!=":
+	case "~", "~*":
+		if c.Value == "" {
+			return fmt.Errorf("condition on %s: %s needs a regular expression as value", c.Variable, c.Operator)
+		}
+		if _, err := regexp.Compile(c.Value); err != nil {
+			return fmt.Errorf("condition on %s: invalid regular expression %q: %w", c.Variable, c.Value, err)
+		}
+	default:
+		return fmt.Errorf("condition on %s: invalid operator %q: must be =, !=, ~ or ~*", c.Variable, c.Operator)
+	}
+	if strings.ContainsAny(c.Value, "\n") {
+		return fmt.Errorf("condition on %s: value may not span lines", c.Variable)
+	}
+
+	action := strings.TrimSpace(c.Action)
+	if action == "" || action == ";" {
+		return fmt.Errorf("condition on %s needs an action such as \"return 301 https://example.com$request_uri\"", c.Variable)
+	}
+	root, err := ParseNginx(c.Statement())
+	if err != nil {
+		return fmt.Errorf("condition on %s: invalid action %q: %w", c.Variable, c.Action, err)
+	}
+	for _, d := range root.Children {
+		if d.IsBlock() {
+			return fmt.Errorf("condition on %s: action may not open a %s block", c.Variable, d.Name)
+		}
+	}
+	return nil
+}
+
+// LocationConfig is an extra location block. Path holds the optional
+// modifier and the URI as written in nginx, e.g. "/api/", "= /health" or
+// "~* \.php$".
+type LocationConfig struct {
+	Path      string       `json:"path" yaml:"path"`
+	Root      string       `json:"root" yaml:"root"`
+	Alias     string       `json:"alias" yaml:"alias"`
+	ProxyPass string       `json:"proxy_pass" yaml:"proxy_pass"`
+	Return    string       `json:"return" yaml:"return"`
+	Rewrite   *RewriteRule `json:"rewrite" yaml:"rewrite"`
+	Upstream  string       `json:"upstream" yaml:"upstream"`
+}
+
+// RewriteRule is a rewrite directive emitted before the location's
+// proxy_pass or root. Flag is one of last, break, redirect or permanent, or
+// empty to continue with the next rewrite.
+type RewriteRule struct {
+	Match       string `json:"match" yaml:"match"`
+	Replacement string `json:"replacement" yaml:"replacement"`
+	Flag        string `json:"flag" yaml:"flag"`
+}
+
+// Modifier splits Path into its match modifier ("", "=", "^~", "~" or "~*")
+// and URI.
+func (l LocationConfig) Modifier() (string, string) {
+	fields := strings.Fields(l.Path)
+	if len(fields) == 2 {
+		switch fields[0] {
+		case "=", "^~", "~", "~*":
+			return fields[0], fields[1]
+		}
+	}
+	return "", strings.TrimSpace(l.Path)
+}
+
+// Load reads a JSON, YAML or .env configuration from a file or a Git source
+// (see readSource). The format comes from the file extension unless format
+// names one; when it is "auto" or the extension is not a known one, it is
+// detected from the contents. With strict set, keys that do not match any
+// configuration field are an error instead of being ignored.
+func Load(path string, strict bool, format string) (*ServerConfig, error) {
+	cfg, err := load(path, strict, format)
+	if err != nil {
+		return nil, err
+	}
+	if cfg.Listen == "" && len(cfg.Listens) == 0 {
+		cfg.Listen = "80"
+	}
+	if cfg.Index == "" && len(cfg.IndexFiles) == 0 && cfg.Root != "" {
+		cfg.Index = "index.html"
+	}
+	return cfg, nil
+}
+
+func load(path string, strict bool, format string) (*ServerConfig, error) {
+	data, name, err := readSource(path)
 	if err != nil {
-		return nil, fmt.Errorf("failed to read config file: %w", err)
+		return nil, err
 	}
 
 	var cfg ServerConfig
-	ext := strings.ToLower(filepath[strings.LastIndex(filepath, ".")+1:])
+	ext := format
+	if ext == "" {
+		ext = strings.ToLower(strings.TrimPrefix(filepath.Ext(name), "."))
+		if !IsConfigFile(name) {
+			ext = "auto"
+		}
+	}
+	if ext == "auto" {
+		if ext, err = detectFormat(data); err != nil {
+			return nil, fmt.Errorf("%s: %w", name, err)
+		}
+	}
+
+	if strict && ext != "env" {
+		if err := checkUnknownKeys(data, ext); err != nil {
+			return nil, fmt.Errorf("failed to parse config strictly: %w", err)
+		}
+	}
 
 	switch ext {
 	case "json":
@@ -43,16 +351,730 @@ func Load(filepath string) (*ServerConfig, error) {
 		if err := yaml.Unmarshal(data, &cfg); err != nil {
 			return nil, fmt.Errorf("failed to parse YAML config: %w", err)
 		}
+	case "env":
+		unknown, err := parseEnv(data, &cfg)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse env config: %w", err)
+		}
+		if strict && len(unknown) > 0 {
+			return nil, fmt.Errorf("failed to parse config strictly: unknown config keys: %s", strings.Join(unknown, ", "))
+		}
+		for _, key := range unknown {
+			cfg.Warnings = append(cfg.Warnings, "ignoring unknown key "+key)
+		}
 	default:
 		return nil, fmt.Errorf("unsupported config file format: %s", ext)
 	}
 
-	if cfg.Listen == "" {
-		cfg.Listen = "80"
+	if cfg.ServerNamesFile != "" {
+		names, err := readListFile("server_names_file", relativeTo(path, cfg.ServerNamesFile))
+		if err != nil {
+			return nil, err
+		}
+		cfg.ServerNames = append(cfg.ServerNames, names...)
 	}
-	if cfg.Index == "" && cfg.Root != "" {
-		cfg.Index = "index.html"
+	if cfg.BlocklistFile != "" {
+		entries, err := readListFile("blocklist_file", relativeTo(path, cfg.BlocklistFile))
+		if err != nil {
+			return nil, err
+		}
+		cfg.Blocklist = append(cfg.Blocklist, entries...)
 	}
+	cfg.Source = path
 
 	return &cfg, nil
 }
+
+// relativeTo resolves a file named in the config at source against the
+// config's directory.
+func relativeTo(source, path string) string {
+	if filepath.IsAbs(path) || isGitSource(source) {
+		return path
+	}
+	return filepath.Join(filepath.Dir(source), path)
+}
+
+// readListFile reads the entries of the text file named by the config key,
+// one or more per line. Blank lines and # comments are skipped.
+func readListFile(key, path string) ([]string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", key, err)
+	}
+	var entries []string
+	for _, line := range strings.Split(string(data), "\n") {
+		line, _, _ = strings.Cut(line, "#")
+		entries = append(entries, strings.Fields(line)...)
+	}
+	if len(entries) == 0 {
+		return nil, fmt.Errorf("%s %s lists no entries", key, path)
+	}
+	return entries, nil
+}
+
+// Names returns every name from ServerName and ServerNames in order, without
+// duplicates.
+func (c *ServerConfig) Names() []string {
+	var names []string
+	seen := make(map[string]bool)
+	for _, name := range append(strings.Fields(c.ServerName), c.ServerNames...) {
+		if !seen[name] {
+			seen[name] = true
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+// IndexList returns the index files in the order nginx tries them, from
+// index_files or the space-separated index.
+func (c *ServerConfig) IndexList() []string {
+	if len(c.IndexFiles) > 0 {
+		return c.IndexFiles
+	}
+	return strings.Fields(c.Index)
+}
+
+// ProxyUpstream returns the host of ProxyPass when it may name an upstream
+// block instead of a backend address, as in http://my-upstream: a host
+// without a port that is neither an IP address nor localhost. It returns ""
+// otherwise, and when upstreams replaces the host anyway.
+func (c *ServerConfig) ProxyUpstream() string {
+	if len(c.Upstreams) > 0 || strings.Contains(c.ProxyPass, "$") || strings.HasPrefix(c.ProxyPass, "http://unix:") {
+		return ""
+	}
+	target, err := url.Parse(c.ProxyPass)
+	if err != nil || target.Host == "" || target.Port() != "" {
+		return ""
+	}
+	host := target.Hostname()
+	if host == "localhost" || net.ParseIP(host) != nil {
+		return ""
+	}
+	return host
+}
+
+// SSL reports whether the listen value carries the ssl parameter.
+func (c *ServerConfig) SSL() bool {
+	for _, listen := range c.ListenValues() {
+		if fields := strings.Fields(listen); len(fields) > 1 && containsField(fields[1:], "ssl") {
+			return true
+		}
+	}
+	return false
+}
+
+// AllLocations returns Locations plus the locations implied by other
+// options, such as routes and the ACME challenge location.
+func (c *ServerConfig) AllLocations() []LocationConfig {
+	locations := append([]LocationConfig(nil), c.Locations...)
+	locations = append(locations, c.routeLocations()...)
+	if c.ACMEChallenge {
+		webroot := c.ACMEWebroot
+		if webroot == "" {
+			webroot = "/var/www/certbot"
+		}
+		locations = append(locations, LocationConfig{Path: "^~ /.well-known/acme-challenge/", Root: webroot})
+	}
+	return locations
+}
+
+// MissingPaths returns a warning for every file or directory the server
+// block refers to that does not exist on this machine, including the
+// certificate and key files named by ssl_* raw directives. They are not
+// errors, since the paths may only exist inside the container nginx runs in.
+func (c *ServerConfig) MissingPaths() []string {
+	type pathSetting struct{ name, path string }
+	settings := []pathSetting{
+		{"root", c.Root},
+		{"proxy_ssl_trusted_certificate", c.ProxySSLCA},
+		{"auth_basic_user_file", c.AuthBasicFile},
+		{"error_root", c.ErrorRoot},
+		{"maintenance_root", c.MaintenanceRoot},
+	}
+	if c.WebDAV != nil {
+		settings = append(settings, pathSetting{"webdav auth_basic_user_file", c.WebDAV.AuthBasicFile})
+	}
+	for _, location := range c.AllLocations() {
+		settings = append(settings, pathSetting{"location " + location.Path + " root", location.Root})
+	}
+	for _, raw := range c.RawDirectives {
+		for _, match := range certificatePattern.FindAllStringSubmatch(raw, -1) {
+			path := strings.Trim(match[2], `"'`)
+			if strings.HasPrefix(path, "data:") || strings.HasPrefix(path, "engine:") {
+				continue
+			}
+			settings = append(settings, pathSetting{match[1], path})
+		}
+	}
+
+	var warnings []string
+	for _, setting := range settings {
+		if setting.path == "" || strings.Contains(setting.path, "$") {
+			continue
+		}
+		if _, err := os.Stat(setting.path); errors.Is(err, fs.ErrNotExist) {
+			warnings = append(warnings, fmt.Sprintf("%s %s does not exist", setting.name, setting.path))
+		}
+	}
+	return warnings
+}
+
+// ValidateFor checks cfg as Validate does, and also the fields the server
+// type depends on: a redirect server has nowhere to send clients without
+// redirect_to.
+func (c *ServerConfig) ValidateFor(serverType string) error {
+	if err := c.Validate(); err != nil {
+		return err
+	}
+	if serverType == "redirect" && c.RedirectTo == "" {
+		return fmt.Errorf("redirect servers need redirect_to, an absolute URL such as https://example.com")
+	}
+	return nil
+}
+
+func (c *ServerConfig) Validate() error {
+	if c.Listen != "" && len(c.Listens) > 0 {
+		return fmt.Errorf("set either listen or listens, not both")
+	}
+	for _, spec := range c.Listens {
+		if strings.TrimSpace(spec.Address) == "" {
+			return fmt.Errorf("every listens entry needs an address, such as 443 or [::]:443")
+		}
+		if spec.Backlog < 0 {
+			return fmt.Errorf("invalid backlog %d for listen %s: must be a positive number", spec.Backlog, spec.Address)
+		}
+	}
+	seenListens := make(map[string]bool)
+	for _, listen := range c.ListenValues() {
+		if err := validateListen(listen); err != nil {
+			return err
+		}
+		if addr := strings.Fields(listen); len(addr) > 0 {
+			if seenListens[addr[0]] {
+				return fmt.Errorf("listen %s is given more than once", addr[0])
+			}
+			seenListens[addr[0]] = true
+		}
+	}
+	if err := validateReusePort(c.ListenValues()); err != nil {
+		return err
+	}
+	for _, name := range c.Names() {
+		if err := validateServerName(name); err != nil {
+			return err
+		}
+	}
+	if c.Index != "" && len(c.IndexFiles) > 0 {
+		return fmt.Errorf("set either index or index_files, not both")
+	}
+	for _, file := range c.IndexList() {
+		if strings.ContainsAny(file, " \t;{}\"'") {
+			return fmt.Errorf("invalid index file %q: whitespace, quotes, braces and semicolons are not allowed", file)
+		}
+	}
+	switch c.RedirectCode {
+	case 0, 301, 302:
+	default:
+		return fmt.Errorf("redirect_code must be 301 or 302, got %d", c.RedirectCode)
+	}
+	if c.RedirectTo != "" && !redirectPattern.MatchString(c.RedirectTo) {
+		return fmt.Errorf("redirect_to must be an absolute URL with a scheme and host, such as https://example.com, got %q", c.RedirectTo)
+	}
+	if c.ProxySocket != "" {
+		if c.ProxyPass != "" {
+			return fmt.Errorf("proxy_socket and proxy_pass are mutually exclusive")
+		}
+		if !strings.HasPrefix(c.ProxySocket, "/") {
+			return fmt.Errorf("proxy_socket must be an absolute path, got %q", c.ProxySocket)
+		}
+	}
+	if c.GRPCPass != "" {
+		scheme, address, ok := strings.Cut(c.GRPCPass, "://")
+		if !ok {
+			scheme, address = "grpc", c.GRPCPass
+		}
+		if scheme != "grpc" && scheme != "grpcs" || address == "" || strings.ContainsAny(c.GRPCPass, " \t;{}") {
+			return fmt.Errorf("invalid grpc_pass %q: use grpc://host:port, grpcs://host:port or host:port", c.GRPCPass)
+		}
+	}
+	if rest, ok := strings.CutPrefix(c.ProxyPass, "http://unix:"); ok {
+		if !strings.HasPrefix(rest, "/") {
+			return fmt.Errorf("unix socket proxy_pass must use an absolute path, e.g. http://unix:/run/app.sock:/")
+		}
+	}
+	if (c.ProxySSLVerify || c.ProxySSLName != "" || c.ProxySSLCA != "") && !strings.HasPrefix(c.ProxyPass, "https://") {
+		return fmt.Errorf("proxy_ssl_verify, proxy_ssl_name and proxy_ssl_trusted_certificate only apply to an https:// proxy_pass")
+	}
+	if c.ProxyHost != "" {
+		if strings.ContainsAny(c.ProxyHost, " \t\"';{}") {
+			return fmt.Errorf("invalid proxy_host %q: use upstream or a host name such as api.internal, without spaces, quotes, braces or semicolons", c.ProxyHost)
+		}
+		for _, name := range c.DisableHeaders {
+			if MatchesDirective(name, "Host") {
+				return fmt.Errorf("proxy_host sets the Host header, which disable_headers %q removes", name)
+			}
+		}
+	}
+	if err := c.validateCaptures(); err != nil {
+		return err
+	}
+	if c.Resolver != "" {
+		target, err := url.Parse(c.ProxyPass)
+		if err != nil || target.Host == "" || strings.Contains(c.ProxyPass, "$") && !c.usesCaptures() || strings.HasPrefix(c.ProxyPass, "http://unix:") {
+			return fmt.Errorf("resolver requires proxy_pass to be a URL with a hostname, such as http://api.internal:8080")
+		}
+		if strings.ContainsAny(c.Resolver, ";{}") {
+			return fmt.Errorf("invalid resolver %q: braces and semicolons are not allowed", c.Resolver)
+		}
+	}
+	if c.ACMEWebroot != "" && !strings.HasPrefix(c.ACMEWebroot, "/") {
+		return fmt.Errorf("acme_webroot must be an absolute path, got %q", c.ACMEWebroot)
+	}
+	if c.Keepalive < 0 {
+		return fmt.Errorf("keepalive must be a positive number of idle connections, got %d", c.Keepalive)
+	}
+	if c.Keepalive > 0 {
+		if c.Resolver != "" {
+			return fmt.Errorf("keepalive and resolver are mutually exclusive: keepalive needs an upstream block, resolver a variable proxy_pass")
+		}
+		if strings.Contains(c.ProxyPass, "$") {
+			return fmt.Errorf("keepalive cannot be used with a proxy_pass that contains variables")
+		}
+	}
+	if c.ProxyCache != nil {
+		if err := c.ProxyCache.validate(); err != nil {
+			return err
+		}
+	}
+	if c.AccessLog != nil {
+		if err := c.AccessLog.validate(); err != nil {
+			return err
+		}
+	}
+	if c.WebDAV != nil {
+		if err := c.WebDAV.validate(); err != nil {
+			return err
+		}
+		if c.Root == "" {
+			return fmt.Errorf("webdav stores files under root; set root")
+		}
+	}
+	if c.LimitConn < 0 {
+		return fmt.Errorf("limit_conn must be a positive number of connections per client, got %d", c.LimitConn)
+	}
+	if c.LimitConn == 0 && (c.LimitConnZone != "" || c.LimitConnSize != "") {
+		return fmt.Errorf("limit_conn_zone and limit_conn_zone_size require limit_conn")
+	}
+	if c.LimitConnZone != "" && !upstreamPattern.MatchString(c.LimitConnZone) {
+		return fmt.Errorf("invalid limit_conn_zone name %q: use letters, digits, '.', '-' and '_'", c.LimitConnZone)
+	}
+	if c.LimitConnSize != "" && !sizePattern.MatchString(c.LimitConnSize) {
+		return fmt.Errorf("invalid limit_conn_zone_size %q: use a size such as 10m or 512k", c.LimitConnSize)
+	}
+	if c.HeaderBuffers != "" && !buffersPattern.MatchString(c.HeaderBuffers) {
+		return fmt.Errorf("invalid large_client_header_buffers %q: use a count and size such as \"4 16k\", or just a size", c.HeaderBuffers)
+	}
+	if c.ProxyBufferSize != "" && !sizePattern.MatchString(c.ProxyBufferSize) {
+		return fmt.Errorf("invalid proxy_buffer_size %q: use a size such as 16k", c.ProxyBufferSize)
+	}
+	if c.BrotliLevel != 0 && !c.Brotli {
+		return fmt.Errorf("brotli_comp_level requires brotli")
+	}
+	if c.BrotliLevel < 0 || c.BrotliLevel > 11 {
+		return fmt.Errorf("brotli_comp_level must be from 1 to 11, got %d", c.BrotliLevel)
+	}
+	if len(c.CompressTypes) > 0 && !c.Gzip && !c.Brotli {
+		return fmt.Errorf("compress_types requires gzip or brotli")
+	}
+	for _, mime := range c.CompressTypes {
+		if !mimePattern.MatchString(mime) {
+			return fmt.Errorf("invalid compress_types entry %q: use a MIME type such as application/json", mime)
+		}
+	}
+	if len(c.Upstreams) > 0 {
+		if c.ProxyPort != "" || c.ProxySocket != "" {
+			return fmt.Errorf("upstreams replaces proxy_port and proxy_socket; set only one of them")
+		}
+		if c.Resolver != "" || strings.Contains(c.ProxyPass, "$") {
+			return fmt.Errorf("upstreams cannot be combined with resolver or a proxy_pass that contains variables")
+		}
+		if err := validateUpstreams(c.Upstreams); err != nil {
+			return err
+		}
+	}
+	if err := c.validateHealthChecks(); err != nil {
+		return err
+	}
+	if c.Upstream != "" && !upstreamPattern.MatchString(c.Upstream) {
+		return fmt.Errorf("invalid upstream name %q: use letters, digits, '.', '-' and '_'", c.Upstream)
+	}
+	if err := c.validateUpstreamGroups(); err != nil {
+		return err
+	}
+	for name, value := range c.Headers {
+		if !headerPattern.MatchString(name) {
+			return fmt.Errorf("invalid header name %q: use letters, digits and '-'", name)
+		}
+		if strings.ContainsAny(value, "\r\n") {
+			return fmt.Errorf("header %s must not contain line breaks", name)
+		}
+	}
+	if c.AuthRequest != "" || c.AuthService != "" {
+		if !strings.HasPrefix(c.AuthRequest, "/") || strings.ContainsAny(c.AuthRequest, " ;{}") {
+			return fmt.Errorf("auth_request must be an internal URI such as /_auth, got %q", c.AuthRequest)
+		}
+		if !strings.HasPrefix(c.AuthService, "http://") && !strings.HasPrefix(c.AuthService, "https://") {
+			return fmt.Errorf("auth_service must be the http(s) URL of the auth endpoint, got %q", c.AuthService)
+		}
+	}
+	if c.MaintenanceFlag != "" && !strings.HasPrefix(c.MaintenanceFlag, "/") {
+		return fmt.Errorf("maintenance_flag must be an absolute path, got %q", c.MaintenanceFlag)
+	}
+	if c.MaintenancePage != "" && !strings.HasPrefix(c.MaintenancePage, "/") {
+		return fmt.Errorf("maintenance_page must be a URI starting with /, got %q", c.MaintenancePage)
+	}
+	if err := validateErrorPages(c.ErrorPages); err != nil {
+		return err
+	}
+	if c.ErrorRoot != "" && !strings.HasPrefix(c.ErrorRoot, "/") {
+		return fmt.Errorf("error_root must be an absolute path, got %q", c.ErrorRoot)
+	}
+	if err := c.validateAccess(); err != nil {
+		return err
+	}
+	for _, raw := range c.RawDirectives {
+		if err := ValidateRawDirective(raw); err != nil {
+			return err
+		}
+	}
+	for _, name := range c.DisableHeaders {
+		if !IsDefaultProxyDirective(name) {
+			return fmt.Errorf("disable_headers: %q is not one of the default proxy headers or directives", name)
+		}
+	}
+	for _, header := range c.AuthHeaders {
+		if !headerPattern.MatchString(header) {
+			return fmt.Errorf("invalid auth header %q: use letters, digits and '-'", header)
+		}
+	}
+	if err := validateRoutes(c.Routes); err != nil {
+		return err
+	}
+	if err := validateLocations(c.AllLocations()); err != nil {
+		return err
+	}
+	if c.WebDAV != nil {
+		path := c.WebDAV.Path
+		if path == "" {
+			path = "/webdav/"
+		}
+		for _, location := range c.AllLocations() {
+			if modifier, uri := location.Modifier(); uri == path && modifier != "=" && modifier != "~" && modifier != "~*" {
+				return fmt.Errorf("location %s is also used by webdav", location.Path)
+			}
+		}
+	}
+	for _, ext := range c.CacheExtensions {
+		if !extensionPattern.MatchString(ext) {
+			return fmt.Errorf("invalid cache extension %q: use letters and digits only, without the leading dot", ext)
+		}
+	}
+	for _, m := range c.Maps {
+		if !strings.HasPrefix(m.Source, "$") {
+			return fmt.Errorf("map source must be an nginx variable such as $cookie_variant, got %q", m.Source)
+		}
+		if !variablePattern.MatchString(m.Variable) {
+			return fmt.Errorf("map variable must be a new variable name such as $backend, got %q", m.Variable)
+		}
+	}
+	for _, condition := range c.Conditions {
+		if err := condition.validate(); err != nil {
+			return err
+		}
+	}
+	if c.CacheExpires != "" && !expiresPattern.MatchString(c.CacheExpires) {
+		return fmt.Errorf("invalid cache_expires %q: expected a duration such as 30d, 12h, max, epoch or off", c.CacheExpires)
+	}
+	return nil
+}
+
+// validateListen checks the address part of a listen value: a port, an
+// address or host with an optional port, a bracketed IPv6 address or a unix
+// socket. Parameters such as default_server after it are passed through.
+func validateListen(listen string) error {
+	fields := strings.Fields(listen)
+	if len(fields) == 0 {
+		return nil
+	}
+	if strings.ContainsAny(listen, ";{}") {
+		return fmt.Errorf("invalid listen %q: braces and semicolons are not allowed", listen)
+	}
+
+	addr := fields[0]
+	if path, ok := strings.CutPrefix(addr, "unix:"); ok {
+		if !strings.HasPrefix(path, "/") {
+			return fmt.Errorf("invalid listen %q: unix socket path must be absolute", listen)
+		}
+		return nil
+	}
+
+	host, port := "", addr
+	switch {
+	case strings.HasPrefix(addr, "["):
+		end := strings.Index(addr, "]")
+		if end < 0 {
+			return fmt.Errorf("invalid listen %q: missing \"]\" after IPv6 address", listen)
+		}
+		host, port = addr[1:end], ""
+		if rest := addr[end+1:]; rest != "" {
+			var ok bool
+			if port, ok = strings.CutPrefix(rest, ":"); !ok {
+				return fmt.Errorf("invalid listen %q: expected \":port\" after the IPv6 address", listen)
+			}
+		}
+		if ip := net.ParseIP(host); ip == nil || ip.To4() != nil {
+			return fmt.Errorf("invalid listen %q: %q is not an IPv6 address", listen, host)
+		}
+	case strings.Count(addr, ":") > 1:
+		return fmt.Errorf("invalid listen %q: IPv6 addresses must be bracketed, e.g. [::1]:80", listen)
+	case strings.Contains(addr, ":"):
+		host, port, _ = strings.Cut(addr, ":")
+		if host == "" {
+			return fmt.Errorf("invalid listen %q: missing address before \":\"", listen)
+		}
+	default:
+		if _, err := strconv.Atoi(addr); err != nil {
+			host, port = addr, ""
+		}
+	}
+
+	if port != "" {
+		if n, err := strconv.Atoi(port); err != nil || n < 1 || n > 65535 {
+			return fmt.Errorf("invalid listen %q: port must be a number between 1 and 65535", listen)
+		}
+	}
+	return nil
+}
+
+// validateAccess checks the allow/deny list, basic auth and satisfy settings
+// applied to location /.
+func (c *ServerConfig) validateAccess() error {
+	for _, entry := range c.AllowIPs {
+		if net.ParseIP(entry) != nil {
+			continue
+		}
+		if _, _, err := net.ParseCIDR(entry); err != nil {
+			return fmt.Errorf("invalid allow_ips entry %q: use an IP address or CIDR range such as 10.0.0.0/8", entry)
+		}
+	}
+	for _, entry := range c.Blocklist {
+		if net.ParseIP(entry) != nil {
+			continue
+		}
+		if _, _, err := net.ParseCIDR(entry); err != nil {
+			return fmt.Errorf("invalid blocklist entry %q: use an IP address or CIDR range such as 203.0.113.0/24", entry)
+		}
+	}
+	if (c.AuthBasic == "") != (c.AuthBasicFile == "") {
+		return fmt.Errorf("auth_basic and auth_basic_user_file must be set together")
+	}
+	if c.AuthBasicFile != "" && !strings.HasPrefix(c.AuthBasicFile, "/") {
+		return fmt.Errorf("auth_basic_user_file must be an absolute path, got %q", c.AuthBasicFile)
+	}
+	if strings.ContainsAny(c.AuthBasic, "\"\r\n") {
+		return fmt.Errorf("auth_basic realm must not contain quotes or line breaks")
+	}
+	switch c.Satisfy {
+	case "", "all", "any":
+	default:
+		return fmt.Errorf("satisfy must be all or any, got %q", c.Satisfy)
+	}
+	if c.Satisfy != "" && len(c.AllowIPs) == 0 && !c.DenyAll {
+		return fmt.Errorf("satisfy combines allow_ips or deny_all with auth_basic or auth_request; set allow_ips or deny_all")
+	}
+	if c.Satisfy != "" && c.AuthBasic == "" && c.AuthRequest == "" {
+		return fmt.Errorf("satisfy combines allow_ips or deny_all with auth_basic or auth_request; set one of them")
+	}
+	return nil
+}
+
+// validateErrorPages checks that every key is a space-separated list of
+// status codes nginx accepts in error_page and every page is a URI.
+func validateErrorPages(pages map[string]string) error {
+	seen := make(map[string]bool)
+	for codes, page := range pages {
+		fields := strings.Fields(codes)
+		if len(fields) == 0 {
+			return fmt.Errorf("error_pages keys must list one or more status codes")
+		}
+		for _, field := range fields {
+			code, err := strconv.Atoi(field)
+			if err != nil || code < 300 || code > 599 {
+				return fmt.Errorf("invalid error_pages status code %q: use codes between 300 and 599", field)
+			}
+			if seen[field] {
+				return fmt.Errorf("status code %s appears in more than one error_pages entry", field)
+			}
+			seen[field] = true
+		}
+		if !strings.HasPrefix(page, "/") || strings.ContainsAny(page, " \t;{}") {
+			return fmt.Errorf("error page for %s must be a URI starting with /, got %q", codes, page)
+		}
+	}
+	return nil
+}
+
+func validateLocations(locations []LocationConfig) error {
+	seen := make(map[string]bool)
+	for _, l := range locations {
+		modifier, uri := l.Modifier()
+		switch {
+		case uri == "":
+			return fmt.Errorf("location path must not be empty")
+		case strings.ContainsAny(l.Path, ";{}") || len(strings.Fields(uri)) > 1:
+			return fmt.Errorf("invalid location path %q: expected an optional modifier (=, ^~, ~, ~*) followed by one URI or pattern", l.Path)
+		case modifier == "" && uri == "/":
+			return fmt.Errorf("location / is already generated for the server; use \"= /\" to match the root URI exactly")
+		case l.Root == "" && l.Alias == "" && l.ProxyPass == "" && l.Upstream == "" && l.Return == "" && l.Rewrite == nil:
+			return fmt.Errorf("location %s must set root, alias, proxy_pass, upstream, return or rewrite", l.Path)
+		}
+		if err := l.validateAlias(); err != nil {
+			return err
+		}
+		if l.Rewrite != nil {
+			if err := l.Rewrite.validate(); err != nil {
+				return fmt.Errorf("location %s: %w", l.Path, err)
+			}
+		}
+		key := modifier + " " + uri
+		if modifier == "^~" {
+			key = " " + uri
+		}
+		if seen[key] {
+			return fmt.Errorf("duplicate location %s", l.Path)
+		}
+		seen[key] = true
+	}
+	return nil
+}
+
+// validateAlias checks the alias of a location. A prefix location without a
+// trailing slash must not alias a directory with one: location /img with
+// alias /data/images/ serves /img../secret from /data/images/../secret.
+// An alias in a regex location replaces the whole URI, so it must use the
+// location's captures.
+func (l LocationConfig) validateAlias() error {
+	if l.Alias == "" {
+		return nil
+	}
+	if l.Root != "" {
+		return fmt.Errorf("location %s sets both root and alias; use root to append the URI to a directory, alias to replace the location prefix", l.Path)
+	}
+	if !strings.HasPrefix(l.Alias, "/") || strings.ContainsAny(l.Alias, " \t;{}") {
+		return fmt.Errorf("location %s: alias must be an absolute path without spaces, got %q", l.Path, l.Alias)
+	}
+	modifier, uri := l.Modifier()
+	switch modifier {
+	case "~", "~*":
+		if !strings.Contains(l.Alias, "$") {
+			return fmt.Errorf("location %s: an alias in a regex location replaces the whole URI; capture the part to keep and refer to it, e.g. alias /data/$1", l.Path)
+		}
+	case "", "^~":
+		if !strings.HasSuffix(uri, "/") && strings.HasSuffix(l.Alias, "/") {
+			return fmt.Errorf("location %s: alias %s ends with a slash but the location does not, which lets %s../ escape the directory; use location %s/", l.Path, l.Alias, uri, uri)
+		}
+	}
+	return nil
+}
+
+// ValidateRawDirective checks a raw_directives snippet: it must parse as
+// complete nginx directives and may not open server-level or higher blocks.
+func ValidateRawDirective(raw string) error {
+	root, err := ParseNginx(raw)
+	if err != nil {
+		return fmt.Errorf("invalid raw directive %q: %w", raw, err)
+	}
+	for _, d := range root.Children {
+		switch d.Name {
+		case "http", "server", "events", "stream":
+			return fmt.Errorf("invalid raw directive %q: a %s block cannot be nested in a server block", raw, d.Name)
+		}
+	}
+	return nil
+}
+
+func (r *RewriteRule) validate() error {
+	if r.Match == "" || r.Replacement == "" {
+		return fmt.Errorf("rewrite needs both match and replacement")
+	}
+	if _, err := regexp.Compile(r.Match); err != nil {
+		return fmt.Errorf("invalid rewrite match %q: %w", r.Match, err)
+	}
+	if strings.ContainsAny(r.Replacement, " \t;{}") {
+		return fmt.Errorf("invalid rewrite replacement %q: it may not contain whitespace, braces or semicolons", r.Replacement)
+	}
+	switch r.Flag {
+	case "", "last", "break", "redirect", "permanent":
+	default:
+		return fmt.Errorf("invalid rewrite flag %q: must be last, break, redirect or permanent", r.Flag)
+	}
+	return nil
+}
+
+func validateServerName(name string) error {
+	if strings.ContainsAny(name, " \t\n;{}\"'") {
+		return fmt.Errorf("invalid server name %q: names may not contain whitespace, quotes, braces or semicolons", name)
+	}
+	if pattern, ok := strings.CutPrefix(name, "~"); ok {
+		if pattern == "" {
+			return fmt.Errorf("invalid server name %q: regular expression is empty", name)
+		}
+		if err := compileServerRegex(pattern); err != nil {
+			return fmt.Errorf("invalid server name %q: %w", name, err)
+		}
+		return nil
+	}
+	if trimmed := strings.TrimSuffix(strings.TrimPrefix(name, "*."), ".*"); strings.Contains(trimmed, "*") {
+		return fmt.Errorf("invalid server name %q: a wildcard is only allowed as a leading \"*.\" or a trailing \".*\"", name)
+	}
+	return nil
+}
+
+func LoadDir(dir string, strict bool) ([]*ServerConfig, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read config directory: %w", err)
+	}
+
+	var cfgs []*ServerConfig
+	for _, entry := range entries {
+		if entry.IsDir() || !IsConfigFile(entry.Name()) {
+			continue
+		}
+		cfg, err := Load(filepath.Join(dir, entry.Name()), strict, "")
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", entry.Name(), err)
+		}
+		cfgs = append(cfgs, cfg)
+	}
+
+	if len(cfgs) == 0 {
+		return nil, fmt.Errorf("no config files (%s) found in %s", strings.Join(configExtensions, ", "), dir)
+	}
+
+	return cfgs, nil
+}
+
+// configExtensions lists the file extensions Load understands.
+var configExtensions = []string{".json", ".yaml", ".yml", ".env"}
+
+func IsConfigFile(name string) bool {
+	ext := strings.ToLower(filepath.Ext(name))
+	for _, known := range configExtensions {
+		if ext == known {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,117 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestLoadListen(t *testing.T) {
+	tests := []struct {
+		name    string
+		file    string
+		content string
+		want    string
+		wantErr bool
+	}{
+		{name: "JSON number", file: "site.json", content: `{"server_name": "example.com", "listen": 80}`, want: "80"},
+		{name: "JSON string", file: "site.json", content: `{"server_name": "example.com", "listen": "80"}`, want: "80"},
+		{name: "JSON parameters", file: "site.json", content: `{"server_name": "example.com", "listen": "443 ssl"}`, want: "443 ssl"},
+		{name: "JSON out of range", file: "site.json", content: `{"server_name": "example.com", "listen": 70000}`, wantErr: true},
+		{name: "JSON boolean", file: "site.json", content: `{"server_name": "example.com", "listen": true}`, wantErr: true},
+		{name: "JSON list", file: "site.json", content: `{"server_name": "example.com", "listen": [80]}`, wantErr: true},
+		{name: "JSON semicolon", file: "site.json", content: `{"server_name": "example.com", "listen": "80; return 200"}`, wantErr: true},
+		{name: "YAML number", file: "site.yaml", content: "server_name: example.com\nlisten: 80\n", want: "80"},
+		{name: "YAML string", file: "site.yaml", content: "server_name: example.com\nlisten: \"80\"\n", want: "80"},
+		{name: "YAML parameters", file: "site.yaml", content: "server_name: example.com\nlisten: 443 ssl\n", want: "443 ssl"},
+		{name: "YAML out of range", file: "site.yaml", content: "server_name: example.com\nlisten: 70000\n", wantErr: true},
+		{name: "YAML list", file: "site.yaml", content: "server_name: example.com\nlisten: [80]\n", wantErr: true},
+		{name: "YAML bad port", file: "site.yaml", content: "server_name: example.com\nlisten: \"127.0.0.1:http\"\n", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), tt.file)
+			if err := os.WriteFile(path, []byte(tt.content), 0644); err != nil {
+				t.Fatal(err)
+			}
+			cfg, err := Load(path, false, "")
+			if err == nil {
+				err = cfg.Validate()
+			}
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("want an error, got listen %q", cfg.Listen)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if cfg.Listen != tt.want {
+				t.Errorf("listen = %q, want %q", cfg.Listen, tt.want)
+			}
+		})
+	}
+}
+
+func TestLoadDir(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{
+		"b.yaml":    "server_name: b.example.com\nlisten: 80\n",
+		"a.json":    `{"server_name": "a.example.com", "listen": 80}`,
+		"c.env":     "SERVER_NAME=c.example.com\nLISTEN=80\n",
+		"README.md": "not a config",
+	}
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	cfgs, err := LoadDir(dir, false)
+	if err != nil {
+		t.Fatalf("LoadDir: %v", err)
+	}
+	var names []string
+	for _, cfg := range cfgs {
+		names = append(names, cfg.ServerName)
+	}
+	if got, want := strings.Join(names, " "), "a.example.com b.example.com c.example.com"; got != want {
+		t.Errorf("loaded %q, want %q", got, want)
+	}
+
+	_, err = LoadDir(t.TempDir(), false)
+	if err == nil {
+		t.Fatal("want an error for an empty directory")
+	}
+	for _, ext := range configExtensions {
+		if !strings.Contains(err.Error(), ext) {
+			t.Errorf("error %q does not mention %s", err, ext)
+		}
+	}
+}
+
+func TestMissingPaths(t *testing.T) {
+	dir := t.TempDir()
+	cert := filepath.Join(dir, "fullchain.pem")
+	if err := os.WriteFile(cert, nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	key := filepath.Join(dir, "privkey.pem")
+	cfg := ServerConfig{
+		Root: filepath.Join(dir, "www"),
+		RawDirectives: []string{
+			"ssl_certificate " + cert + ";",
+			"ssl_certificate_key \"" + key + "\";",
+			"ssl_trusted_certificate $ssl_dir/chain.pem;",
+		},
+	}
+	got := cfg.MissingPaths()
+	want := []string{
+		"root " + cfg.Root + " does not exist",
+		"ssl_certificate_key " + key + " does not exist",
+	}
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("MissingPaths() = %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,54 @@
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"gopkg.in/yaml.v2"
+)
+
+var envLinePattern = regexp.MustCompile(`^(export\s+)?[A-Za-z_][A-Za-z0-9_]*=`)
+
+// detectFormat tells the format of a config from its contents: a JSON
+// object, a YAML mapping, or KEY=value lines, tried in that order.
+func detectFormat(data []byte) (string, error) {
+	trimmed := bytes.TrimSpace(data)
+	if bytes.HasPrefix(trimmed, []byte("{")) && json.Valid(trimmed) {
+		return "json", nil
+	}
+
+	var mapping map[string]interface{}
+	if err := yaml.Unmarshal(data, &mapping); err == nil && len(mapping) > 0 {
+		return "yaml", nil
+	}
+
+	env := false
+	for _, line := range strings.Split(string(data), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		if !envLinePattern.MatchString(line) {
+			env = false
+			break
+		}
+		env = true
+	}
+	if env {
+		return "env", nil
+	}
+	return "", fmt.Errorf("cannot tell the config format from its contents: it is neither a JSON object, a YAML mapping nor KEY=value lines")
+}
+
+// IsConfigFormat reports whether format is accepted by Load: "json",
+// "yaml", "env", "auto" or "" for the file extension.
+func IsConfigFormat(format string) bool {
+	switch format {
+	case "", "auto", "json", "yaml", "env":
+		return true
+	}
+	return false
+}
@@ -0,0 +1,108 @@
+package config
+
+import (
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// parseEnv reads KEY=value lines into cfg. Keys are the upper-cased JSON
+// field names, so SERVER_NAME sets server_name and PROXY_PORT sets
+// proxy_port. Lists are separated by commas or spaces. Unknown keys are
+// skipped and returned with their line numbers.
+func parseEnv(data []byte, cfg *ServerConfig) ([]string, error) {
+	fields := envFields(cfg)
+
+	var unknown []string
+	for i, line := range strings.Split(string(data), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		line = strings.TrimSpace(strings.TrimPrefix(line, "export "))
+
+		key, value, ok := strings.Cut(line, "=")
+		if !ok {
+			return nil, fmt.Errorf("line %d: expected KEY=value", i+1)
+		}
+		key = strings.ToUpper(strings.TrimSpace(key))
+		value = unquoteEnv(strings.TrimSpace(value))
+
+		field, ok := fields[key]
+		if !ok {
+			unknown = append(unknown, fmt.Sprintf("%s (line %d)", key, i+1))
+			continue
+		}
+		if err := setEnvField(field, value); err != nil {
+			return nil, fmt.Errorf("line %d: %s: %w", i+1, key, err)
+		}
+	}
+	return unknown, nil
+}
+
+func envFields(cfg *ServerConfig) map[string]reflect.Value {
+	fields := make(map[string]reflect.Value)
+	v := reflect.ValueOf(cfg).Elem()
+	for i := 0; i < v.NumField(); i++ {
+		name, _, _ := strings.Cut(v.Type().Field(i).Tag.Get("json"), ",")
+		if name == "" || name == "-" || !isEnvField(v.Field(i)) {
+			continue
+		}
+		fields[strings.ToUpper(name)] = v.Field(i)
+	}
+	return fields
+}
+
+// isEnvField reports whether field can be written as a single env value.
+// Maps and lists of structs need JSON or YAML.
+func isEnvField(field reflect.Value) bool {
+	switch field.Kind() {
+	case reflect.String, reflect.Bool, reflect.Int:
+		return true
+	case reflect.Slice:
+		return field.Type().Elem().Kind() == reflect.String
+	}
+	return false
+}
+
+func setEnvField(field reflect.Value, value string) error {
+	switch field.Kind() {
+	case reflect.String:
+		field.SetString(value)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(value)
+		if err != nil {
+			return fmt.Errorf("expected true or false, got %q", value)
+		}
+		field.SetBool(b)
+	case reflect.Int:
+		n, err := strconv.Atoi(value)
+		if err != nil {
+			return fmt.Errorf("expected a number, got %q", value)
+		}
+		field.SetInt(int64(n))
+	case reflect.Slice:
+		items := strings.FieldsFunc(value, func(r rune) bool {
+			return r == ',' || r == ' ' || r == '\t'
+		})
+		list := reflect.MakeSlice(field.Type(), len(items), len(items))
+		for i, item := range items {
+			list.Index(i).SetString(item)
+		}
+		field.Set(list)
+	}
+	return nil
+}
+
+func unquoteEnv(value string) string {
+	if len(value) >= 2 {
+		if (value[0] == '"' || value[0] == '\'') && value[len(value)-1] == value[0] {
+			return value[1 : len(value)-1]
+		}
+	}
+	if i := strings.Index(value, " #"); i >= 0 {
+		return strings.TrimSpace(value[:i])
+	}
+	return value
+}
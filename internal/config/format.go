@@ -0,0 +1,86 @@
+package config
+
+import "strings"
+
+// FormatNginx writes the tree returned by ParseNginx back out as nginx
+// syntax, with children indented four spaces per level and a blank line
+// around blocks. Directive order and comments are kept, trailing comments
+// stay on their line, and arguments are quoted only where nginx needs it.
+func FormatNginx(root *Directive) string {
+	return FormatNginxIndent(root, "    ")
+}
+
+// FormatNginxIndent is FormatNginx with unit as one level of indentation.
+func FormatNginxIndent(root *Directive, unit string) string {
+	var lines []string
+	formatDirectives(&lines, root.Children, 0, unit)
+	if len(lines) == 0 {
+		return ""
+	}
+	return strings.Join(lines, "\n") + "\n"
+}
+
+func formatDirectives(lines *[]string, directives []*Directive, depth int, unit string) {
+	indent := strings.Repeat(unit, depth)
+	var prev *Directive
+	for _, d := range directives {
+		if d.IsComment() && d.Inline && len(*lines) > 0 {
+			(*lines)[len(*lines)-1] += " #" + d.Args[0]
+			continue
+		}
+		if prev != nil && needsBlankLine(prev, d) {
+			*lines = append(*lines, "")
+		}
+		prev = d
+
+		if d.IsComment() {
+			*lines = append(*lines, indent+"#"+d.Args[0])
+			continue
+		}
+
+		line := indent + quoteNginxArg(d.Name)
+		for _, arg := range d.Args {
+			line += " " + quoteNginxArg(arg)
+		}
+		if !d.IsBlock() {
+			*lines = append(*lines, line+";")
+			continue
+		}
+		*lines = append(*lines, line+" {")
+		formatDirectives(lines, d.Children, depth+1, unit)
+		*lines = append(*lines, indent+"}")
+	}
+}
+
+// needsBlankLine reports whether a blank line separates next from prev.
+// Blocks are set apart from their neighbours, but a comment directly above
+// something stays attached to it.
+func needsBlankLine(prev, next *Directive) bool {
+	if prev.IsComment() {
+		return false
+	}
+	return prev.IsBlock() || next.IsBlock() || next.IsComment()
+}
+
+func quoteNginxArg(arg string) string {
+	if arg != "" && !strings.ContainsAny(arg, " \t\r\n;{}#'\"") {
+		return arg
+	}
+
+	// Backslashes are doubled only where nginx would otherwise read them as
+	// an escape, so regexes such as "\d{2}" come out as written.
+	var b strings.Builder
+	b.WriteByte('"')
+	for i := 0; i < len(arg); i++ {
+		switch {
+		case arg[i] == '"':
+			b.WriteString(`\"`)
+		case arg[i] == '\\' && (i+1 == len(arg) || arg[i+1] == '"' || arg[i+1] == '\\'):
+			b.WriteString(`\\`)
+		default:
+			b.WriteByte(arg[i])
+		}
+	}
+	b.WriteByte('"')
+	return b.String()
+}
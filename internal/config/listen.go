@@ -0,0 +1,138 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// ListenSpec is one listen directive. In JSON and YAML it may be written as
+// a plain listen value such as "443 ssl" or as an object.
+type ListenSpec struct {
+	Address       string `json:"address" yaml:"address"`
+	SSL           bool   `json:"ssl" yaml:"ssl"`
+	HTTP2         bool   `json:"http2" yaml:"http2"`
+	DefaultServer bool   `json:"default_server" yaml:"default_server"`
+	ReusePort     bool   `json:"reuseport" yaml:"reuseport"`
+	Backlog       int    `json:"backlog" yaml:"backlog"`
+}
+
+func (l *ListenSpec) UnmarshalJSON(data []byte) error {
+	var value string
+	if err := json.Unmarshal(data, &value); err == nil {
+		*l = ListenSpec{Address: value}
+		return nil
+	}
+	var port json.Number
+	if err := json.Unmarshal(data, &port); err == nil {
+		*l = ListenSpec{Address: port.String()}
+		return nil
+	}
+	data, err := quoteNumbers(data, "address")
+	if err != nil {
+		return err
+	}
+	type plain ListenSpec
+	var spec plain
+	if err := json.Unmarshal(data, &spec); err != nil {
+		return fmt.Errorf("listens entries must be a listen value or an object with an address")
+	}
+	*l = ListenSpec(spec)
+	return nil
+}
+
+func (l *ListenSpec) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	var value string
+	if err := unmarshal(&value); err == nil {
+		*l = ListenSpec{Address: value}
+		return nil
+	}
+	type plain ListenSpec
+	var spec plain
+	if err := unmarshal(&spec); err != nil {
+		return fmt.Errorf("listens entries must be a listen value or an object with an address")
+	}
+	*l = ListenSpec(spec)
+	return nil
+}
+
+// String renders the spec as the arguments of a listen directive. Options
+// already present in Address are not repeated.
+func (l ListenSpec) String() string {
+	fields := strings.Fields(l.Address)
+	for _, option := range []struct {
+		name string
+		set  bool
+	}{
+		{"ssl", l.SSL},
+		{"http2", l.HTTP2},
+		{"default_server", l.DefaultServer},
+		{"reuseport", l.ReusePort},
+	} {
+		if option.set && !containsField(fields[1:], option.name) {
+			fields = append(fields, option.name)
+		}
+	}
+	if l.Backlog > 0 && !hasFieldPrefix(fields[1:], "backlog=") {
+		fields = append(fields, fmt.Sprintf("backlog=%d", l.Backlog))
+	}
+	return strings.Join(fields, " ")
+}
+
+// ListenValues returns the argument of every listen directive for the
+// server: one per Listens entry, or one per comma-separated value of Listen,
+// so "80, 8080" listens on both ports.
+func (c *ServerConfig) ListenValues() []string {
+	if len(c.Listens) == 0 {
+		var values []string
+		for _, value := range strings.Split(c.Listen, ",") {
+			if value = strings.TrimSpace(value); value != "" {
+				values = append(values, value)
+			}
+		}
+		if len(values) == 0 {
+			return []string{c.Listen}
+		}
+		return values
+	}
+	values := make([]string, 0, len(c.Listens))
+	for _, spec := range c.Listens {
+		values = append(values, spec.String())
+	}
+	return values
+}
+
+func containsField(fields []string, name string) bool {
+	for _, field := range fields {
+		if field == name {
+			return true
+		}
+	}
+	return false
+}
+
+func hasFieldPrefix(fields []string, prefix string) bool {
+	for _, field := range fields {
+		if strings.HasPrefix(field, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// validateReusePort checks that reuseport is set at most once per address,
+// as nginx requires.
+func validateReusePort(listens []string) error {
+	seen := make(map[string]bool)
+	for _, listen := range listens {
+		fields := strings.Fields(listen)
+		if len(fields) == 0 || !containsField(fields[1:], "reuseport") {
+			continue
+		}
+		if seen[fields[0]] {
+			return fmt.Errorf("reuseport is set on more than one listen for %s; nginx allows it once per address and port", fields[0])
+		}
+		seen[fields[0]] = true
+	}
+	return nil
+}
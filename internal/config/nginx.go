@@ -0,0 +1,182 @@
+package config
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Directive is one directive of an nginx configuration. Offsets index into
+// the parsed text: Start is the first byte of the name and End is just past
+// the closing ";" or "}". For blocks, BodyStart and BodyEnd delimit the text
+// between the braces; for simple directives both are -1.
+type Directive struct {
+	Name      string
+	Args      []string
+	Line      int
+	Start     int
+	End       int
+	BodyStart int
+	BodyEnd   int
+	Children  []*Directive
+	// Inline is set on comments that follow other text on the same line.
+	Inline bool
+}
+
+func (d *Directive) IsBlock() bool {
+	return d.BodyStart >= 0
+}
+
+// IsComment reports whether d is a comment. Comments are kept in the tree,
+// with Name "#" and the text after the "#" as the only argument, so the
+// tree can be written back without losing them.
+func (d *Directive) IsComment() bool {
+	return d.Name == "#"
+}
+
+// Find returns the direct children of d called name.
+func (d *Directive) Find(name string) []*Directive {
+	var found []*Directive
+	for _, child := range d.Children {
+		if child.Name == name {
+			found = append(found, child)
+		}
+	}
+	return found
+}
+
+// ParseNginx parses content into a tree of directives. The returned root
+// stands for the whole file and holds the top-level directives as Children.
+// Comments are kept as comment directives, quoted arguments are unquoted and
+// braces must nest.
+func ParseNginx(content string) (*Directive, error) {
+	root := &Directive{BodyStart: 0, BodyEnd: len(content), End: len(content)}
+	stack := []*Directive{root}
+	var words []string
+	wordStart := -1
+
+	for i := 0; i < len(content); {
+		c := content[i]
+		switch {
+		case c == ' ' || c == '\t' || c == '\r' || c == '\n':
+			i++
+		case c == '#':
+			start := i
+			for i < len(content) && content[i] != '\n' {
+				i++
+			}
+			lineStart := strings.LastIndex(content[:start], "\n") + 1
+			parent := stack[len(stack)-1]
+			parent.Children = append(parent.Children, &Directive{
+				Name:      "#",
+				Args:      []string{strings.TrimRight(content[start+1:i], " \t\r")},
+				Line:      lineOf(content, start),
+				Start:     start,
+				End:       i,
+				BodyStart: -1,
+				BodyEnd:   -1,
+				Inline:    strings.TrimSpace(content[lineStart:start]) != "",
+			})
+		case c == ';':
+			if len(words) == 0 {
+				return nil, fmt.Errorf("unexpected \";\" on line %d", lineOf(content, i))
+			}
+			parent := stack[len(stack)-1]
+			parent.Children = append(parent.Children, &Directive{
+				Name:      words[0],
+				Args:      words[1:],
+				Line:      lineOf(content, wordStart),
+				Start:     wordStart,
+				End:       i + 1,
+				BodyStart: -1,
+				BodyEnd:   -1,
+			})
+			words = nil
+			i++
+		case c == '{':
+			if len(words) == 0 {
+				return nil, fmt.Errorf("unexpected \"{\" on line %d", lineOf(content, i))
+			}
+			block := &Directive{
+				Name:      words[0],
+				Args:      words[1:],
+				Line:      lineOf(content, wordStart),
+				Start:     wordStart,
+				BodyStart: i + 1,
+			}
+			parent := stack[len(stack)-1]
+			parent.Children = append(parent.Children, block)
+			stack = append(stack, block)
+			words = nil
+			i++
+		case c == '}':
+			if len(words) > 0 {
+				return nil, fmt.Errorf("directive %q is not terminated by \";\" on line %d", words[0], lineOf(content, wordStart))
+			}
+			if len(stack) == 1 {
+				return nil, fmt.Errorf("unexpected \"}\" on line %d", lineOf(content, i))
+			}
+			block := stack[len(stack)-1]
+			block.BodyEnd = i
+			block.End = i + 1
+			stack = stack[:len(stack)-1]
+			i++
+		default:
+			if len(words) == 0 {
+				wordStart = i
+			}
+			word, next, err := readWord(content, i)
+			if err != nil {
+				return nil, fmt.Errorf("%v on line %d", err, lineOf(content, i))
+			}
+			words = append(words, word)
+			i = next
+		}
+	}
+
+	if len(words) > 0 {
+		return nil, fmt.Errorf("unexpected end of file, expecting \";\" after %q", words[0])
+	}
+	if len(stack) > 1 {
+		return nil, fmt.Errorf("unexpected end of file, expecting \"}\" for %q block opened on line %d", stack[len(stack)-1].Name, stack[len(stack)-1].Line)
+	}
+
+	return root, nil
+}
+
+func readWord(content string, i int) (string, int, error) {
+	if quote := content[i]; quote == '"' || quote == '\'' {
+		var word strings.Builder
+		for j := i + 1; j < len(content); j++ {
+			switch content[j] {
+			case '\\':
+				// Like nginx, only quotes and backslashes are unescaped.
+				if j+1 < len(content) {
+					j++
+					if next := content[j]; next != quote && next != '\\' {
+						word.WriteByte('\\')
+					}
+					word.WriteByte(content[j])
+				}
+			case quote:
+				return word.String(), j + 1, nil
+			default:
+				word.WriteByte(content[j])
+			}
+		}
+		return "", 0, fmt.Errorf("unterminated quoted string")
+	}
+
+	j := i
+	for j < len(content) {
+		switch content[j] {
+		case ' ', '\t', '\r', '\n', ';', '{', '}':
+			return content[i:j], j, nil
+		}
+		j++
+	}
+	return content[i:j], j, nil
+}
+
+func lineOf(content string, offset int) int {
+	return strings.Count(content[:offset], "\n") + 1
+}
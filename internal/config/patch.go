@@ -0,0 +1,49 @@
+package config
+
+import "reflect"
+
+// exclusiveFields are groups of fields that set the same thing in different
+// ways. Setting one of them in a patch clears the others.
+var exclusiveFields = [][]string{
+	{"Listen", "Listens"},
+	{"ServerName", "ServerNames", "ServerNamesFile"},
+	{"ProxyPass", "ProxyPort", "ProxySocket", "GRPCPass", "Upstreams", "RedirectTo"},
+}
+
+// LoadPatch reads a configuration like Load, but without filling in
+// defaults such as listen 80, so only the fields the file sets are non-empty.
+func LoadPatch(path string, strict bool, format string) (*ServerConfig, error) {
+	return load(path, strict, format)
+}
+
+// Merge copies the fields patch sets over c. A field counts as set when it
+// is not empty, so a patch cannot turn a boolean option off or clear a
+// value. Lists and maps replace those of c rather than being appended to.
+func (c *ServerConfig) Merge(patch *ServerConfig) {
+	dst := reflect.ValueOf(c).Elem()
+	src := reflect.ValueOf(patch).Elem()
+	for _, group := range exclusiveFields {
+		for _, name := range group {
+			if src.FieldByName(name).IsZero() {
+				continue
+			}
+			for _, other := range group {
+				if other != name && src.FieldByName(other).IsZero() {
+					dst.FieldByName(other).SetZero()
+				}
+			}
+		}
+	}
+
+	for i := 0; i < src.NumField(); i++ {
+		switch src.Type().Field(i).Name {
+		case "Source", "Warnings":
+			continue
+		}
+		if field := src.Field(i); !field.IsZero() {
+			dst.Field(i).Set(field)
+		}
+	}
+	c.Source = patch.Source
+	c.Warnings = append(c.Warnings, patch.Warnings...)
+}
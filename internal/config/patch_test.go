@@ -0,0 +1,142 @@
+package config
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestMerge(t *testing.T) {
+	base := func() *ServerConfig {
+		return &ServerConfig{
+			Listen:     "80",
+			ServerName: "example.com",
+			ProxyPort:  "3000",
+			Gzip:       true,
+			Headers:    map[string]string{"X-Frame-Options": "DENY"},
+			Blocklist:  []string{"10.0.0.1"},
+			Source:     "site.yaml",
+		}
+	}
+	tests := []struct {
+		name  string
+		patch ServerConfig
+		want  func(*ServerConfig)
+	}{
+		{name: "empty patch", want: func(c *ServerConfig) { c.Source = "" }},
+		{
+			name:  "scalar fields",
+			patch: ServerConfig{ProxyPort: "4000", Source: "patch.yaml"},
+			want:  func(c *ServerConfig) { c.ProxyPort = "4000"; c.Source = "patch.yaml" },
+		},
+		{
+			name:  "lists and maps are replaced",
+			patch: ServerConfig{Headers: map[string]string{"X-Robots-Tag": "none"}, Blocklist: []string{"10.0.0.2"}},
+			want: func(c *ServerConfig) {
+				c.Headers = map[string]string{"X-Robots-Tag": "none"}
+				c.Blocklist = []string{"10.0.0.2"}
+				c.Source = ""
+			},
+		},
+		{
+			name:  "exclusive fields clear each other",
+			patch: ServerConfig{ProxySocket: "/run/app.sock", ServerNames: NameList{"a.example.com", "b.example.com"}, Listens: []ListenSpec{{Address: "8080"}}},
+			want: func(c *ServerConfig) {
+				c.ProxyPort = ""
+				c.ProxySocket = "/run/app.sock"
+				c.ServerName = ""
+				c.ServerNames = NameList{"a.example.com", "b.example.com"}
+				c.Listen = ""
+				c.Listens = []ListenSpec{{Address: "8080"}}
+				c.Source = ""
+			},
+		},
+		{
+			name:  "booleans are not turned off",
+			patch: ServerConfig{Gzip: false, StaticCache: true},
+			want:  func(c *ServerConfig) { c.StaticCache = true; c.Source = "" },
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := base()
+			got.Merge(&tt.patch)
+			want := base()
+			tt.want(want)
+			if !reflect.DeepEqual(got, want) {
+				t.Errorf("Merge() = %+v\nwant %+v", got, want)
+			}
+		})
+	}
+}
+
+func TestParseServerBlock(t *testing.T) {
+	tests := []struct {
+		name     string
+		block    string
+		want     ServerConfig
+		warnings []string
+		wantErr  bool
+	}{
+		{
+			name: "static",
+			block: `server {
+    listen 80;
+    server_name example.com www.example.com;
+    root /srv/www;
+}`,
+			want: ServerConfig{Listen: "80", ServerNames: NameList{"example.com", "www.example.com"}, Root: "/srv/www"},
+		},
+		{
+			name: "without server braces",
+			block: `listen 8080;
+server_name example.com;
+root /srv/www;`,
+			want: ServerConfig{Listen: "8080", ServerNames: NameList{"example.com"}, Root: "/srv/www"},
+		},
+		{
+			name: "unknown directive",
+			block: `server {
+    listen 80;
+    server_name example.com;
+    root /srv/www;
+    ssl_stapling on;
+}`,
+			want:     ServerConfig{Listen: "80", ServerNames: NameList{"example.com"}, Root: "/srv/www"},
+			warnings: []string{"ssl_stapling"},
+		},
+		{
+			name:     "servers are dropped",
+			block:    "server { listen 80; }\nserver { listen 81; }",
+			want:     ServerConfig{Listen: "80"},
+			warnings: []string{"dropping server", "dropping server"},
+		},
+		{name: "malformed", block: "server { listen 80;", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg, err := ParseServerBlock(tt.block)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("want an error, got %+v", cfg)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ParseServerBlock: %v", err)
+			}
+			if len(cfg.Warnings) != len(tt.warnings) {
+				t.Errorf("warnings = %q, want %d mentioning %q", cfg.Warnings, len(tt.warnings), tt.warnings)
+			}
+			for i, warning := range tt.warnings {
+				if i < len(cfg.Warnings) && !strings.Contains(cfg.Warnings[i], warning) {
+					t.Errorf("warning %q does not mention %s", cfg.Warnings[i], warning)
+				}
+			}
+			cfg.Warnings = nil
+			if !reflect.DeepEqual(*cfg, tt.want) {
+				t.Errorf("ParseServerBlock() = %+v\nwant %+v", *cfg, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,53 @@
+package config
+
+import (
+	"fmt"
+	"net/url"
+	"sort"
+	"strings"
+)
+
+// routeLocations expands Routes into one proxy location per path prefix.
+// Prefixes are given a trailing slash, so /api covers /api/... but not
+// /apidocs; nginx answers /api itself with a redirect to /api/. A target
+// with a path, even just "/", replaces the prefix with it; a bare host and
+// port receives the full URI, prefix included.
+func (c *ServerConfig) routeLocations() []LocationConfig {
+	prefixes := make([]string, 0, len(c.Routes))
+	for prefix := range c.Routes {
+		prefixes = append(prefixes, prefix)
+	}
+	sort.Strings(prefixes)
+
+	locations := make([]LocationConfig, 0, len(prefixes))
+	for _, prefix := range prefixes {
+		target := c.Routes[prefix]
+		if !strings.HasSuffix(prefix, "/") {
+			prefix += "/"
+		}
+		if u, err := url.Parse(target); err == nil && u.Path != "" && !strings.HasSuffix(target, "/") {
+			target += "/"
+		}
+		locations = append(locations, LocationConfig{Path: prefix, ProxyPass: target})
+	}
+	return locations
+}
+
+func validateRoutes(routes map[string]string) error {
+	for prefix, target := range routes {
+		if !strings.HasPrefix(prefix, "/") || strings.ContainsAny(prefix, " \t;{}$") {
+			return fmt.Errorf("invalid route %q: use a URI prefix such as /service-a/", prefix)
+		}
+		if strings.Trim(prefix, "/") == "" {
+			return fmt.Errorf("route %q would replace location /; set proxy_pass or proxy_port for it instead", prefix)
+		}
+		u, err := url.Parse(target)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" || strings.ContainsAny(target, " \t;{}$") {
+			return fmt.Errorf("invalid target %q for route %s: use an http:// or https:// URL without variables", target, prefix)
+		}
+		if u.RawQuery != "" || u.Fragment != "" {
+			return fmt.Errorf("invalid target %q for route %s: proxy_pass cannot carry a query or fragment", target, prefix)
+		}
+	}
+	return nil
+}
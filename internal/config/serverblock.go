@@ -0,0 +1,767 @@
+package config
+
+import (
+	"fmt"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// cacheLocationPattern matches the asset location of static_cache, such as
+// ~* \.(css|js|png)$.
+var cacheLocationPattern = regexp.MustCompile(`^\\\.\(([A-Za-z0-9|]+)\)\$$`)
+
+// ParseServerBlock reads a server block back into a configuration, the
+// reverse of what the built-in templates generate. It understands the
+// directives the templates write; anything else, such as ssl_certificate,
+// is left out and reported in Warnings, so writing the result back loses
+// it. The block may also be written without the surrounding server { }.
+// Like a generated block, it may be preceded by the http-level blocks the
+// server uses, such as its upstream and limit_conn_zone, which are read
+// back too; see parseDefinitions.
+func ParseServerBlock(block string) (*ServerConfig, error) {
+	root, err := ParseNginx(block)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse server block: %w", err)
+	}
+	server := root
+	var definitions []*Directive
+	if servers := root.Find("server"); len(servers) == 1 {
+		server = servers[0]
+		for _, d := range root.Children {
+			if d != server && !d.IsComment() {
+				definitions = append(definitions, d)
+			}
+		}
+	}
+
+	cfg := &ServerConfig{}
+	var listens []ListenSpec
+	var rootHeaders map[string]string
+	blocked := ""
+	http2 := false
+	for _, d := range server.Children {
+		switch d.Name {
+		case "#":
+		case "listen":
+			listens = append(listens, ListenSpec{Address: strings.Join(d.Args, " ")})
+		case "http2":
+			http2 = len(d.Args) == 1 && d.Args[0] == "on"
+		case "server_name":
+			cfg.ServerNames = append(cfg.ServerNames, d.Args...)
+		case "location":
+			if headers := cfg.parseLocation(d); headers != nil {
+				rootHeaders = headers
+			}
+		case "return":
+			cfg.parseRedirect(d)
+		case "error_page":
+			if len(d.Args) >= 2 {
+				if d.Args[0] == "503" && len(d.Args) == 2 {
+					cfg.MaintenancePage = d.Args[1]
+					continue
+				}
+				if cfg.ErrorPages == nil {
+					cfg.ErrorPages = make(map[string]string)
+				}
+				cfg.ErrorPages[strings.Join(d.Args[:len(d.Args)-1], " ")] = d.Args[len(d.Args)-1]
+			}
+		case "if":
+			if len(d.Args) == 2 && d.Args[0] == "(-f" && len(d.Children) == 1 && d.Children[0].Name == "return" {
+				cfg.Maintenance = true
+				cfg.MaintenanceFlag = strings.TrimSuffix(d.Args[1], ")")
+			} else if len(d.Args) == 1 && strings.HasPrefix(d.Args[0], "($") && strings.HasSuffix(d.Args[0], "_blocked)") && isReturn403(d) {
+				blocked = strings.Trim(d.Args[0], "()")
+			} else {
+				cfg.skip(d)
+			}
+		case "access_log":
+			cfg.parseAccessLog(d)
+		default:
+			if !cfg.parseCommon(d) {
+				cfg.skip(d)
+			}
+		}
+	}
+
+	// "http2 on;" is kept as the listen parameter, which generating the
+	// block turns back into the directive where nginx supports it.
+	for i, listen := range listens {
+		if fields := strings.Fields(listen.Address); http2 && len(fields) > 0 && !containsField(fields[1:], "http2") {
+			listens[i].Address += " http2"
+		}
+	}
+	switch {
+	case len(listens) == 1:
+		cfg.Listen = listens[0].Address
+	case len(listens) > 1:
+		cfg.Listens = listens
+	default:
+		cfg.Listen = "80"
+	}
+	if cfg.Maintenance && cfg.MaintenancePage == "" {
+		cfg.Maintenance = false
+	}
+	cfg.parseHeaders()
+	if err := cfg.parseDefinitions(definitions, blocked); err != nil {
+		return nil, err
+	}
+	if err := cfg.parseProxyHeaders(rootHeaders); err != nil {
+		return nil, err
+	}
+	return cfg, nil
+}
+
+func isReturn403(d *Directive) bool {
+	return len(d.Children) == 1 && d.Children[0].Name == "return" && len(d.Children[0].Args) == 1 && d.Children[0].Args[0] == "403"
+}
+
+// parseAccessLog reads access_log <path> [format] [buffer=] [flush=].
+func (c *ServerConfig) parseAccessLog(d *Directive) {
+	if len(d.Args) == 0 {
+		c.skip(d)
+		return
+	}
+	log := &AccessLogConfig{Path: d.Args[0]}
+	for i, arg := range d.Args[1:] {
+		switch key, value, _ := strings.Cut(arg, "="); {
+		case key == "buffer":
+			log.Buffer = value
+		case key == "flush":
+			log.Flush = value
+		case i == 0 && !strings.Contains(arg, "="):
+			log.FormatName = arg
+		default:
+			c.skip(d)
+			return
+		}
+	}
+	c.AccessLog = log
+}
+
+// parseProxyHeaders turns the default proxy headers and directives missing
+// from location / into disable_headers. headers maps those that are there
+// to their value. Behind a keepalive upstream the templates send
+// Connection "" and no Upgrade header, so neither counts as disabled then;
+// a block that sends Connection "" without a keepalive upstream that was
+// read back cannot be regenerated as it is.
+func (c *ServerConfig) parseProxyHeaders(headers map[string]string) error {
+	if c.ProxyPass == "" {
+		return nil
+	}
+	if value, ok := headers["Connection"]; ok && value == "" && c.Keepalive == 0 {
+		return fmt.Errorf("location / keeps upstream connections alive (proxy_set_header Connection \"\"), but no upstream block with keepalive for %s was found in the http block; edit this block with a full config instead of a patch", c.ProxyPass)
+	}
+	for _, name := range defaultProxyDirectives {
+		if _, ok := headers[name]; ok || name == "Upgrade" && c.Keepalive > 0 {
+			continue
+		}
+		c.DisableHeaders = append(c.DisableHeaders, name)
+	}
+	return nil
+}
+
+// parseCommon handles the directives that may appear both at server level
+// and in location /. It reports whether d was understood.
+func (c *ServerConfig) parseCommon(d *Directive) bool {
+	arg := ""
+	if len(d.Args) > 0 {
+		arg = d.Args[0]
+	}
+	switch d.Name {
+	case "root":
+		c.Root = arg
+	case "index":
+		c.Index = strings.Join(d.Args, " ")
+	case "add_header":
+		if len(d.Args) >= 2 {
+			if c.Headers == nil {
+				c.Headers = make(map[string]string)
+			}
+			c.Headers[d.Args[0]] = d.Args[1]
+		}
+	case "gzip":
+		c.Gzip = arg == "on"
+	case "brotli":
+		c.Brotli = arg == "on"
+	case "brotli_comp_level":
+		c.BrotliLevel, _ = strconv.Atoi(arg)
+	case "gzip_types", "brotli_types":
+		types := d.Args
+		if len(types) > 0 && types[0] != "text/html" {
+			c.CompressTypes = types
+		}
+	case "gzip_vary", "proxy_buffers":
+	case "proxy_buffer_size":
+		c.ProxyBufferSize = arg
+	case "satisfy":
+		c.Satisfy = arg
+	case "allow":
+		c.AllowIPs = append(c.AllowIPs, arg)
+	case "deny":
+		if arg != "all" {
+			return false
+		}
+		c.DenyAll = true
+	case "auth_basic":
+		c.AuthBasic = arg
+	case "auth_basic_user_file":
+		c.AuthBasicFile = arg
+	case "limit_conn":
+		if len(d.Args) != 2 {
+			return false
+		}
+		c.LimitConnZone = arg
+		c.LimitConn, _ = strconv.Atoi(d.Args[1])
+	default:
+		return false
+	}
+	return true
+}
+
+// parseLocation reads location / as the main target of the server and the
+// locations the templates add for options, and keeps other locations as
+// extra locations. For location / it returns the proxy headers and
+// directives it found there, as parseRootLocation does.
+func (c *ServerConfig) parseLocation(d *Directive) map[string]string {
+	path := strings.Join(d.Args, " ")
+	switch {
+	case path == "/":
+		return c.parseRootLocation(d)
+	case path == `~ /\.` || path == `~ /\.(?!well-known/)`:
+		c.DenyDotfiles = true
+		return nil
+	case path == "^~ /.well-known/acme-challenge/":
+		c.ACMEChallenge = true
+		for _, root := range d.Find("root") {
+			if len(root.Args) > 0 && root.Args[0] != "/var/www/certbot" {
+				c.ACMEWebroot = root.Args[0]
+			}
+		}
+		return nil
+	case len(d.Args) == 2 && d.Args[0] == "~*" && cacheLocationPattern.MatchString(d.Args[1]):
+		c.StaticCache = true
+		c.CacheExtensions = strings.Split(cacheLocationPattern.FindStringSubmatch(d.Args[1])[1], "|")
+		for _, expires := range d.Find("expires") {
+			if len(expires.Args) > 0 {
+				c.CacheExpires = expires.Args[0]
+			}
+		}
+		return nil
+	case len(d.Args) == 1 && len(d.Find("dav_methods")) > 0:
+		c.parseWebDAV(d)
+		return nil
+	case len(d.Args) == 2 && d.Args[0] == "=" && len(d.Find("internal")) > 0:
+		// Error and maintenance pages declared through error_page.
+		for _, root := range d.Find("root") {
+			if len(root.Args) == 0 {
+				continue
+			}
+			if d.Args[1] == c.MaintenancePage {
+				c.MaintenanceRoot = root.Args[0]
+			} else {
+				c.ErrorRoot = root.Args[0]
+			}
+		}
+		if len(d.Find("proxy_pass")) > 0 {
+			c.AuthRequest = d.Args[1]
+			c.AuthService = d.Find("proxy_pass")[0].Args[0]
+		}
+		return nil
+	}
+
+	location := LocationConfig{Path: path}
+	for _, child := range d.Children {
+		arg := ""
+		if len(child.Args) > 0 {
+			arg = child.Args[0]
+		}
+		switch child.Name {
+		case "root":
+			location.Root = arg
+		case "alias":
+			location.Alias = arg
+		case "proxy_pass":
+			location.ProxyPass = arg
+		case "return":
+			location.Return = strings.Join(child.Args, " ")
+		case "rewrite":
+			if len(child.Args) >= 2 {
+				location.Rewrite = &RewriteRule{Match: child.Args[0], Replacement: child.Args[1]}
+				if len(child.Args) > 2 {
+					location.Rewrite.Flag = child.Args[2]
+				}
+			}
+		case "#", "proxy_set_header", "limit_conn":
+		default:
+			c.skip(child)
+		}
+	}
+	c.Locations = append(c.Locations, location)
+	return nil
+}
+
+// parseRootLocation reads location /, which holds the proxy or gRPC target,
+// the redirect of a redirect server with extra locations, or try_files. It
+// returns the default proxy headers and directives it found, each with its
+// value, for parseProxyHeaders.
+func (c *ServerConfig) parseRootLocation(d *Directive) map[string]string {
+	var backend string
+	seen := make(map[string]string)
+	for _, child := range d.Children {
+		arg := ""
+		if len(child.Args) > 0 {
+			arg = child.Args[0]
+		}
+		switch child.Name {
+		case "#", "try_files", "proxy_http_version", "proxy_cache_bypass", "proxy_redirect", "proxy_ssl_server_name", "internal":
+			seen[child.Name] = strings.Join(child.Args, " ")
+		case "proxy_set_header":
+			value := strings.Join(child.Args[min(1, len(child.Args)):], " ")
+			switch {
+			case len(child.Args) == 2 && strings.HasPrefix(child.Args[1], "$auth_"):
+				c.AuthHeaders = append(c.AuthHeaders, arg)
+			case len(child.Args) == 2 && arg == "Host" && child.Args[1] == "$proxy_host":
+				c.ProxyHost = "upstream"
+				seen[arg] = value
+			case len(child.Args) == 2 && arg == "Host" && child.Args[1] != "$host":
+				c.ProxyHost = child.Args[1]
+				seen[arg] = value
+			default:
+				seen[arg] = value
+			}
+		case "proxy_cache":
+			if c.ProxyCache == nil {
+				c.ProxyCache = &CacheConfig{}
+			}
+			c.ProxyCache.Zone = arg
+		case "proxy_cache_key":
+			if c.ProxyCache == nil {
+				c.ProxyCache = &CacheConfig{}
+			}
+			c.ProxyCache.Key = arg
+		case "proxy_cache_valid":
+			if c.ProxyCache == nil {
+				c.ProxyCache = &CacheConfig{}
+			}
+			if len(child.Args) < 2 {
+				c.skip(child)
+				continue
+			}
+			if c.ProxyCache.Valid == nil {
+				c.ProxyCache.Valid = make(map[string]string)
+			}
+			c.ProxyCache.Valid[strings.Join(child.Args[:len(child.Args)-1], " ")] = child.Args[len(child.Args)-1]
+		case "proxy_cache_use_stale":
+			if strings.Join(child.Args, " ") != "error timeout updating http_500 http_502 http_503 http_504" {
+				c.skip(child)
+			}
+		case "proxy_pass":
+			c.ProxyPass = arg
+		case "grpc_pass":
+			c.GRPCPass = arg
+		case "return":
+			c.parseRedirect(child)
+		case "resolver":
+			c.Resolver = strings.Join(child.Args, " ")
+		case "set":
+			if len(child.Args) == 2 && arg == "$backend" {
+				backend = child.Args[1]
+			} else {
+				c.skip(child)
+			}
+		case "proxy_ssl_name":
+			c.ProxySSLName = arg
+		case "proxy_ssl_verify":
+			c.ProxySSLVerify = arg == "on"
+		case "proxy_ssl_trusted_certificate":
+			c.ProxySSLCA = arg
+		case "proxy_intercept_errors", "grpc_intercept_errors":
+			c.InterceptErrors = arg == "on"
+		case "proxy_next_upstream":
+			c.NextUpstream = strings.Join(child.Args, " ")
+		case "auth_request":
+			c.AuthRequest = arg
+		case "auth_request_set":
+		default:
+			if !c.parseCommon(child) {
+				c.skip(child)
+			}
+		}
+	}
+	if len(c.AuthHeaders) == 2 && c.AuthHeaders[0] == "X-Auth-Request-User" && c.AuthHeaders[1] == "X-Auth-Request-Email" {
+		c.AuthHeaders = nil
+	}
+	if backend != "" {
+		c.ProxyPass = strings.Replace(c.ProxyPass, "$backend", backend, 1)
+	}
+	// The default proxy_cache_valid is what an empty valid writes.
+	if c.ProxyCache != nil && len(c.ProxyCache.Valid) == 1 && c.ProxyCache.Valid["200 301 302"] == "10m" {
+		c.ProxyCache.Valid = nil
+	}
+	return seen
+}
+
+// parseWebDAV reads the location webdav generates. Defaults are left in
+// place, since they are what the template writes for an empty setting.
+func (c *ServerConfig) parseWebDAV(d *Directive) {
+	dav := &WebDAVConfig{Path: d.Args[0]}
+	for _, child := range d.Children {
+		arg := ""
+		if len(child.Args) > 0 {
+			arg = child.Args[0]
+		}
+		switch child.Name {
+		case "#", "limit_conn":
+		case "dav_methods":
+			dav.Methods = child.Args
+		case "dav_access":
+			dav.Access = strings.Join(child.Args, " ")
+		case "create_full_put_path":
+			dav.CreateFullPut = arg == "on"
+		case "client_body_temp_path":
+			dav.TempPath = arg
+		case "client_max_body_size":
+			dav.MaxBodySize = arg
+		case "auth_basic":
+			dav.AuthBasic = arg
+		case "auth_basic_user_file":
+			dav.AuthBasicFile = arg
+		case "limit_except":
+			for _, auth := range child.Children {
+				switch {
+				case auth.Name == "auth_basic" && len(auth.Args) == 1:
+					dav.AuthBasic = auth.Args[0]
+				case auth.Name == "auth_basic_user_file" && len(auth.Args) == 1:
+					dav.AuthBasicFile = auth.Args[0]
+				case auth.Name == "#":
+				default:
+					c.skip(auth)
+				}
+			}
+			dav.AuthWritesOnly = true
+		default:
+			c.skip(child)
+		}
+	}
+	c.WebDAV = dav
+}
+
+// parseRedirect reads return 301 https://example.com$request_uri.
+func (c *ServerConfig) parseRedirect(d *Directive) {
+	if len(d.Args) != 2 {
+		c.skip(d)
+		return
+	}
+	code, err := strconv.Atoi(d.Args[0])
+	if err != nil || code != 301 && code != 302 {
+		c.skip(d)
+		return
+	}
+	c.RedirectCode = code
+	c.RedirectTo = strings.TrimSuffix(d.Args[1], "$request_uri")
+}
+
+// parseHeaders turns the headers of the security preset back into
+// security_headers when all of them are there with their preset values.
+func (c *ServerConfig) parseHeaders() {
+	preset := map[string]string{
+		"X-Frame-Options":        "SAMEORIGIN",
+		"X-Content-Type-Options": "nosniff",
+		"Referrer-Policy":        "strict-origin-when-cross-origin",
+	}
+	for name, value := range preset {
+		if c.Headers[name] != value {
+			return
+		}
+	}
+	c.SecurityHeaders = true
+	for name := range preset {
+		delete(c.Headers, name)
+	}
+	if c.Headers["Strict-Transport-Security"] == "max-age=31536000; includeSubDomains" {
+		delete(c.Headers, "Strict-Transport-Security")
+	}
+	if len(c.Headers) == 0 {
+		c.Headers = nil
+	}
+}
+
+func (c *ServerConfig) skip(d *Directive) {
+	c.Warnings = append(c.Warnings, fmt.Sprintf("dropping %s from line %d of the block; add it back with raw_directives", d.Name, d.Line))
+}
+
+// parseDefinitions reads back the http-level blocks generated for the
+// server: its upstreams, limit_conn zone, proxy cache path, log format,
+// blocklist and maps. An upstream, log format or map the configuration
+// cannot hold exactly is left out; the block still refers to it by name, so
+// it stays as it is. A zone or blocklist the server uses is always
+// regenerated, so one that is missing or cannot be read back is an error
+// rather than being replaced by the defaults.
+func (c *ServerConfig) parseDefinitions(definitions []*Directive, blocked string) error {
+	zoneFound, cacheFound := false, false
+	for _, d := range definitions {
+		switch d.Name {
+		case "upstream":
+			c.parseUpstream(d)
+		case "limit_conn_zone":
+			found, err := c.parseLimitConnZone(d)
+			if err != nil {
+				return err
+			}
+			zoneFound = zoneFound || found
+		case "proxy_cache_path":
+			found, err := c.parseCachePath(d)
+			if err != nil {
+				return err
+			}
+			cacheFound = cacheFound || found
+		case "log_format":
+			c.parseLogFormat(d)
+		case "geo":
+			if err := c.parseBlocklist(d, blocked); err != nil {
+				return err
+			}
+		case "map":
+			c.parseMap(d)
+		}
+	}
+
+	switch {
+	case c.LimitConn > 0 && !zoneFound:
+		return fmt.Errorf("limit_conn uses zone %s, but its limit_conn_zone was not found in the http block", c.LimitConnZone)
+	case c.ProxyCache != nil && !cacheFound:
+		return fmt.Errorf("proxy_cache uses zone %s, but its proxy_cache_path was not found in the http block", c.ProxyCache.Zone)
+	case blocked != "" && len(c.Blocklist) == 0:
+		return fmt.Errorf("the blocklist check uses %s, but its geo block was not found in the http block", blocked)
+	}
+	return nil
+}
+
+// parseUpstream reads the upstream that location / or an extra location
+// proxies through. The single backend of a keepalive upstream becomes the
+// proxy_pass again, as it was written in the configuration; any other
+// upstream becomes upstreams or an upstream group.
+func (c *ServerConfig) parseUpstream(d *Directive) {
+	if len(d.Args) != 1 {
+		return
+	}
+	name := d.Args[0]
+	servers, keepalive, ok := parseUpstreamBody(d)
+	if !ok {
+		return
+	}
+
+	if target, err := url.Parse(c.ProxyPass); err == nil && target.Host == name {
+		uri := strings.TrimPrefix(c.ProxyPass, target.Scheme+"://"+name)
+		c.Upstream = name
+		c.Keepalive = keepalive
+		server := servers[0]
+		switch {
+		case keepalive == 0 || len(servers) > 1 || server != UpstreamServer{Address: server.Address}:
+			c.Upstreams = servers
+		case strings.HasPrefix(server.Address, "unix:") && target.Scheme == "http":
+			c.ProxyPass = "http://" + server.Address + ":" + uri
+		default:
+			c.ProxyPass = target.Scheme + "://" + server.Address + uri
+		}
+		return
+	}
+
+	if keepalive > 0 {
+		return
+	}
+	for i, location := range c.Locations {
+		if target, err := url.Parse(location.ProxyPass); err == nil && target.Host == name {
+			c.Locations[i].Upstream = name
+			if !containsGroup(c.UpstreamGroups, name) {
+				c.UpstreamGroups = append(c.UpstreamGroups, UpstreamGroup{Name: name, Servers: servers})
+			}
+		}
+	}
+}
+
+// parseUpstreamBody reads the server and keepalive lines of an upstream
+// block. It reports false for anything else, such as a balancing method,
+// which the configuration cannot hold.
+func parseUpstreamBody(d *Directive) ([]UpstreamServer, int, bool) {
+	var servers []UpstreamServer
+	keepalive := 0
+	for _, child := range d.Children {
+		switch {
+		case child.IsComment():
+		case child.Name == "keepalive" && len(child.Args) == 1:
+			n, err := strconv.Atoi(child.Args[0])
+			if err != nil || n <= 0 {
+				return nil, 0, false
+			}
+			keepalive = n
+		case child.Name == "server" && len(child.Args) > 0:
+			server := UpstreamServer{Address: child.Args[0]}
+			for _, arg := range child.Args[1:] {
+				key, value, _ := strings.Cut(arg, "=")
+				var err error
+				switch key {
+				case "weight":
+					server.Weight, err = strconv.Atoi(value)
+				case "max_fails":
+					server.MaxFails, err = strconv.Atoi(value)
+				case "fail_timeout":
+					server.FailTimeout = value
+				case "backup":
+					server.Backup = arg == "backup"
+				default:
+					return nil, 0, false
+				}
+				// Zero values are not written, so they cannot be read back.
+				if err != nil || value == "0" || arg == "backup=" {
+					return nil, 0, false
+				}
+			}
+			servers = append(servers, server)
+		default:
+			return nil, 0, false
+		}
+	}
+	return servers, keepalive, len(servers) > 0
+}
+
+func containsGroup(groups []UpstreamGroup, name string) bool {
+	for _, group := range groups {
+		if group.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// parseLimitConnZone reads limit_conn_zone $binary_remote_addr
+// zone=<name>:<size> for the zone limit_conn uses, and reports whether it
+// was that zone.
+func (c *ServerConfig) parseLimitConnZone(d *Directive) (bool, error) {
+	if c.LimitConn == 0 {
+		return false, nil
+	}
+	for _, arg := range d.Args {
+		zone, ok := strings.CutPrefix(arg, "zone=")
+		name, size, _ := strings.Cut(zone, ":")
+		if !ok || name != c.LimitConnZone {
+			continue
+		}
+		if len(d.Args) != 2 || d.Args[0] != "$binary_remote_addr" || size == "" {
+			return false, fmt.Errorf("limit_conn_zone %s on line %d is not keyed by $binary_remote_addr with a size; edit this block with a full config instead of a patch", name, d.Line)
+		}
+		if size != "10m" {
+			c.LimitConnSize = size
+		}
+		return true, nil
+	}
+	return false, nil
+}
+
+// parseCachePath reads the proxy_cache_path of the zone proxy_cache uses,
+// and reports whether it was that zone.
+func (c *ServerConfig) parseCachePath(d *Directive) (bool, error) {
+	if c.ProxyCache == nil || len(d.Args) == 0 {
+		return false, nil
+	}
+	cache := *c.ProxyCache
+	found, understood := false, true
+	for _, arg := range d.Args[1:] {
+		key, value, _ := strings.Cut(arg, "=")
+		switch key {
+		case "keys_zone":
+			zone, size, _ := strings.Cut(value, ":")
+			found = zone == cache.Zone
+			understood = understood && size != ""
+			if size != "10m" {
+				cache.Size = size
+			}
+		case "max_size":
+			cache.MaxSize = value
+		case "inactive":
+			cache.Inactive = value
+		case "levels":
+			understood = understood && value == "1:2"
+		case "use_temp_path":
+			understood = understood && value == "off"
+		default:
+			understood = false
+		}
+	}
+	if !found {
+		return false, nil
+	}
+	if !understood {
+		return false, fmt.Errorf("proxy_cache_path for zone %s on line %d has settings a config cannot hold; edit this block with a full config instead of a patch", cache.Zone, d.Line)
+	}
+	if d.Args[0] != "/var/cache/nginx/"+cache.Zone {
+		cache.Path = d.Args[0]
+	}
+	*c.ProxyCache = cache
+	return true, nil
+}
+
+// parseLogFormat reads the log_format that access_log names, when it is a
+// single format string the configuration can hold.
+func (c *ServerConfig) parseLogFormat(d *Directive) {
+	if c.AccessLog == nil || len(d.Args) < 2 || d.Args[0] != c.AccessLog.FormatName {
+		return
+	}
+	args := d.Args[1:]
+	escape := ""
+	if value, ok := strings.CutPrefix(args[0], "escape="); ok {
+		escape, args = value, args[1:]
+	}
+	if len(args) != 1 || strings.Contains(args[0], "'") {
+		return
+	}
+	c.AccessLog.Escape = escape
+	c.AccessLog.Format = args[0]
+}
+
+// parseBlocklist reads the geo block the blocklist check uses, which sets
+// the variable to 1 for every blocked address.
+func (c *ServerConfig) parseBlocklist(d *Directive, blocked string) error {
+	if blocked == "" || len(d.Args) != 1 || d.Args[0] != blocked {
+		return nil
+	}
+	var entries []string
+	for _, child := range d.Children {
+		switch {
+		case child.IsComment():
+		case child.Name == "default" && len(child.Args) == 1 && child.Args[0] == "0":
+		case len(child.Args) == 1 && child.Args[0] == "1":
+			entries = append(entries, child.Name)
+		default:
+			return fmt.Errorf("geo %s on line %d has entries other than blocked addresses; edit this block with a full config instead of a patch", blocked, d.Line)
+		}
+	}
+	c.Blocklist = entries
+	return nil
+}
+
+// parseMap reads a map block the server uses, when it only holds a default
+// and plain entries.
+func (c *ServerConfig) parseMap(d *Directive) {
+	if len(d.Args) != 2 {
+		return
+	}
+	m := MapConfig{Source: d.Args[0], Variable: d.Args[1]}
+	for _, child := range d.Children {
+		switch {
+		case child.IsComment():
+		case len(child.Args) != 1 || child.Name == "include" || child.Name == "hostnames" || child.Name == "volatile":
+			return
+		case child.Name == "default":
+			m.Default = child.Args[0]
+		default:
+			if m.Entries == nil {
+				m.Entries = make(map[string]string)
+			}
+			m.Entries[child.Name] = child.Args[0]
+		}
+	}
+	c.Maps = append(c.Maps, m)
+}
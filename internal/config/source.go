@@ -0,0 +1,79 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// isGitSource reports whether source names a config file in a Git
+// repository rather than on disk.
+func isGitSource(source string) bool {
+	return strings.HasPrefix(source, "git://") || strings.HasPrefix(source, "git+")
+}
+
+// readSource returns the contents of a config source and the path used to
+// tell its format. Local files are read directly; Git sources are written
+// as <repo>[?ref=<branch or tag>]#<path>, where <repo> is a git:// URL or
+// any URL git understands prefixed with "git+", such as
+// git+https://github.com/org/configs.git?ref=main#sites/blog.yaml.
+func readSource(source string) ([]byte, string, error) {
+	if isGitSource(source) {
+		return readGitSource(source)
+	}
+
+	file, err := os.Open(source)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to read config file: %w", err)
+	}
+	defer file.Close()
+
+	data, err := io.ReadAll(file)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to read config file: %w", err)
+	}
+	return data, source, nil
+}
+
+func readGitSource(source string) ([]byte, string, error) {
+	repo, path, ok := strings.Cut(strings.TrimPrefix(source, "git+"), "#")
+	if !ok || path == "" {
+		return nil, "", fmt.Errorf("git config source %q must name a file after '#'", source)
+	}
+	repo, ref, _ := strings.Cut(repo, "?ref=")
+	path = filepath.Clean(path)
+	if filepath.IsAbs(path) || strings.HasPrefix(path, "..") {
+		return nil, "", fmt.Errorf("git config path %q must be relative to the repository root", path)
+	}
+
+	dir, err := os.MkdirTemp("", "nginx-tool-config-")
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to create clone directory: %w", err)
+	}
+	defer os.RemoveAll(dir)
+
+	args := []string{"clone", "--quiet", "--depth", "1"}
+	if ref != "" {
+		args = append(args, "--branch", ref)
+	}
+	args = append(args, "--", repo, dir)
+	cmd := exec.Command("git", args...)
+	cmd.Env = append(os.Environ(), "GIT_TERMINAL_PROMPT=0")
+	if output, err := cmd.CombinedOutput(); err != nil {
+		return nil, "", fmt.Errorf("failed to clone %s: %w: %s", repo, err, strings.TrimSpace(string(output)))
+	}
+
+	data, err := os.ReadFile(filepath.Join(dir, path))
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, "", fmt.Errorf("%s not found in %s", path, repo)
+	}
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to read %s from %s: %w", path, repo, err)
+	}
+	return data, path, nil
+}
@@ -0,0 +1,100 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v2"
+)
+
+// checkUnknownKeys decodes data generically and reports every key that does
+// not match a field of ServerConfig, including keys nested in locations,
+// maps, upstreams, listens, proxy_cache, access_log and webdav.
+func checkUnknownKeys(data []byte, format string) error {
+	var raw interface{}
+	var err error
+	if format == "json" {
+		err = json.Unmarshal(data, &raw)
+	} else {
+		err = yaml.Unmarshal(data, &raw)
+	}
+	if err != nil {
+		return err
+	}
+
+	unknown := unknownKeys(raw, reflect.TypeOf(ServerConfig{}), "")
+	if len(unknown) == 0 {
+		return nil
+	}
+	return fmt.Errorf("unknown config keys: %s", strings.Join(unknown, ", "))
+}
+
+func unknownKeys(value interface{}, t reflect.Type, path string) []string {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+
+	var unknown []string
+	switch t.Kind() {
+	case reflect.Struct:
+		entries := stringKeyed(value)
+		if entries == nil {
+			return nil
+		}
+		fields := make(map[string]reflect.Type)
+		for i := 0; i < t.NumField(); i++ {
+			name := strings.Split(t.Field(i).Tag.Get("json"), ",")[0]
+			if name != "" && name != "-" {
+				fields[name] = t.Field(i).Type
+			}
+		}
+		keys := make([]string, 0, len(entries))
+		for key := range entries {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			field, ok := fields[key]
+			if !ok {
+				unknown = append(unknown, path+key)
+				continue
+			}
+			unknown = append(unknown, unknownKeys(entries[key], field, path+key+".")...)
+		}
+	case reflect.Slice:
+		items, ok := value.([]interface{})
+		if !ok {
+			return nil
+		}
+		prefix := strings.TrimSuffix(path, ".")
+		for i, item := range items {
+			unknown = append(unknown, unknownKeys(item, t.Elem(), fmt.Sprintf("%s[%d].", prefix, i))...)
+		}
+	case reflect.Map:
+		entries := stringKeyed(value)
+		for key, item := range entries {
+			unknown = append(unknown, unknownKeys(item, t.Elem(), path+key+".")...)
+		}
+		sort.Strings(unknown)
+	}
+	return unknown
+}
+
+// stringKeyed returns value as a map keyed by strings, accepting both the
+// JSON and the YAML decoding of an object. It returns nil for anything else.
+func stringKeyed(value interface{}) map[string]interface{} {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		return v
+	case map[interface{}]interface{}:
+		entries := make(map[string]interface{}, len(v))
+		for key, item := range v {
+			entries[fmt.Sprint(key)] = item
+		}
+		return entries
+	}
+	return nil
+}
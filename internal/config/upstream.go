@@ -0,0 +1,144 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// UpstreamServer is one server in a generated upstream block. In JSON and
+// YAML it may be written as a plain address string or as an object.
+type UpstreamServer struct {
+	Address     string `json:"address" yaml:"address"`
+	Weight      int    `json:"weight" yaml:"weight"`
+	MaxFails    int    `json:"max_fails" yaml:"max_fails"`
+	FailTimeout string `json:"fail_timeout" yaml:"fail_timeout"`
+	Backup      bool   `json:"backup" yaml:"backup"`
+}
+
+// UpstreamGroup is a named upstream block that locations refer to with
+// their upstream setting, so one server can route paths to different
+// backends.
+type UpstreamGroup struct {
+	Name    string           `json:"name" yaml:"name"`
+	Servers []UpstreamServer `json:"servers" yaml:"servers"`
+}
+
+func (s *UpstreamServer) UnmarshalJSON(data []byte) error {
+	var address string
+	if err := json.Unmarshal(data, &address); err == nil {
+		*s = UpstreamServer{Address: address}
+		return nil
+	}
+	type plain UpstreamServer
+	var server plain
+	if err := json.Unmarshal(data, &server); err != nil {
+		return fmt.Errorf("upstreams entries must be an address or an object with an address")
+	}
+	*s = UpstreamServer(server)
+	return nil
+}
+
+func (s *UpstreamServer) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	var address string
+	if err := unmarshal(&address); err == nil {
+		*s = UpstreamServer{Address: address}
+		return nil
+	}
+	type plain UpstreamServer
+	var server plain
+	if err := unmarshal(&server); err != nil {
+		return fmt.Errorf("upstreams entries must be an address or an object with an address")
+	}
+	*s = UpstreamServer(server)
+	return nil
+}
+
+func validateUpstreams(servers []UpstreamServer) error {
+	primary := 0
+	for _, server := range servers {
+		if server.Address == "" || strings.ContainsAny(server.Address, " \t;{}") {
+			return fmt.Errorf("invalid upstream server address %q", server.Address)
+		}
+		if server.Weight < 0 {
+			return fmt.Errorf("upstream server %s: weight must be positive, got %d", server.Address, server.Weight)
+		}
+		if server.MaxFails < 0 {
+			return fmt.Errorf("upstream server %s: max_fails must be zero or more, got %d", server.Address, server.MaxFails)
+		}
+		if server.FailTimeout != "" && !expiresPattern.MatchString(server.FailTimeout) {
+			return fmt.Errorf("upstream server %s: invalid fail_timeout %q: use a time such as 10s or 1m", server.Address, server.FailTimeout)
+		}
+		if !server.Backup {
+			primary++
+		}
+	}
+	if len(servers) > 0 && primary == 0 {
+		return fmt.Errorf("upstreams must include at least one server that is not a backup")
+	}
+	return nil
+}
+
+// nextUpstreamConditions are the proxy_next_upstream arguments open-source
+// nginx accepts.
+var nextUpstreamConditions = map[string]bool{
+	"error": true, "timeout": true, "invalid_header": true, "http_500": true,
+	"http_502": true, "http_503": true, "http_504": true, "http_403": true,
+	"http_404": true, "http_429": true, "non_idempotent": true, "off": true,
+}
+
+// validateHealthChecks checks the passive health check settings, which only
+// make sense when the server proxies through a generated upstream.
+func (c *ServerConfig) validateHealthChecks() error {
+	if c.MaxFails < 0 {
+		return fmt.Errorf("upstream_max_fails must be zero or more, got %d", c.MaxFails)
+	}
+	if c.FailTimeout != "" && !expiresPattern.MatchString(c.FailTimeout) {
+		return fmt.Errorf("invalid upstream_fail_timeout %q: use a time such as 10s or 1m", c.FailTimeout)
+	}
+	if (c.MaxFails > 0 || c.FailTimeout != "") && len(c.Upstreams) == 0 && len(c.UpstreamGroups) == 0 && c.Keepalive == 0 {
+		return fmt.Errorf("upstream_max_fails and upstream_fail_timeout need an upstream block; set upstreams, upstream_groups or keepalive")
+	}
+	for _, condition := range strings.Fields(c.NextUpstream) {
+		if !nextUpstreamConditions[condition] {
+			return fmt.Errorf("invalid proxy_next_upstream condition %q", condition)
+		}
+	}
+	return nil
+}
+
+// validateUpstreamGroups checks the named upstream groups and that every
+// location upstream refers to one of them.
+func (c *ServerConfig) validateUpstreamGroups() error {
+	groups := make(map[string]bool)
+	for _, group := range c.UpstreamGroups {
+		if !upstreamPattern.MatchString(group.Name) {
+			return fmt.Errorf("invalid upstream group name %q: use letters, digits, '.', '-' and '_'", group.Name)
+		}
+		if groups[group.Name] {
+			return fmt.Errorf("duplicate upstream group %s", group.Name)
+		}
+		if group.Name == c.Upstream {
+			return fmt.Errorf("upstream group %s has the same name as the server's upstream", group.Name)
+		}
+		if len(group.Servers) == 0 {
+			return fmt.Errorf("upstream group %s needs at least one server", group.Name)
+		}
+		if err := validateUpstreams(group.Servers); err != nil {
+			return fmt.Errorf("upstream group %s: %w", group.Name, err)
+		}
+		groups[group.Name] = true
+	}
+	for _, location := range c.Locations {
+		if location.Upstream == "" {
+			continue
+		}
+		if !groups[location.Upstream] {
+			return fmt.Errorf("location %s refers to unknown upstream group %q", location.Path, location.Upstream)
+		}
+		if strings.Contains(location.ProxyPass, "$") {
+			return fmt.Errorf("location %s: upstream cannot be combined with a proxy_pass that contains variables", location.Path)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,87 @@
+package config
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+var davAccessPattern = regexp.MustCompile(`^(user|group|all):(rw|r)$`)
+
+// davMethods are the methods ngx_http_dav_module implements.
+var davMethods = []string{"PUT", "DELETE", "MKCOL", "COPY", "MOVE"}
+
+// WebDAVConfig adds a location of a static server that accepts uploads and
+// file management through ngx_http_dav_module, for file sync clients. Files
+// are stored under the server's root. Methods defaults to every method the
+// module supports and Access to dav_access user:rw. With AuthBasic set,
+// the location asks for a password; AuthWritesOnly limits that to the
+// methods that change files, so GET and HEAD stay public.
+type WebDAVConfig struct {
+	Path           string   `json:"path" yaml:"path"`
+	Methods        []string `json:"methods" yaml:"methods"`
+	Access         string   `json:"dav_access" yaml:"dav_access"`
+	TempPath       string   `json:"client_body_temp_path" yaml:"client_body_temp_path"`
+	MaxBodySize    string   `json:"client_max_body_size" yaml:"client_max_body_size"`
+	CreateFullPut  bool     `json:"create_full_put_path" yaml:"create_full_put_path"`
+	AuthBasic      string   `json:"auth_basic" yaml:"auth_basic"`
+	AuthBasicFile  string   `json:"auth_basic_user_file" yaml:"auth_basic_user_file"`
+	AuthWritesOnly bool     `json:"auth_writes_only" yaml:"auth_writes_only"`
+}
+
+// MethodList returns Methods, or every WebDAV method when none are set.
+func (w *WebDAVConfig) MethodList() []string {
+	if len(w.Methods) > 0 {
+		return w.Methods
+	}
+	return davMethods
+}
+
+func (w *WebDAVConfig) validate() error {
+	if w.Path != "" {
+		if !strings.HasPrefix(w.Path, "/") || strings.ContainsAny(w.Path, " \t;{}") {
+			return fmt.Errorf("webdav path must be a URI prefix such as /dav/, got %q", w.Path)
+		}
+		if w.Path == "/" {
+			return fmt.Errorf("webdav path cannot be /, since location / is already generated for the server; use a prefix such as /dav/")
+		}
+	}
+	seen := make(map[string]bool)
+	for _, method := range w.Methods {
+		known := false
+		for _, m := range davMethods {
+			known = known || method == m
+		}
+		if !known {
+			return fmt.Errorf("invalid webdav method %q: must be one of %s", method, strings.Join(davMethods, ", "))
+		}
+		if seen[method] {
+			return fmt.Errorf("webdav method %s is listed more than once", method)
+		}
+		seen[method] = true
+	}
+	for _, field := range strings.Fields(w.Access) {
+		if !davAccessPattern.MatchString(field) {
+			return fmt.Errorf("invalid webdav dav_access %q: use entries such as user:rw group:r all:r", field)
+		}
+	}
+	if w.TempPath != "" && (!strings.HasPrefix(w.TempPath, "/") || strings.ContainsAny(w.TempPath, " \t;{}")) {
+		return fmt.Errorf("webdav client_body_temp_path must be an absolute path without spaces, got %q", w.TempPath)
+	}
+	if w.MaxBodySize != "" && w.MaxBodySize != "0" && !sizePattern.MatchString(w.MaxBodySize) {
+		return fmt.Errorf("invalid webdav client_max_body_size %q: use a size such as 100m, or 0 for no limit", w.MaxBodySize)
+	}
+	if (w.AuthBasic == "") != (w.AuthBasicFile == "") {
+		return fmt.Errorf("webdav auth_basic and auth_basic_user_file must be set together")
+	}
+	if w.AuthBasicFile != "" && !strings.HasPrefix(w.AuthBasicFile, "/") {
+		return fmt.Errorf("webdav auth_basic_user_file must be an absolute path, got %q", w.AuthBasicFile)
+	}
+	if strings.ContainsAny(w.AuthBasic, "\"\r\n") {
+		return fmt.Errorf("webdav auth_basic realm must not contain quotes or line breaks")
+	}
+	if w.AuthWritesOnly && w.AuthBasic == "" {
+		return fmt.Errorf("webdav auth_writes_only requires auth_basic")
+	}
+	return nil
+}
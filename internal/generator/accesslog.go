@@ -0,0 +1,60 @@
+package generator
+
+import (
+	"fmt"
+	"nginx_tool/internal/config"
+	"strings"
+)
+
+// logFormatName is the configured log_format name or one derived from the
+// first server name, e.g. api_example_com_log.
+func logFormatName(cfg *config.ServerConfig) string {
+	if cfg.AccessLog.FormatName != "" {
+		return cfg.AccessLog.FormatName
+	}
+	if slug := serverSlug(cfg); slug != "" {
+		return slug + "_log"
+	}
+	return "custom_log"
+}
+
+// renderLogFormat declares the access log format at http level. Servers
+// sharing a format_name with the same format end up with one declaration.
+func renderLogFormat(cfg *config.ServerConfig) string {
+	args := []string{logFormatName(cfg)}
+	if cfg.AccessLog.Escape != "" {
+		args = append(args, "escape="+cfg.AccessLog.Escape)
+	}
+	return fmt.Sprintf("    log_format %s '%s';", strings.Join(args, " "), cfg.AccessLog.Format)
+}
+
+// accessLogArgs returns the arguments of the server's access_log directive.
+// Without a path the log goes to its own file named after the server.
+func accessLogArgs(cfg *config.ServerConfig) string {
+	log := cfg.AccessLog
+	if log.Path == "off" {
+		return "off"
+	}
+	path := log.Path
+	if path == "" {
+		path = "/var/log/nginx/access.log"
+		if slug := serverSlug(cfg); slug != "" {
+			path = "/var/log/nginx/" + slug + ".access.log"
+		}
+	}
+
+	args := []string{path}
+	if log.Format != "" || log.FormatName != "" {
+		args = append(args, logFormatName(cfg))
+	} else if log.Buffer != "" {
+		// Buffering parameters must follow a format name.
+		args = append(args, "combined")
+	}
+	if log.Buffer != "" {
+		args = append(args, "buffer="+log.Buffer)
+	}
+	if log.Flush != "" {
+		args = append(args, "flush="+log.Flush)
+	}
+	return strings.Join(args, " ")
+}
@@ -0,0 +1,201 @@
+package generator
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var (
+	ErrChecksumMismatch = errors.New("backup checksum mismatch")
+	ErrNoChecksum       = errors.New("backup has no checksum")
+)
+
+type Backup struct {
+	Path    string
+	Created time.Time
+	Size    int64
+}
+
+// createBackup copies nginxPath to a timestamped backup. When BackupReuse is
+// set and the latest backup is younger than that, it is reused instead, so
+// quick successive runs share the backup taken before the first of them.
+func (g *Generator) createBackup(nginxPath string) (string, bool, error) {
+	if g.BackupReuse > 0 {
+		backups, err := g.ListBackups(nginxPath)
+		if err != nil {
+			return "", false, err
+		}
+		if n := len(backups); n > 0 && time.Since(backups[n-1].Created) < g.BackupReuse {
+			return backups[n-1].Path, true, nil
+		}
+	}
+
+	// Backups are named by the second; when several writes fall in the same
+	// second, as in the manage menu, later ones take the next free second
+	// instead of overwriting the first.
+	stamp := time.Now().Unix()
+	backupPath := fmt.Sprintf("%s.backup.%d", nginxPath, stamp)
+	for _, err := os.Stat(backupPath); err == nil; _, err = os.Stat(backupPath) {
+		stamp++
+		backupPath = fmt.Sprintf("%s.backup.%d", nginxPath, stamp)
+	}
+	if err := g.copyFile(nginxPath, backupPath); err != nil {
+		return "", false, fmt.Errorf("failed to create backup: %w", err)
+	}
+	if err := writeChecksum(backupPath); err != nil {
+		return "", false, fmt.Errorf("failed to record backup checksum: %w", err)
+	}
+	return backupPath, false, nil
+}
+
+// backup takes the backup for a write of nginxPath, records it in result and
+// reports it through OnBackup. Callers take it right before writing, once
+// nothing but the write itself can fail.
+func (g *Generator) backup(nginxPath string, result *Result) error {
+	backupPath, reused, err := g.createBackup(nginxPath)
+	if err != nil {
+		return err
+	}
+	result.BackupPath = backupPath
+	result.BackupReused = reused
+	if g.OnBackup != nil {
+		g.OnBackup(backupPath, reused)
+	}
+	return nil
+}
+
+// withBackup adds the backup path to err, so a failed write still says
+// where the original configuration was saved.
+func (r *Result) withBackup(err error) error {
+	if r.BackupPath == "" {
+		return err
+	}
+	return fmt.Errorf("%w (the original is saved in %s)", err, r.BackupPath)
+}
+
+// writeChecksum records the SHA-256 of path in a path.sha256 sidecar, in the
+// format sha256sum -c understands.
+func writeChecksum(path string) error {
+	sum, err := fileChecksum(path)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path+".sha256", []byte(sum+"  "+filepath.Base(path)+"\n"), 0644)
+}
+
+// VerifyBackup checks backupPath against its .sha256 sidecar. It returns
+// ErrNoChecksum when there is no sidecar, as for backups taken by older
+// versions, and ErrChecksumMismatch when the contents have changed.
+func VerifyBackup(backupPath string) error {
+	recorded, err := os.ReadFile(backupPath + ".sha256")
+	if errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("%w: %s.sha256 not found", ErrNoChecksum, backupPath)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to read backup checksum: %w", err)
+	}
+
+	fields := strings.Fields(string(recorded))
+	if len(fields) == 0 {
+		return fmt.Errorf("%w: %s.sha256 is empty", ErrChecksumMismatch, backupPath)
+	}
+	sum, err := fileChecksum(backupPath)
+	if err != nil {
+		return fmt.Errorf("failed to read backup: %w", err)
+	}
+	if !strings.EqualFold(sum, fields[0]) {
+		return fmt.Errorf("%w: %s may be corrupted or was modified after it was taken", ErrChecksumMismatch, backupPath)
+	}
+	return nil
+}
+
+func fileChecksum(path string) (string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+
+	hash := sha256.New()
+	if _, err := io.Copy(hash, file); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+func (g *Generator) ListBackups(nginxPath string) ([]Backup, error) {
+	paths, err := filepath.Glob(nginxPath + ".backup.*")
+	if err != nil {
+		return nil, fmt.Errorf("failed to list backups: %w", err)
+	}
+
+	var backups []Backup
+	for _, path := range paths {
+		unix, err := strconv.ParseInt(strings.TrimPrefix(path, nginxPath+".backup."), 10, 64)
+		if err != nil {
+			continue
+		}
+		backup := Backup{Path: path, Created: time.Unix(unix, 0)}
+		if info, err := os.Stat(path); err == nil {
+			backup.Size = info.Size()
+		}
+		backups = append(backups, backup)
+	}
+
+	sort.Slice(backups, func(i, j int) bool {
+		return backups[i].Created.Before(backups[j].Created)
+	})
+	return backups, nil
+}
+
+func (g *Generator) Rollback(nginxPath, backupPath string) (string, error) {
+	if err := checkWritable(nginxPath); err != nil {
+		return "", err
+	}
+
+	if backupPath == "" {
+		backups, err := g.ListBackups(nginxPath)
+		if err != nil {
+			return "", err
+		}
+		if len(backups) == 0 {
+			return "", fmt.Errorf("no backups found for %s", nginxPath)
+		}
+		backupPath = backups[len(backups)-1].Path
+	}
+
+	if err := VerifyBackup(backupPath); err != nil && !errors.Is(err, ErrNoChecksum) {
+		return "", err
+	}
+
+	if err := g.copyFile(backupPath, nginxPath); err != nil {
+		return "", fmt.Errorf("failed to restore backup %s: %w", backupPath, err)
+	}
+	return backupPath, nil
+}
+
+func (g *Generator) copyFile(src, dst string) error {
+	srcFile, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer srcFile.Close()
+
+	dstFile, err := os.Create(dst)
+	if err != nil {
+		return err
+	}
+	defer dstFile.Close()
+
+	_, err = io.Copy(dstFile, srcFile)
+	return err
+}
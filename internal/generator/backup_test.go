@@ -0,0 +1,108 @@
+package generator
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestVerifyBackup(t *testing.T) {
+	tests := []struct {
+		name   string
+		tamper func(backupPath string) error
+		want   error
+	}{
+		{name: "intact", tamper: func(string) error { return nil }},
+		{name: "modified", tamper: func(path string) error { return os.WriteFile(path, []byte("events {}\n"), 0644) }, want: ErrChecksumMismatch},
+		{name: "empty sidecar", tamper: func(path string) error { return os.WriteFile(path+".sha256", nil, 0644) }, want: ErrChecksumMismatch},
+		{name: "no sidecar", tamper: func(path string) error { return os.Remove(path + ".sha256") }, want: ErrNoChecksum},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			nginxPath := filepath.Join(t.TempDir(), "nginx.conf")
+			if err := os.WriteFile(nginxPath, []byte(baseConf), 0644); err != nil {
+				t.Fatal(err)
+			}
+			backupPath, _, err := New().createBackup(nginxPath)
+			if err != nil {
+				t.Fatalf("createBackup: %v", err)
+			}
+			if err := tt.tamper(backupPath); err != nil {
+				t.Fatal(err)
+			}
+			err = VerifyBackup(backupPath)
+			if !errors.Is(err, tt.want) {
+				t.Errorf("VerifyBackup() = %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestRollback(t *testing.T) {
+	tests := []struct {
+		name string
+		// backups is the number of backups taken before nginx.conf changes.
+		backups  int
+		tamper   bool
+		sidecar  bool
+		restored bool
+		want     error
+	}{
+		{name: "latest backup", backups: 2, sidecar: true, restored: true},
+		{name: "backup without checksum", backups: 1, restored: true},
+		{name: "corrupted backup", backups: 1, sidecar: true, tamper: true, want: ErrChecksumMismatch},
+		{name: "no backups"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gen := New()
+			nginxPath := filepath.Join(t.TempDir(), "nginx.conf")
+			var latest string
+			for i := 0; i < tt.backups; i++ {
+				if err := os.WriteFile(nginxPath, []byte(baseConf+string(rune('a'+i))+"\n"), 0644); err != nil {
+					t.Fatal(err)
+				}
+				var err error
+				if latest, _, err = gen.createBackup(nginxPath); err != nil {
+					t.Fatalf("createBackup: %v", err)
+				}
+			}
+			original, _ := os.ReadFile(nginxPath)
+			if latest != "" {
+				if !tt.sidecar {
+					os.Remove(latest + ".sha256")
+				}
+				if tt.tamper {
+					if err := os.WriteFile(latest, []byte("events {}\n"), 0644); err != nil {
+						t.Fatal(err)
+					}
+				}
+			}
+			if err := os.WriteFile(nginxPath, []byte("broken"), 0644); err != nil {
+				t.Fatal(err)
+			}
+
+			restored, err := gen.Rollback(nginxPath, "")
+			content, _ := os.ReadFile(nginxPath)
+			if !tt.restored {
+				if err == nil || tt.want != nil && !errors.Is(err, tt.want) {
+					t.Fatalf("Rollback() = %v, want an error %v", err, tt.want)
+				}
+				if string(content) != "broken" {
+					t.Errorf("a failed rollback changed nginx.conf to:\n%s", content)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Rollback: %v", err)
+			}
+			if restored != latest {
+				t.Errorf("restored %s, want the latest backup %s", restored, latest)
+			}
+			if string(content) != string(original) {
+				t.Errorf("nginx.conf = %q, want %q", content, original)
+			}
+		})
+	}
+}
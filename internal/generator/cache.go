@@ -0,0 +1,57 @@
+package generator
+
+import (
+	"fmt"
+	"nginx_tool/internal/config"
+	"sort"
+	"strings"
+)
+
+// cacheZone is the configured proxy_cache zone name or one derived from the
+// first server name, e.g. api_example_com_cache.
+func cacheZone(cfg *config.ServerConfig) string {
+	if cfg.ProxyCache.Zone != "" {
+		return cfg.ProxyCache.Zone
+	}
+	if slug := serverSlug(cfg); slug != "" {
+		return slug + "_cache"
+	}
+	return "proxy_cache"
+}
+
+func renderCachePath(cfg *config.ServerConfig) string {
+	cache := cfg.ProxyCache
+	zone := cacheZone(cfg)
+	path := cache.Path
+	if path == "" {
+		path = "/var/cache/nginx/" + zone
+	}
+	size := cache.Size
+	if size == "" {
+		size = "10m"
+	}
+
+	args := []string{path, "levels=1:2", "keys_zone=" + zone + ":" + size}
+	if cache.MaxSize != "" {
+		args = append(args, "max_size="+cache.MaxSize)
+	}
+	if cache.Inactive != "" {
+		args = append(args, "inactive="+cache.Inactive)
+	}
+	args = append(args, "use_temp_path=off")
+	return fmt.Sprintf("    proxy_cache_path %s;", strings.Join(args, " "))
+}
+
+// cacheValid returns the proxy_cache_valid arguments in status code order,
+// defaulting to caching 200, 301 and 302 responses for ten minutes.
+func cacheValid(cache *config.CacheConfig) []string {
+	if len(cache.Valid) == 0 {
+		return []string{"200 301 302 10m"}
+	}
+	valid := make([]string, 0, len(cache.Valid))
+	for codes, ttl := range cache.Valid {
+		valid = append(valid, strings.Join(strings.Fields(codes), " ")+" "+ttl)
+	}
+	sort.Strings(valid)
+	return valid
+}
@@ -0,0 +1,216 @@
+package generator
+
+import (
+	"fmt"
+	"strings"
+)
+
+type listenSpec struct {
+	address       string
+	defaultServer bool
+	reusePort     bool
+}
+
+type serverInfo struct {
+	line    int
+	listens []listenSpec
+	names   []string
+}
+
+func describeServer(server *directive) serverInfo {
+	info := serverInfo{line: server.line}
+
+	for _, listen := range server.find("listen") {
+		if len(listen.args) == 0 {
+			continue
+		}
+		spec := listenSpec{address: normalizeListenAddress(listen.args[0])}
+		for _, opt := range listen.args[1:] {
+			switch opt {
+			case "default_server", "default":
+				spec.defaultServer = true
+			case "reuseport":
+				spec.reusePort = true
+			}
+		}
+		info.listens = append(info.listens, spec)
+	}
+	if len(info.listens) == 0 {
+		info.listens = []listenSpec{{address: "*:80"}}
+	}
+
+	for _, serverName := range server.find("server_name") {
+		for _, name := range serverName.args {
+			info.names = append(info.names, normalizeServerName(name)...)
+		}
+	}
+	if len(info.names) == 0 {
+		info.names = []string{""}
+	}
+
+	return info
+}
+
+func normalizeListenAddress(addr string) string {
+	if strings.HasPrefix(addr, "unix:") {
+		return addr
+	}
+
+	host, port := "*", addr
+	if strings.HasPrefix(addr, "[") {
+		if end := strings.Index(addr, "]"); end >= 0 {
+			host, port = addr[:end+1], strings.TrimPrefix(addr[end+1:], ":")
+		}
+	} else if idx := strings.LastIndex(addr, ":"); idx >= 0 {
+		host, port = addr[:idx], addr[idx+1:]
+	} else if !isNumeric(addr) {
+		host, port = addr, ""
+	}
+
+	if host == "0.0.0.0" || host == "" {
+		host = "*"
+	}
+	if port == "" {
+		port = "80"
+	}
+	return strings.ToLower(host) + ":" + port
+}
+
+func normalizeServerName(name string) []string {
+	name = strings.ToLower(name)
+	if strings.HasPrefix(name, ".") {
+		return []string{name[1:], "*" + name}
+	}
+	if name == "_" {
+		return []string{""}
+	}
+	return []string{name}
+}
+
+func isNumeric(s string) bool {
+	if s == "" {
+		return false
+	}
+	for _, r := range s {
+		if r < '0' || r > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+func checkConflicts(existing, added []*directive) error {
+	var known []serverInfo
+	for _, d := range existing {
+		if d.name == "server" && d.isBlock() {
+			known = append(known, describeServer(d))
+		}
+	}
+
+	for _, d := range added {
+		if d.name != "server" || !d.isBlock() {
+			continue
+		}
+		candidate := describeServer(d)
+		for _, other := range known {
+			if err := conflictBetween(candidate, other); err != nil {
+				return err
+			}
+		}
+		candidate.line = 0
+		known = append(known, candidate)
+	}
+
+	return nil
+}
+
+// definitionName identifies the http-level directives that may only be
+// defined once, by what they define: an upstream by its name, a map or geo
+// block by its variable, a zone by its zone name, log_format per format
+// name, and the request header settings.
+func definitionName(d *directive) (string, bool) {
+	switch d.name {
+	case "upstream":
+		if len(d.args) > 0 {
+			return "upstream " + d.args[0], true
+		}
+	case "map", "geo":
+		if len(d.args) > 0 {
+			return d.name + " " + d.args[len(d.args)-1], true
+		}
+	case "limit_conn_zone", "limit_req_zone":
+		return zoneName(d, "zone=")
+	case "proxy_cache_path":
+		return zoneName(d, "keys_zone=")
+	case "log_format":
+		if len(d.args) > 0 {
+			return fmt.Sprintf("log_format %q", d.args[0]), true
+		}
+	case "underscores_in_headers", "large_client_header_buffers":
+		return d.name, true
+	}
+	return "", false
+}
+
+// zoneName names a shared memory zone declaration by the name in its
+// zone= or keys_zone= argument, so a zone whose size changed is still
+// recognised as the same zone.
+func zoneName(d *directive, prefix string) (string, bool) {
+	if zone, ok := zoneArg(d, prefix); ok {
+		return d.name + " " + prefix + zone, true
+	}
+	return "", false
+}
+
+// zoneArg returns the zone name in the zone= or keys_zone= argument of d,
+// without its size.
+func zoneArg(d *directive, prefix string) (string, bool) {
+	for _, arg := range d.args {
+		if zone, ok := strings.CutPrefix(arg, prefix); ok {
+			zone, _, _ = strings.Cut(zone, ":")
+			return zone, true
+		}
+	}
+	return "", false
+}
+
+// replaceable reports whether d defines something of the server it is
+// generated for, which a regenerated block may replace. The request header
+// settings apply to every server and are never replaced.
+func replaceable(d *directive) bool {
+	return d.name != "underscores_in_headers" && d.name != "large_client_header_buffers"
+}
+
+func conflictBetween(candidate, other serverInfo) error {
+	where := "another new server block"
+	if other.line > 0 {
+		where = fmt.Sprintf("the existing server block on line %d", other.line)
+	}
+
+	for _, listen := range candidate.listens {
+		for _, otherListen := range other.listens {
+			if listen.address != otherListen.address {
+				continue
+			}
+			if listen.defaultServer && otherListen.defaultServer {
+				return fmt.Errorf("duplicate default_server for %s: already claimed by %s", listen.address, where)
+			}
+			if listen.reusePort && otherListen.reusePort {
+				return fmt.Errorf("duplicate reuseport for %s: already set by %s", listen.address, where)
+			}
+			for _, name := range candidate.names {
+				for _, otherName := range other.names {
+					if name != otherName {
+						continue
+					}
+					if name == "" {
+						return fmt.Errorf("catch-all server on %s conflicts with %s", listen.address, where)
+					}
+					return fmt.Errorf("server_name %q on %s conflicts with %s", name, listen.address, where)
+				}
+			}
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,42 @@
+package generator
+
+import (
+	"nginx_tool/internal/config"
+	"sort"
+	"strings"
+)
+
+// ErrorPage is one error_page directive. Location is set on the first entry
+// for each page, which is where its internal location is rendered.
+type ErrorPage struct {
+	Codes    string
+	Page     string
+	Location bool
+}
+
+// errorPages returns cfg's error_pages in status code order. With
+// proxy_intercept_errors and no pages configured, 502 and 504 fall back to
+// /50x.html.
+func errorPages(cfg *config.ServerConfig) []ErrorPage {
+	pages := cfg.ErrorPages
+	if len(pages) == 0 && cfg.InterceptErrors {
+		pages = map[string]string{"502 504": "/50x.html"}
+	}
+
+	var result []ErrorPage
+	for codes, page := range pages {
+		result = append(result, ErrorPage{Codes: strings.Join(strings.Fields(codes), " "), Page: page})
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].Codes < result[j].Codes
+	})
+
+	seen := make(map[string]bool)
+	for i := range result {
+		if page := result[i].Page; !seen[page] && !(cfg.Maintenance && page == cfg.MaintenancePage) {
+			result[i].Location = true
+			seen[page] = true
+		}
+	}
+	return result
+}
@@ -0,0 +1,123 @@
+package generator
+
+import "strings"
+
+// explanations describe the directives the built-in templates generate.
+// Headers are keyed by directive and header name.
+var explanations = map[string]string{
+	"server":                               "A virtual server; nginx picks it when a request matches its listen and server_name",
+	"upstream server":                      "One backend of the upstream group, with its weight and failure limits",
+	"listen":                               "Address and port this server accepts connections on",
+	"http2":                                "Accept HTTP/2 on this server's listen sockets (nginx 1.25.1 and later)",
+	"server_name":                          "Host names (from the Host header) this server answers for",
+	"root":                                 "Directory request paths are resolved against",
+	"alias":                                "Directory that replaces the matched location prefix, unlike root which the full URI is appended to",
+	"index":                                "File served when a directory is requested",
+	"location":                             "Settings for requests whose URI matches this prefix or pattern",
+	"try_files":                            "Serve the first of these that exists: the file, the directory, else a 404",
+	"proxy_pass":                           "Forward the request to this backend",
+	"grpc_pass":                            "Forward the request to this gRPC backend over HTTP/2",
+	"proxy_http_version":                   "Talk HTTP/1.1 to the backend, needed for keepalive and WebSockets",
+	"proxy_set_header Upgrade":             "Pass the client's protocol upgrade request (WebSockets) to the backend",
+	"proxy_set_header Connection":          "Keep the Connection header the backend needs for upgrades or keepalive",
+	"proxy_set_header Host":                "Host header sent to the backend; $host is the site the client asked for, $proxy_host the backend's own name",
+	"proxy_set_header X-Real-IP":           "Tell the backend the client's IP; otherwise it only sees nginx",
+	"proxy_set_header X-Forwarded-For":     "Append the client IP to the chain of proxies the request passed through",
+	"proxy_set_header X-Forwarded-Proto":   "Tell the backend whether the client used http or https, e.g. for redirects",
+	"proxy_set_header X-Forwarded-Host":    "Tell the backend the host name the client asked for",
+	"proxy_set_header X-Forwarded-Port":    "Tell the backend the port the client connected to",
+	"proxy_cache_bypass":                   "Skip the cache for upgrade (WebSocket) requests",
+	"proxy_redirect":                       "Leave Location headers from the backend unchanged",
+	"proxy_ssl_server_name":                "Send SNI to an HTTPS backend so it presents the right certificate",
+	"proxy_ssl_name":                       "Server name used for SNI and certificate verification",
+	"proxy_ssl_verify":                     "Reject the backend if its certificate is not trusted",
+	"proxy_ssl_trusted_certificate":        "CA bundle used to verify the backend certificate",
+	"proxy_cache":                          "Store backend responses in this cache zone",
+	"proxy_cache_key":                      "What identifies a cached response",
+	"proxy_cache_valid":                    "How long responses with these status codes stay cached",
+	"proxy_cache_use_stale":                "Serve an expired cached copy while the backend is failing or being refreshed",
+	"proxy_next_upstream":                  "When to retry the request on the next upstream server",
+	"proxy_intercept_errors":               "Let error_page handle error responses from the backend",
+	"grpc_intercept_errors":                "Let error_page handle error responses from the gRPC backend",
+	"resolver":                             "DNS servers used to look the backend up again at runtime",
+	"set":                                  "Store a value in a variable",
+	"rewrite":                              "Rewrite the URI matching this regex; break stops, last searches the locations again",
+	"if":                                   "Run the enclosed directives only when the condition holds",
+	"return":                               "Stop processing and send this status and URL or text",
+	"expires":                              "Set Expires and Cache-Control max-age so browsers cache these files",
+	"add_header Cache-Control":             "Allow browsers and shared caches to store these files",
+	"add_header Strict-Transport-Security": "Tell browsers to use https for this site from now on",
+	"add_header X-Frame-Options":           "Forbid other sites from embedding these pages in frames",
+	"add_header X-Content-Type-Options":    "Stop browsers guessing content types (MIME sniffing)",
+	"add_header Referrer-Policy":           "Limit how much of the URL is sent as Referer to other sites",
+	"add_header":                           "Add this response header; 'always' includes error responses",
+	"deny":                                 "Refuse matching clients with 403 Forbidden",
+	"allow":                                "Let clients from this address or network in",
+	"satisfy":                              "Whether a client must pass all access checks or any one of them",
+	"auth_basic":                           "Ask for a user name and password; the text is shown in the prompt",
+	"auth_basic_user_file":                 "htpasswd file holding the accepted users",
+	"auth_request":                         "Ask this internal location whether the request is allowed first",
+	"auth_request_set":                     "Copy a value from the auth response into a variable",
+	"internal":                             "Only reachable through internal redirects, never directly by clients",
+	"error_page":                           "Show this page instead of the default error for these status codes",
+	"limit_conn":                           "Cap the number of simultaneous connections per client",
+	"proxy_pass_request_body":              "Do not send the request body to the auth service",
+	"proxy_set_header Content-Length":      "The auth subrequest has no body, so clear its length",
+	"proxy_set_header X-Original-URI":      "Tell the auth service which URI is being requested",
+	"proxy_set_header X-Original-Method":   "Tell the auth service which method is being used",
+	"upstream":                             "A named group of backends proxy_pass can balance across",
+	"keepalive":                            "Idle connections to the backends kept open for reuse",
+	"geo":                                  "Set a variable from the client address; 1 marks the blocked networks",
+	"log_format":                           "A named access log line layout that access_log can refer to",
+	"access_log":                           "Where requests are logged, in which format, and how writes are buffered",
+	"underscores_in_headers":               "Accept request headers with underscores instead of silently dropping them",
+	"large_client_header_buffers":          "Number and size of buffers for long request lines and headers; beyond them nginx answers 400 or 414",
+	"proxy_buffer_size":                    "Buffer for the backend's response headers; too small and large headers fail with 502",
+	"proxy_buffers":                        "Buffers for the backend's response body, kept large enough for proxy_buffer_size",
+	"grpc_buffer_size":                     "Buffer for the gRPC backend's response headers",
+	"gzip":                                 "Compress responses with gzip for clients that accept it",
+	"gzip_vary":                            "Send Vary: Accept-Encoding so caches keep compressed and plain copies apart",
+	"gzip_types":                           "MIME types to compress besides text/html",
+	"brotli":                               "Compress responses with Brotli for clients that accept it",
+	"brotli_comp_level":                    "Brotli compression level, from 1 (fastest) to 11 (smallest)",
+	"brotli_types":                         "MIME types to compress with Brotli besides text/html",
+	"map":                                  "Set a variable from another value, evaluated when first used",
+	"limit_conn_zone":                      "Shared memory that tracks connections per client for limit_conn",
+	"proxy_cache_path":                     "Where cached responses are stored on disk and the zone holding their keys",
+	"dav_methods":                          "WebDAV methods clients may use to upload, delete, copy and move files",
+	"dav_access":                           "Permissions given to files and directories created through WebDAV",
+	"create_full_put_path":                 "Create missing parent directories when a file is uploaded with PUT",
+	"client_body_temp_path":                "Directory uploads are written to before they are moved into place",
+	"client_max_body_size":                 "Largest request body accepted; 0 means no limit",
+	"limit_except":                         "Apply the enclosed rules to every method except the ones listed",
+}
+
+// Explain returns block with a comment above the first occurrence of each
+// directive it knows, describing what the directive does. It is meant for
+// previews; the comments are never written to nginx.conf.
+func Explain(block string) string {
+	lines := strings.Split(block, "\n")
+	out := make([]string, 0, len(lines)*2)
+	seen := make(map[string]bool)
+	for _, line := range lines {
+		trimmed := strings.TrimLeft(line, " \t")
+		fields := strings.Fields(strings.TrimRight(trimmed, ";{"))
+		if len(fields) > 0 && !strings.HasPrefix(fields[0], "#") {
+			key := fields[0]
+			if key == "server" && !strings.HasSuffix(trimmed, "{") {
+				key = "upstream server"
+			}
+			if len(fields) > 1 && (key == "proxy_set_header" || key == "add_header") {
+				if _, ok := explanations[key+" "+fields[1]]; ok {
+					key += " " + fields[1]
+				}
+			}
+			if text, ok := explanations[key]; ok && !seen[key] {
+				seen[key] = true
+				out = append(out, line[:len(line)-len(trimmed)]+"# "+text)
+			}
+		}
+		out = append(out, line)
+	}
+	return strings.Join(out, "\n")
+}
@@ -0,0 +1,50 @@
+package generator
+
+import (
+	"fmt"
+	"nginx_tool/internal/config"
+	"os"
+)
+
+// FormatConfig returns nginxPath pretty-printed by config.FormatNginxIndent,
+// indented with g.Indent.
+func (g *Generator) FormatConfig(nginxPath string) (string, error) {
+	content, err := readConfig(nginxPath)
+	if err != nil {
+		return "", err
+	}
+	root, err := config.ParseNginx(content)
+	if err != nil {
+		return "", fmt.Errorf("failed to parse nginx configuration: %w", err)
+	}
+	indent := g.Indent
+	if indent == "" {
+		indent = "    "
+	}
+	return config.FormatNginxIndent(root, indent), nil
+}
+
+// FormatNginxFile rewrites nginxPath in canonical formatting, taking a backup
+// first when backup is set.
+func (g *Generator) FormatNginxFile(nginxPath string, backup bool) (*Result, error) {
+	if err := checkWritable(nginxPath); err != nil {
+		return nil, err
+	}
+
+	formatted, err := g.FormatConfig(nginxPath)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &Result{}
+	if backup {
+		if err := g.backup(nginxPath, result); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := os.WriteFile(nginxPath, []byte(formatted), 0644); err != nil {
+		return result, result.withBackup(fmt.Errorf("failed to write nginx config: %w", err))
+	}
+	return result, nil
+}
@@ -0,0 +1,61 @@
+package generator
+
+import (
+	"fmt"
+	"nginx_tool/internal/config"
+	"strings"
+	"time"
+)
+
+// fullConfigSkeleton is the nginx.conf GenerateFullConfig starts from. The
+// paths follow the Debian and upstream nginx packages.
+const fullConfigSkeleton = `user %s;
+worker_processes auto;
+pid /run/nginx.pid;
+error_log /var/log/nginx/error.log warn;
+
+events {
+    worker_connections 1024;
+}
+
+http {
+    include mime.types;
+    default_type application/octet-stream;
+
+    sendfile on;
+    tcp_nopush on;
+    keepalive_timeout 65;
+
+    access_log /var/log/nginx/access.log;
+}
+`
+
+// GenerateFullConfig renders a complete nginx.conf holding the server blocks
+// of cfgs, for hosts that have no configuration yet. The worker processes
+// run as user. The blocks are checked against each other as they would be
+// when added to an existing file, and with Harden the http block gets the
+// hardening directives too.
+func (g *Generator) GenerateFullConfig(cfgs []*config.ServerConfig, serverType, user string) (string, error) {
+	content := reindent(fmt.Sprintf(fullConfigSkeleton, user), g.Indent)
+	if g.Banner {
+		content = fmt.Sprintf("# Generated by nginx-tool %s on %s\n", g.Version, time.Now().UTC().Format(time.RFC3339)) + content
+	}
+
+	for _, cfg := range cfgs {
+		serverBlock, err := g.GenerateServerBlock(cfg, serverType)
+		if err != nil {
+			return "", err
+		}
+		if content, err = InsertServerBlockAt(content, serverBlock, false); err != nil {
+			return "", fmt.Errorf("failed to add server block for %s: %w", strings.Join(cfg.Names(), " "), err)
+		}
+	}
+
+	if g.Harden {
+		var err error
+		if content, _, err = HardenHTTPBlock(content); err != nil {
+			return "", fmt.Errorf("failed to harden http block: %w", err)
+		}
+	}
+	return content, nil
+}
@@ -1,134 +1,258 @@
 package generator
 
 import (
+	"errors"
 	"fmt"
-	"io"
 	"nginx_tool/internal/config"
 	"os"
-	"regexp"
 	"strings"
 	"time"
 )
 
-type Generator struct{}
+var ErrConflict = errors.New("server block conflict")
+
+type Generator struct {
+	Banner       bool
+	Version      string
+	Reapply      bool
+	TemplatePath string
+	BackupReuse  time.Duration
+	Top          bool
+	Harden       bool
+	// Replace makes AddServersToNginx replace a block with the same
+	// server_name in place, as UpdateServerBlock does, and add the block
+	// only where there is none.
+	Replace bool
+	// CommentOut makes RemoveServerFromNginx comment matching blocks out
+	// instead of deleting them.
+	CommentOut bool
+	// Indent is one level of indentation in generated blocks. Empty means
+	// four spaces, which is what the templates are written in.
+	Indent string
+	// OutputDir makes AddServersToNginx write each server block to a file
+	// of its own in this directory and include them from nginx.conf.
+	OutputDir string
+	// HTTP2Listen writes http2 as a listen parameter, as nginx before
+	// 1.25.1 requires, instead of "http2 on;" in the server block.
+	HTTP2Listen bool
+	// Match, if set, is the server_name UpdateServerBlock and PreviewUpdate
+	// look for instead of the config's own names, so a block can be renamed.
+	Match []string
+	// OnBackup, if set, is called with the backup path as soon as a backup
+	// was taken, before nginx.conf is written.
+	OnBackup func(path string, reused bool)
+}
 
 func New() *Generator {
-	return &Generator{}
+	return &Generator{Banner: true, Version: "dev"}
 }
 
-func (g *Generator) AddServerToNginx(cfg *config.ServerConfig, nginxPath, serverType string, backup bool) error {
-	if backup {
-		backupPath := fmt.Sprintf("%s.backup.%d", nginxPath, time.Now().Unix())
-		if err := g.copyFile(nginxPath, backupPath); err != nil {
-			return fmt.Errorf("failed to create backup: %w", err)
+type Result struct {
+	ServerBlocks []string
+	BackupPath   string
+	BackupReused bool
+	Replaced     int
+	// Hardened lists the http-level directives -harden added or rewrote.
+	Hardened []string
+	// Lines holds the line of each server block in the written file, in
+	// the order of the configs, or 0 where it could not be located.
+	Lines []int
+	// Files holds the file each server block was written to when they go
+	// to an output directory instead of nginx.conf.
+	Files []string
+}
+
+func (g *Generator) AddServerToNginx(cfg *config.ServerConfig, nginxPath, serverType string, backup bool) (*Result, error) {
+	return g.AddServersToNginx([]*config.ServerConfig{cfg}, nginxPath, serverType, backup)
+}
+
+func (g *Generator) AddServersToNginx(cfgs []*config.ServerConfig, nginxPath, serverType string, backup bool) (*Result, error) {
+	if g.OutputDir != "" {
+		return g.WriteServerFiles(cfgs, nginxPath, serverType, g.OutputDir, backup)
+	}
+	if err := checkWritable(nginxPath); err != nil {
+		return nil, err
+	}
+
+	result := &Result{ServerBlocks: make([]string, 0, len(cfgs))}
+	for _, cfg := range cfgs {
+		serverBlock, err := g.GenerateServerBlock(cfg, serverType)
+		if err != nil {
+			return nil, err
 		}
-		fmt.Printf("📋 Backup created: %s\n", backupPath)
+		result.ServerBlocks = append(result.ServerBlocks, serverBlock)
 	}
 
-	file, err := os.Open(nginxPath)
+	modifiedContent, err := readConfig(nginxPath)
 	if err != nil {
-		return fmt.Errorf("failed to read nginx config: %w", err)
+		return nil, err
+	}
+
+	for i := range result.ServerBlocks {
+		// Blocks inserted at the top go in reverse so they keep their order.
+		serverBlock := result.ServerBlocks[i]
+		if g.Top {
+			serverBlock = result.ServerBlocks[len(result.ServerBlocks)-1-i]
+		}
+		var replaced bool
+		switch {
+		case g.Replace:
+			modifiedContent, replaced, err = replaceServerBlock(modifiedContent, serverBlock, g.Top)
+		case g.Reapply:
+			modifiedContent, replaced, err = reapplyServerBlock(modifiedContent, serverBlock, g.Top)
+		default:
+			modifiedContent, err = InsertServerBlockAt(modifiedContent, serverBlock, g.Top)
+		}
+		if replaced {
+			result.Replaced++
+		}
+		if err != nil {
+			return result, fmt.Errorf("failed to add server block: %w", err)
+		}
+	}
+
+	if g.Harden {
+		modifiedContent, result.Hardened, err = HardenHTTPBlock(modifiedContent)
+		if err != nil {
+			return result, fmt.Errorf("failed to harden http block: %w", err)
+		}
+	}
+
+	// The backup is only taken once the new content is ready, so a
+	// conflict never leaves one behind.
+	if backup {
+		if err := g.backup(nginxPath, result); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := os.WriteFile(nginxPath, []byte(modifiedContent), 0644); err != nil {
+		return result, result.withBackup(fmt.Errorf("failed to write nginx config: %w", err))
 	}
 
-	nginxContent, err := io.ReadAll(file)
-	file.Close()
+	for _, serverBlock := range result.ServerBlocks {
+		result.Lines = append(result.Lines, blockLine(modifiedContent, serverBlock))
+	}
+	return result, nil
+}
+
+// blockLine returns the line on which the server directive of serverBlock
+// starts in content, or 0 when it is not there.
+func blockLine(content, serverBlock string) int {
+	added, err := parseDirectives(serverBlock)
 	if err != nil {
-		return fmt.Errorf("failed to read nginx config: %w", err)
+		return 0
+	}
+	for _, d := range added {
+		if d.name != "server" {
+			continue
+		}
+		if i := strings.Index(content, serverBlock[d.start:d.end]); i >= 0 {
+			return strings.Count(content[:i], "\n") + 1
+		}
+	}
+	return 0
+}
+
+func (g *Generator) GenerateServerBlock(cfg *config.ServerConfig, serverType string) (string, error) {
+	if serverType == "redirect" && cfg.RedirectTo == "" {
+		return "", fmt.Errorf("redirect servers need redirect_to, an absolute URL such as https://example.com")
 	}
 
 	var serverBlock string
-	switch serverType {
-	case "static":
-		serverBlock = g.GenerateStaticServerBlock(cfg)
-	case "proxy":
-		serverBlock = g.GenerateProxyServerBlock(cfg)
+	var err error
+	switch {
+	case g.TemplatePath != "":
+		serverBlock, err = g.GenerateFromTemplate(cfg, g.TemplatePath)
+	case serverType == "static":
+		serverBlock, err = g.GenerateStaticServerBlock(cfg)
+	case serverType == "proxy":
+		serverBlock, err = g.GenerateProxyServerBlock(cfg)
+	case serverType == "grpc":
+		serverBlock, err = g.renderBuiltin("grpc", cfg)
+	case serverType == "redirect":
+		serverBlock, err = g.GenerateRedirectServerBlock(cfg)
 	default:
-		return fmt.Errorf("unsupported server type: %s", serverType)
+		return "", fmt.Errorf("unsupported server type: %s", serverType)
 	}
-
-	modifiedContent, err := g.addServerBlock(string(nginxContent), serverBlock)
 	if err != nil {
-		return fmt.Errorf("failed to add server block: %w", err)
+		return "", err
 	}
 
-	if err := os.WriteFile(nginxPath, []byte(modifiedContent), 0644); err != nil {
-		return fmt.Errorf("failed to write nginx config: %w", err)
+	blocks := append(g.httpDirectives(cfg), serverBlock)
+	block := reindent(strings.Join(blocks, "\n\n"), g.Indent)
+	if err := validateBlock(block); err != nil {
+		return "", fmt.Errorf("generated server block is malformed: %w", err)
 	}
+	return block, nil
+}
 
-	return nil
+func (g *Generator) GenerateStaticServerBlock(cfg *config.ServerConfig) (string, error) {
+	return g.renderBuiltin("static", cfg)
 }
 
-func (g *Generator) GenerateStaticServerBlock(cfg *config.ServerConfig) string {
-	return fmt.Sprintf(`    server {
-        listen %s;
-        server_name %s;
-        root %s;
-        index %s;
-        location / {
-            try_files $uri $uri/ =404;
-        }
-    }`, cfg.Listen, cfg.ServerName, cfg.Root, cfg.Index)
-}
-
-func (g *Generator) GenerateProxyServerBlock(cfg *config.ServerConfig) string {
-	proxyTarget := cfg.ProxyPass
-	if proxyTarget == "" && cfg.ProxyPort != "" {
-		proxyTarget = fmt.Sprintf("http://127.0.0.1:%s", cfg.ProxyPort)
-	}
-
-	return fmt.Sprintf(`    server {
-        listen %s;
-        server_name %s;
-        # Proxy all requests to %s
-        location / {
-            proxy_pass %s;
-            proxy_http_version 1.1;
-            proxy_set_header Upgrade $http_upgrade;
-            proxy_set_header Connection 'upgrade';
-            proxy_set_header Host $host;
-            proxy_set_header X-Real-IP $remote_addr;
-            proxy_set_header X-Forwarded-For $proxy_add_x_forwarded_for;
-            proxy_set_header X-Forwarded-Proto $scheme;
-            proxy_set_header X-Forwarded-Host $host;
-            proxy_set_header X-Forwarded-Port $server_port;
-            proxy_cache_bypass $http_upgrade;
-            proxy_redirect off;
-        }
-    }`, cfg.Listen, cfg.ServerName, proxyTarget, proxyTarget)
+func (g *Generator) GenerateProxyServerBlock(cfg *config.ServerConfig) (string, error) {
+	return g.renderBuiltin("proxy", cfg)
 }
 
-func (g *Generator) GeneratePreview(nginxPath, serverBlock string) (string, error) {
-	file, err := os.Open(nginxPath)
+func (g *Generator) GenerateRedirectServerBlock(cfg *config.ServerConfig) (string, error) {
+	return g.renderBuiltin("redirect", cfg)
+}
+
+func (g *Generator) renderBuiltin(serverType string, cfg *config.ServerConfig) (string, error) {
+	tmpl, err := builtinTemplate(serverType)
 	if err != nil {
-		return "", fmt.Errorf("failed to read nginx config: %w", err)
+		return "", err
 	}
-	defer file.Close()
+	data := newTemplateData(cfg)
+	g.setHTTP2(&data, serverType == "grpc")
+	return g.render(tmpl, cfg, data)
+}
 
-	nginxContent, err := io.ReadAll(file)
+func (g *Generator) GeneratePreview(nginxPath, serverBlock string) (string, error) {
+	content, err := readConfig(nginxPath)
 	if err != nil {
-		return "", fmt.Errorf("failed to read nginx config: %w", err)
+		return "", err
 	}
+	return renderPreview(content, serverBlock, g.Reapply, g.Replace, g.Top)
+}
 
-	content := string(nginxContent)
+// RenderPreview shows where serverBlock would land in content, with the
+// surrounding configuration abbreviated.
+func RenderPreview(content, serverBlock string) (string, error) {
+	return renderPreview(content, serverBlock, false, false, false)
+}
 
-	httpRegex := regexp.MustCompile(`(?s)(http\s*\{)(.*?)(\})`)
-	matches := httpRegex.FindStringSubmatch(content)
+func renderPreview(content, serverBlock string, reapply, replace, top bool) (string, error) {
+	http, err := findHTTPBlock(content)
+	if err != nil {
+		return "", err
+	}
 
-	if len(matches) != 4 {
-		return "", fmt.Errorf("could not find http section in nginx configuration")
+	var replacing []*directive
+	switch {
+	case replace:
+		replacing, err = namedServers(http, serverBlock)
+	case reapply:
+		replacing, err = replacedServers(content, http, serverBlock)
+	}
+	if err != nil {
+		return "", err
 	}
 
-	httpStart := matches[1]
-	httpContent := matches[2]
-	httpEnd := matches[3]
+	serverBlock, _, err = prepareBlock(content, http, serverBlock, replacing)
+	if err != nil {
+		return "", err
+	}
 
-	serverRegex := regexp.MustCompile(`(?s)server\s*\{`)
-	existingServers := serverRegex.FindAllString(httpContent, -1)
-	serverCount := len(existingServers)
+	httpStart := content[http.start:http.bodyStart]
+	httpContent := content[http.bodyStart:http.bodyEnd]
+	httpEnd := content[http.bodyEnd:http.end]
+	serverCount := len(http.find("server"))
 
 	var preview strings.Builder
 
-	beforeHttp := strings.Split(content, httpStart)[0]
+	beforeHttp := content[:http.start]
 	beforeLines := strings.Split(strings.TrimSpace(beforeHttp), "\n")
 	if len(beforeLines) > 3 {
 		preview.WriteString("...\n")
@@ -138,28 +262,53 @@ func (g *Generator) GeneratePreview(nginxPath, serverBlock string) (string, erro
 		preview.WriteString(beforeHttp)
 	}
 
-	preview.WriteString(httpStart)
-	preview.WriteString("\n")
-
+	var existing strings.Builder
 	if serverCount > 0 {
-		preview.WriteString(fmt.Sprintf("    # ... (%d existing server block(s)) ...\n", serverCount))
-		preview.WriteString("\n")
+		existing.WriteString(fmt.Sprintf("    # ... (%d existing server block(s)) ...\n", serverCount))
 	} else {
 		httpLines := strings.Split(strings.TrimSpace(httpContent), "\n")
 		if len(httpLines) > 0 && strings.TrimSpace(httpLines[0]) != "" {
-			preview.WriteString("    # ... (existing http directives) ...\n")
-			preview.WriteString("\n")
+			existing.WriteString("    # ... (existing http directives) ...\n")
+		}
+	}
+
+	var added strings.Builder
+	if len(replacing) > 0 {
+		lines := make([]string, 0, len(replacing))
+		for _, server := range replacing {
+			lines = append(lines, fmt.Sprint(server.line))
 		}
+		added.WriteString(fmt.Sprintf("    # === UPDATED SERVER BLOCK (replaces line %s) ===\n", strings.Join(lines, ", ")))
+	} else {
+		added.WriteString("    # === NEW SERVER BLOCK ===\n")
+	}
+	added.WriteString(serverBlock)
+	added.WriteString("\n")
+	if len(replacing) > 0 {
+		added.WriteString("    # === END UPDATED BLOCK ===\n")
+	} else {
+		added.WriteString("    # === END NEW BLOCK ===\n")
 	}
 
-	preview.WriteString("    # === NEW SERVER BLOCK ===\n")
-	preview.WriteString(serverBlock)
+	preview.WriteString(httpStart)
 	preview.WriteString("\n")
-	preview.WriteString("    # === END NEW BLOCK ===\n")
+	sections := []string{existing.String(), added.String()}
+	if top && len(replacing) == 0 {
+		sections[0], sections[1] = sections[1], sections[0]
+	}
+	for i, section := range sections {
+		if section == "" {
+			continue
+		}
+		preview.WriteString(section)
+		if i == 0 {
+			preview.WriteString("\n")
+		}
+	}
 
 	preview.WriteString(httpEnd)
 
-	afterHttp := strings.Split(content, httpEnd)[1]
+	afterHttp := content[http.end:]
 	if strings.TrimSpace(afterHttp) != "" {
 		afterLines := strings.Split(strings.TrimSpace(afterHttp), "\n")
 		if len(afterLines) > 2 {
@@ -174,39 +323,84 @@ func (g *Generator) GeneratePreview(nginxPath, serverBlock string) (string, erro
 	return preview.String(), nil
 }
 
-func (g *Generator) addServerBlock(nginxContent, serverBlock string) (string, error) {
-	httpRegex := regexp.MustCompile(`(?s)(http\s*\{)(.*?)(\})`)
-	matches := httpRegex.FindStringSubmatch(nginxContent)
+// InsertServerBlock appends serverBlock to the end of the http section of
+// nginxContent without touching the filesystem.
+func InsertServerBlock(nginxContent, serverBlock string) (string, error) {
+	return InsertServerBlockAt(nginxContent, serverBlock, false)
+}
 
-	if len(matches) != 4 {
-		return "", fmt.Errorf("could not find http section in nginx configuration")
+// InsertServerBlockAt inserts serverBlock at the top of the http section,
+// right after "http {", when top is set, and appends it otherwise.
+func InsertServerBlockAt(nginxContent, serverBlock string, top bool) (string, error) {
+	http, err := findHTTPBlock(nginxContent)
+	if err != nil {
+		return "", err
+	}
+	serverBlock, _, err = prepareBlock(nginxContent, http, serverBlock, nil)
+	if err != nil {
+		return "", err
 	}
 
-	httpStart := matches[1]
-	httpContent := matches[2]
-	httpEnd := matches[3]
+	if top {
+		return nginxContent[:http.bodyStart] + "\n" + serverBlock + "\n" + nginxContent[http.bodyStart:], nil
+	}
 
-	httpContent = strings.TrimRight(httpContent, " \t\n")
+	httpContent := strings.TrimRight(nginxContent[http.bodyStart:http.bodyEnd], " \t\n")
 	newHttpContent := httpContent + "\n\n" + serverBlock + "\n"
 
-	result := httpRegex.ReplaceAllString(nginxContent, httpStart+newHttpContent+httpEnd)
-
-	return result, nil
+	return nginxContent[:http.bodyStart] + newHttpContent + nginxContent[http.bodyEnd:], nil
 }
 
-func (g *Generator) copyFile(src, dst string) error {
-	srcFile, err := os.Open(src)
+func (g *Generator) ValidateNginxConfig(nginxPath string) error {
+	content, err := readConfig(nginxPath)
 	if err != nil {
 		return err
 	}
-	defer srcFile.Close()
+	_, err = findHTTPBlock(content)
+	return err
+}
 
-	dstFile, err := os.Create(dst)
+func findHTTPBlock(content string) (*directive, error) {
+	directives, err := parseDirectives(content)
 	if err != nil {
-		return err
+		return nil, fmt.Errorf("failed to parse nginx configuration: %w", err)
 	}
-	defer dstFile.Close()
 
-	_, err = io.Copy(dstFile, srcFile)
-	return err
+	for _, d := range directives {
+		if d.name == "http" && d.isBlock() {
+			return d, nil
+		}
+	}
+
+	if includes := topLevelIncludes(directives); len(includes) > 0 {
+		return nil, fmt.Errorf("%w; it includes %s, which may define it", ErrNoHTTPBlock, strings.Join(includes, ", "))
+	}
+	return nil, ErrNoHTTPBlock
+}
+
+func checkBlockConflicts(http *directive, serverBlock string, replacing []*directive) error {
+	added, err := parseDirectives(serverBlock)
+	if err != nil {
+		return fmt.Errorf("generated server block is malformed: %w", err)
+	}
+
+	existing := make([]*directive, 0, len(http.children))
+	for _, d := range http.children {
+		if !containsDirective(replacing, d) {
+			existing = append(existing, d)
+		}
+	}
+	if err := checkConflicts(existing, added); err != nil {
+		return fmt.Errorf("%w: %w", ErrConflict, err)
+	}
+	return nil
+}
+
+func containsDirective(list []*directive, d *directive) bool {
+	for _, item := range list {
+		if item == d {
+			return true
+		}
+	}
+	return false
 }
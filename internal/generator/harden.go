@@ -0,0 +1,35 @@
+package generator
+
+import "strings"
+
+// hardeningDirectives are the http-level settings enforced by -harden.
+var hardeningDirectives = [][2]string{
+	{"server_tokens", "off"},
+}
+
+// HardenHTTPBlock makes sure the http section of content sets every
+// hardening directive. Existing directives with another value are rewritten
+// in place and missing ones are added right after "http {", so running it
+// again changes nothing. It returns the directives it changed.
+func HardenHTTPBlock(content string) (string, []string, error) {
+	var changed []string
+	for _, setting := range hardeningDirectives {
+		http, err := findHTTPBlock(content)
+		if err != nil {
+			return "", nil, err
+		}
+
+		line := setting[0] + " " + setting[1] + ";"
+		existing := http.find(setting[0])
+		switch {
+		case len(existing) == 0:
+			content = content[:http.bodyStart] + "\n    " + line + content[http.bodyStart:]
+		case strings.Join(existing[0].args, " ") != setting[1]:
+			content = content[:existing[0].start] + line + content[existing[0].end:]
+		default:
+			continue
+		}
+		changed = append(changed, line)
+	}
+	return content, changed, nil
+}
@@ -0,0 +1,102 @@
+package generator
+
+import (
+	"nginx_tool/internal/config"
+	"sort"
+	"strings"
+)
+
+// defaultCompressTypes are compressed by gzip and brotli besides text/html,
+// which both always compress.
+var defaultCompressTypes = []string{
+	"text/plain", "text/css", "text/xml", "text/javascript",
+	"application/javascript", "application/json", "application/xml",
+	"application/rss+xml", "image/svg+xml",
+}
+
+// Header is a response header added with add_header ... always. Value is
+// already quoted for nginx.
+type Header struct {
+	Name  string
+	Value string
+}
+
+// responseHeaders returns the security preset, when enabled, followed by the
+// custom headers. A custom header replaces a preset one of the same name.
+// HSTS is only sent by servers that listen with ssl.
+func responseHeaders(cfg *config.ServerConfig) []Header {
+	var headers []Header
+	if cfg.SecurityHeaders {
+		if cfg.SSL() {
+			headers = append(headers, Header{"Strict-Transport-Security", "max-age=31536000; includeSubDomains"})
+		}
+		headers = append(headers,
+			Header{"X-Frame-Options", "SAMEORIGIN"},
+			Header{"X-Content-Type-Options", "nosniff"},
+			Header{"Referrer-Policy", "strict-origin-when-cross-origin"},
+		)
+	}
+
+	names := make([]string, 0, len(cfg.Headers))
+	for name := range cfg.Headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		headers = removeHeader(headers, name)
+		headers = append(headers, Header{name, cfg.Headers[name]})
+	}
+
+	for i := range headers {
+		headers[i].Value = quoteArg(headers[i].Value)
+	}
+	return headers
+}
+
+func removeHeader(headers []Header, name string) []Header {
+	kept := headers[:0]
+	for _, h := range headers {
+		if !strings.EqualFold(h.Name, name) {
+			kept = append(kept, h)
+		}
+	}
+	return kept
+}
+
+// AuthHeader passes an identity header from the auth_request response on to
+// the backend.
+type AuthHeader struct {
+	Header   string
+	Variable string
+	Upstream string
+}
+
+func authHeaders(cfg *config.ServerConfig) []AuthHeader {
+	if cfg.AuthRequest == "" {
+		return nil
+	}
+	names := cfg.AuthHeaders
+	if len(names) == 0 {
+		names = []string{"X-Auth-Request-User", "X-Auth-Request-Email"}
+	}
+
+	headers := make([]AuthHeader, 0, len(names))
+	for _, name := range names {
+		suffix := strings.ToLower(strings.ReplaceAll(name, "-", "_"))
+		headers = append(headers, AuthHeader{
+			Header:   name,
+			Variable: "$auth_" + strings.TrimPrefix(suffix, "x_"),
+			Upstream: "$upstream_http_" + suffix,
+		})
+	}
+	return headers
+}
+
+// headerBuffers returns the large_client_header_buffers arguments. A bare
+// size gets nginx's default count of 4 buffers.
+func headerBuffers(cfg *config.ServerConfig) string {
+	if strings.Contains(cfg.HeaderBuffers, " ") {
+		return cfg.HeaderBuffers
+	}
+	return "4 " + cfg.HeaderBuffers
+}
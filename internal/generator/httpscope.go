@@ -0,0 +1,304 @@
+package generator
+
+import (
+	"fmt"
+	"nginx_tool/internal/config"
+	"sort"
+	"strings"
+)
+
+// httpDirectives renders the http-scope blocks a server depends on. They are
+// emitted ahead of the server block and inserted alongside it.
+func (g *Generator) httpDirectives(cfg *config.ServerConfig) []string {
+	var blocks []string
+	for _, m := range cfg.Maps {
+		blocks = append(blocks, renderMap(m))
+	}
+	if len(cfg.Blocklist) > 0 {
+		blocks = append(blocks, renderBlocklist(cfg))
+	}
+	if upstream, _ := upstreamFor(cfg); upstream != nil {
+		blocks = append(blocks, renderUpstream(upstream))
+	}
+	for _, upstream := range locationUpstreams(cfg) {
+		blocks = append(blocks, renderUpstream(upstream))
+	}
+	if cfg.LimitConn > 0 {
+		blocks = append(blocks, renderLimitConnZone(cfg))
+	}
+	if cfg.ProxyCache != nil {
+		blocks = append(blocks, renderCachePath(cfg))
+	}
+	if cfg.AccessLog != nil && cfg.AccessLog.Format != "" {
+		blocks = append(blocks, renderLogFormat(cfg))
+	}
+	if cfg.Underscores {
+		blocks = append(blocks, "    underscores_in_headers on;")
+	}
+	if cfg.HeaderBuffers != "" {
+		blocks = append(blocks, "    large_client_header_buffers "+headerBuffers(cfg)+";")
+	}
+	return blocks
+}
+
+func renderMap(m config.MapConfig) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "    map %s %s {\n", m.Source, m.Variable)
+	if m.Default != "" {
+		fmt.Fprintf(&b, "        default %s;\n", quoteArg(m.Default))
+	}
+
+	keys := make([]string, 0, len(m.Entries))
+	for key := range m.Entries {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		fmt.Fprintf(&b, "        %s %s;\n", quoteArg(key), quoteArg(m.Entries[key]))
+	}
+
+	b.WriteString("    }")
+	return b.String()
+}
+
+func quoteArg(arg string) string {
+	if arg == "" || strings.ContainsAny(arg, " \t;{}#'\"") {
+		return `"` + strings.ReplaceAll(arg, `"`, `\"`) + `"`
+	}
+	return arg
+}
+
+// prepareBlock checks serverBlock against the existing http section of
+// content. An http-scope block that is already defined there the same way
+// is dropped, so shared maps and zones are only declared once. One that is
+// defined differently is a conflict, unless servers are being replaced: the
+// servers listed in replacing are about to be overwritten, so the blocks
+// they own, and the definitions only they used, are returned as stale, to
+// be removed along with them.
+func prepareBlock(content string, http *directive, serverBlock string, replacing []*directive) (string, []*directive, error) {
+	if err := checkBlockConflicts(http, serverBlock, replacing); err != nil {
+		return "", nil, err
+	}
+
+	added, err := parseDirectives(serverBlock)
+	if err != nil {
+		return "", nil, fmt.Errorf("generated server block is malformed: %w", err)
+	}
+
+	type definition struct {
+		d    *directive
+		text string
+	}
+	defined := make(map[string]definition)
+	for _, d := range http.children {
+		if d.name != "server" {
+			defined[definitionKey(d)] = definition{d, definitionText(content, d)}
+		}
+	}
+
+	var duplicates, stale []*directive
+	for _, d := range added {
+		if d.name == "server" {
+			continue
+		}
+		name := definitionKey(d)
+		text := definitionText(serverBlock, d)
+		other, exists := defined[name]
+		switch {
+		case !exists:
+		case other.text == text:
+			duplicates = append(duplicates, d)
+			continue
+		case containsDirective(http.children, other.d) && len(replacing) > 0 && replaceable(d):
+			stale = append(stale, other.d)
+		case containsDirective(http.children, other.d):
+			return "", nil, fmt.Errorf("%w: %s is already defined differently on line %d", ErrConflict, name, other.d.line)
+		default:
+			return "", nil, fmt.Errorf("%w: %s is defined differently by two of the new server blocks", ErrConflict, name)
+		}
+		defined[name] = definition{d, text}
+	}
+
+	if len(replacing) > 0 {
+		for _, d := range orphanedDefinitions(content, http, serverBlock, replacing) {
+			if !containsDirective(stale, d) {
+				stale = append(stale, d)
+			}
+		}
+	}
+	if len(duplicates) > 0 {
+		serverBlock = strings.TrimLeft(removeBlocks(serverBlock, duplicates), "\n")
+	}
+	return serverBlock, stale, nil
+}
+
+// orphanedDefinitions returns the http-level definitions, such as the
+// upstream, geo block or zone of a server, that only the servers in
+// replacing refer to and serverBlock no longer does, so a server that was
+// renamed, removed or lost a feature does not leave them behind. A
+// definition another server or http-level directive refers to is kept; one
+// only orphaned definitions refer to, such as a map a removed log_format
+// uses, goes with them.
+func orphanedDefinitions(content string, http *directive, serverBlock string, replacing []*directive) []*directive {
+	var orphaned []*directive
+	for found := true; found; {
+		found = false
+		for _, d := range http.children {
+			ref, ok := definitionRef(d)
+			if !ok || !replaceable(d) || containsDirective(orphaned, d) || refersTo(serverBlock, ref) {
+				continue
+			}
+			used, usedElsewhere := false, false
+			for _, other := range http.children {
+				if other == d || !refersTo(content[other.start:other.end], ref) {
+					continue
+				}
+				if containsDirective(replacing, other) || containsDirective(orphaned, other) {
+					used = true
+				} else {
+					usedElsewhere = true
+				}
+			}
+			if used && !usedElsewhere {
+				orphaned = append(orphaned, d)
+				found = true
+			}
+		}
+	}
+	return orphaned
+}
+
+// definitionRef is what servers refer to a definition by: the name of an
+// upstream, zone or log format, or the variable a map or geo block sets.
+func definitionRef(d *directive) (string, bool) {
+	switch d.name {
+	case "upstream", "log_format":
+		if len(d.args) > 0 {
+			return d.args[0], true
+		}
+	case "map", "geo":
+		if len(d.args) > 0 {
+			return d.args[len(d.args)-1], true
+		}
+	case "limit_conn_zone", "limit_req_zone":
+		return zoneArg(d, "zone=")
+	case "proxy_cache_path":
+		return zoneArg(d, "keys_zone=")
+	}
+	return "", false
+}
+
+func refersTo(text, ref string) bool {
+	if strings.HasPrefix(ref, "$") {
+		return usesVariable(text, ref)
+	}
+	return usesName(text, ref)
+}
+
+// ChangedDefinitions describes every http-level definition of current, a
+// block as CurrentServerBlock returns it, that writing serverBlock in its
+// place would change: one serverBlock defines differently, or one it no
+// longer refers to.
+func ChangedDefinitions(current, serverBlock string) ([]string, error) {
+	before, err := parseDirectives(current)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse server block: %w", err)
+	}
+	after, err := parseDirectives(serverBlock)
+	if err != nil {
+		return nil, fmt.Errorf("generated server block is malformed: %w", err)
+	}
+
+	regenerated := make(map[string]string)
+	for _, d := range after {
+		if d.name != "server" {
+			regenerated[definitionKey(d)] = definitionText(serverBlock, d)
+		}
+	}
+	var changes []string
+	for _, d := range before {
+		ref, ok := definitionRef(d)
+		if !ok {
+			continue
+		}
+		name := definitionKey(d)
+		text, defined := regenerated[name]
+		switch {
+		case defined && text != definitionText(current, d):
+			changes = append(changes, fmt.Sprintf("%s is rewritten as: %s", name, text))
+		case !defined && !refersTo(serverBlock, ref):
+			changes = append(changes, fmt.Sprintf("%s is removed unless another server uses it", name))
+		}
+	}
+	return changes, nil
+}
+
+// definitionKey is the definitionName of d, or its name and arguments for
+// any other http-level directive.
+func definitionKey(d *directive) string {
+	if name, ok := definitionName(d); ok {
+		return name
+	}
+	return d.name + " " + strings.Join(d.args, " ")
+}
+
+// definitionText is the text of d in content with its whitespace collapsed,
+// so blocks that only differ in indentation compare equal.
+func definitionText(content string, d *directive) string {
+	return strings.Join(strings.Fields(content[d.start:d.end]), " ")
+}
+
+// replaceServer puts serverBlock in the place of server in content and
+// removes the stale http-scope blocks prepareBlock returned for it.
+// serverBlock must already be prepared; generated is the block as it was
+// generated, and every http-scope block in it is checked to be in the
+// result, so a definition is never left out of date.
+func replaceServer(content string, server *directive, serverBlock, generated string, stale []*directive) (string, error) {
+	edits := append([]*directive{server}, stale...)
+	sort.Slice(edits, func(i, j int) bool {
+		return edits[i].start > edits[j].start
+	})
+	for _, d := range edits {
+		if d == server {
+			start, _ := blockBounds(content, d)
+			content = content[:start] + serverBlock + content[d.end:]
+			continue
+		}
+		content = removeBlocks(content, []*directive{d})
+	}
+
+	if err := checkDefinitions(content, generated); err != nil {
+		return "", err
+	}
+	return content, nil
+}
+
+// checkDefinitions verifies that every http-scope block of serverBlock is
+// defined in the http section of content exactly as generated.
+func checkDefinitions(content, serverBlock string) error {
+	http, err := findHTTPBlock(content)
+	if err != nil {
+		return err
+	}
+	added, err := parseDirectives(serverBlock)
+	if err != nil {
+		return fmt.Errorf("generated server block is malformed: %w", err)
+	}
+
+	current := make(map[string]string)
+	for _, d := range http.children {
+		if d.name != "server" {
+			current[definitionKey(d)] = definitionText(content, d)
+		}
+	}
+	for _, d := range added {
+		if d.name == "server" {
+			continue
+		}
+		name := definitionKey(d)
+		if current[name] != definitionText(serverBlock, d) {
+			return fmt.Errorf("%s was not updated to the regenerated definition", name)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,230 @@
+package generator
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+const sharedConf = `http {
+    geo $api_example_com_blocked {
+        default 0;
+        10.0.0.1 1;
+    }
+    upstream api_example_com_backend {
+        server 127.0.0.1:3000;
+        keepalive 16;
+    }
+    limit_conn_zone $binary_remote_addr zone=api_example_com_conn:10m;
+    log_format api_example_com_log '$remote_addr $api_example_com_blocked';
+
+    server {
+        listen 80;
+        server_name api.example.com;
+        if ($api_example_com_blocked) {
+            return 403;
+        }
+        location / {
+            limit_conn api_example_com_conn 10;
+            proxy_pass http://api_example_com_backend;
+        }
+    }
+
+    server {
+        listen 80;
+        server_name other.example.com;
+        access_log /var/log/nginx/other.log api_example_com_log;
+        location / {
+            proxy_pass http://api_example_com_backend/v2/;
+        }
+    }
+}
+`
+
+func TestRemoveServerBlocksDropsOrphanedDefinitions(t *testing.T) {
+	tests := []struct {
+		name       string
+		serverName string
+		// removed and kept are text expected to be absent from and
+		// present in the result.
+		removed []string
+		kept    []string
+	}{
+		{
+			name:       "shared upstream and log format",
+			serverName: "api.example.com",
+			removed:    []string{"limit_conn_zone"},
+			kept:       []string{"upstream api_example_com_backend", "geo $api_example_com_blocked", "log_format api_example_com_log", "server_name other.example.com"},
+		},
+		{
+			name:       "only other server",
+			serverName: "other.example.com",
+			removed:    []string{"log_format"},
+			kept:       []string{"upstream api_example_com_backend", "geo $api_example_com_blocked", "limit_conn_zone", "server_name api.example.com"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			content, removed, err := RemoveServerBlocks(sharedConf, tt.serverName)
+			if err != nil {
+				t.Fatalf("RemoveServerBlocks: %v", err)
+			}
+			if len(removed) != 1 || strings.Contains(content, "server_name "+tt.serverName) {
+				t.Fatalf("server %s was not removed:\n%s", tt.serverName, content)
+			}
+			for _, text := range tt.removed {
+				if strings.Contains(content, text) {
+					t.Errorf("%s was left behind:\n%s", text, content)
+				}
+			}
+			for _, text := range tt.kept {
+				if !strings.Contains(content, text) {
+					t.Errorf("%s was removed:\n%s", text, content)
+				}
+			}
+		})
+	}
+}
+
+func TestRemoveServerBlocksDropsEveryDefinitionKind(t *testing.T) {
+	content, _, err := RemoveServerBlocks(sharedConf, "api.example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	content, _, err = RemoveServerBlocks(content, "other.example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := strings.Join(strings.Fields(content), " "); got != "http { }" {
+		t.Errorf("definitions were left behind:\n%s", content)
+	}
+}
+
+func TestUpdateServerDropsRenamedDefinitions(t *testing.T) {
+	renamed := `    server {
+        listen 80;
+        server_name web.example.com;
+        location / {
+            proxy_pass http://127.0.0.1:3000;
+        }
+    }`
+	content, _, err := UpdateServer(sharedConf, renamed, []string{"api.example.com"})
+	if err != nil {
+		t.Fatalf("UpdateServer: %v", err)
+	}
+	if strings.Contains(content, "limit_conn_zone") {
+		t.Errorf("the zone only the old server used was left behind:\n%s", content)
+	}
+	for _, text := range []string{"upstream api_example_com_backend", "geo $api_example_com_blocked", "server_name web.example.com"} {
+		if !strings.Contains(content, text) {
+			t.Errorf("%s was removed:\n%s", text, content)
+		}
+	}
+}
+
+func TestPrepareBlock(t *testing.T) {
+	const content = `http {
+    underscores_in_headers on;
+    upstream api_example_com_backend {
+        server 127.0.0.1:3000;
+    }
+    limit_conn_zone $binary_remote_addr zone=api_example_com_conn:10m;
+
+    server {
+        listen 80;
+        server_name api.example.com;
+        location / {
+            limit_conn api_example_com_conn 10;
+            proxy_pass http://api_example_com_backend;
+        }
+    }
+}
+`
+	server := func(name string) string {
+		return `    server {
+        listen 80;
+        server_name ` + name + `;
+        location / {
+            proxy_pass http://api_example_com_backend;
+        }
+    }`
+	}
+	upstream := func(address string) string {
+		return "    upstream api_example_com_backend {\n        server " + address + ";\n    }\n\n"
+	}
+
+	tests := []struct {
+		name      string
+		block     string
+		replacing bool
+		// kept is whether the block keeps its upstream, and stale the
+		// definitions returned for removal.
+		kept    bool
+		stale   []string
+		wantErr bool
+	}{
+		{name: "identical definition is dropped", block: upstream("127.0.0.1:3000") + server("web.example.com")},
+		{name: "different definition conflicts on add", block: upstream("127.0.0.1:4000") + server("web.example.com"), wantErr: true},
+		{
+			name:      "different definition replaces the old one",
+			block:     upstream("127.0.0.1:4000") + server("api.example.com"),
+			replacing: true,
+			kept:      true,
+			stale:     []string{"upstream api_example_com_backend", "limit_conn_zone zone=api_example_com_conn"},
+		},
+		{
+			name:      "unused definitions are stale on replace",
+			block:     upstream("127.0.0.1:3000") + server("api.example.com"),
+			replacing: true,
+			stale:     []string{"limit_conn_zone zone=api_example_com_conn"},
+		},
+		{
+			name:      "header settings are not replaced",
+			block:     "    underscores_in_headers off;\n\n" + server("api.example.com"),
+			replacing: true,
+			wantErr:   true,
+		},
+		{
+			name:    "new blocks that differ conflict",
+			block:   upstream("10.0.0.1:3000") + upstream("10.0.0.2:3000") + server("web.example.com"),
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			http, err := findHTTPBlock(content)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var replacing []*directive
+			if tt.replacing {
+				for _, d := range http.children {
+					if d.name == "server" {
+						replacing = append(replacing, d)
+					}
+				}
+			}
+			prepared, stale, err := prepareBlock(content, http, tt.block, replacing)
+			if tt.wantErr {
+				if !errors.Is(err, ErrConflict) {
+					t.Fatalf("want a conflict, got %v", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("prepareBlock: %v", err)
+			}
+			if got := strings.Contains(prepared, "upstream "); got != tt.kept {
+				t.Errorf("upstream kept = %v, want %v:\n%s", got, tt.kept, prepared)
+			}
+			var names []string
+			for _, d := range stale {
+				key, _ := definitionName(d)
+				names = append(names, key)
+			}
+			if got, want := strings.Join(names, ", "), strings.Join(tt.stale, ", "); got != want {
+				t.Errorf("stale = %q, want %q", got, want)
+			}
+		})
+	}
+}
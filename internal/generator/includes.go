@@ -0,0 +1,87 @@
+package generator
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+var ErrNoHTTPBlock = errors.New("could not find http section in nginx configuration")
+
+const maxIncludeDepth = 8
+
+// FindHTTPConfig returns the file that holds the http block. When nginxPath
+// has none itself, its top-level include directives are followed, resolving
+// relative patterns against the directory of nginxPath as nginx does.
+func FindHTTPConfig(nginxPath string) (string, error) {
+	if IsRemote(nginxPath) {
+		return "", fmt.Errorf("cannot follow includes of a remote configuration")
+	}
+
+	found, err := findHTTPFile(nginxPath, filepath.Dir(nginxPath), map[string]bool{}, 0)
+	if err != nil {
+		return "", err
+	}
+	if found == "" {
+		return "", fmt.Errorf("%w: not in %s or any file it includes", ErrNoHTTPBlock, nginxPath)
+	}
+	return found, nil
+}
+
+func findHTTPFile(path, prefix string, visited map[string]bool, depth int) (string, error) {
+	if depth > maxIncludeDepth {
+		return "", fmt.Errorf("includes nested more than %d levels deep at %s", maxIncludeDepth, path)
+	}
+	if visited[path] {
+		return "", nil
+	}
+	visited[path] = true
+
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return "", fmt.Errorf("failed to read %s: %w", path, err)
+	}
+	directives, err := parseDirectives(string(content))
+	if err != nil {
+		return "", fmt.Errorf("failed to parse %s: %w", path, err)
+	}
+
+	for _, d := range directives {
+		if d.name == "http" && d.isBlock() {
+			return path, nil
+		}
+	}
+
+	for _, d := range directives {
+		if d.name != "include" || len(d.args) == 0 {
+			continue
+		}
+		pattern := d.args[0]
+		if !filepath.IsAbs(pattern) {
+			pattern = filepath.Join(prefix, pattern)
+		}
+		matches, err := filepath.Glob(pattern)
+		if err != nil {
+			return "", fmt.Errorf("invalid include pattern %q in %s: %w", d.args[0], path, err)
+		}
+		for _, match := range matches {
+			found, err := findHTTPFile(match, prefix, visited, depth+1)
+			if err != nil || found != "" {
+				return found, err
+			}
+		}
+	}
+
+	return "", nil
+}
+
+func topLevelIncludes(directives []*directive) []string {
+	var includes []string
+	for _, d := range directives {
+		if d.name == "include" && len(d.args) > 0 {
+			includes = append(includes, d.args[0])
+		}
+	}
+	return includes
+}
@@ -0,0 +1,45 @@
+package generator
+
+import "strings"
+
+// reindent rewrites the four-space indentation of generated text to use
+// unit per level instead.
+func reindent(block, unit string) string {
+	if unit == "" || unit == "    " {
+		return block
+	}
+
+	lines := strings.Split(block, "\n")
+	for i, line := range lines {
+		trimmed := strings.TrimLeft(line, " ")
+		width := len(line) - len(trimmed)
+		lines[i] = strings.Repeat(unit, width/4) + strings.Repeat(" ", width%4) + trimmed
+	}
+	return strings.Join(lines, "\n")
+}
+
+// DetectIndent returns one level of indentation as used by content, taken
+// from the first indented directive, or "" when nothing is indented.
+func DetectIndent(content string) string {
+	for _, line := range strings.Split(content, "\n") {
+		trimmed := strings.TrimLeft(line, " \t")
+		if trimmed == "" || trimmed == line || strings.HasPrefix(trimmed, "#") {
+			continue
+		}
+		if line[0] == '\t' {
+			return "\t"
+		}
+		return line[:len(line)-len(strings.TrimLeft(line, " "))]
+	}
+	return ""
+}
+
+// DetectFileIndent is DetectIndent for the configuration at nginxPath. It
+// returns "" when the file cannot be read.
+func DetectFileIndent(nginxPath string) string {
+	content, err := readConfig(nginxPath)
+	if err != nil {
+		return ""
+	}
+	return DetectIndent(content)
+}
@@ -0,0 +1,93 @@
+package generator
+
+import (
+	"fmt"
+	"nginx_tool/internal/config"
+	"strings"
+)
+
+// limitConnZone is the configured limit_conn zone name or one derived from the
+// first server name, e.g. api_example_com_conn.
+func limitConnZone(cfg *config.ServerConfig) string {
+	if cfg.LimitConnZone != "" {
+		return cfg.LimitConnZone
+	}
+	if slug := serverSlug(cfg); slug != "" {
+		return slug + "_conn"
+	}
+	return "perip"
+}
+
+// renderLimitConnZone declares the shared memory zone that tracks
+// connections per client address.
+func renderLimitConnZone(cfg *config.ServerConfig) string {
+	size := cfg.LimitConnSize
+	if size == "" {
+		size = "10m"
+	}
+	return fmt.Sprintf("    limit_conn_zone $binary_remote_addr zone=%s:%s;", limitConnZone(cfg), size)
+}
+
+// blockedVariable is the variable the blocklist geo block sets, derived from
+// the first server name, e.g. $api_example_com_blocked.
+func blockedVariable(cfg *config.ServerConfig) string {
+	if slug := serverSlug(cfg); slug != "" {
+		return "$" + slug + "_blocked"
+	}
+	return "$blocked"
+}
+
+// renderBlocklist declares a geo block that sets the blocked variable to 1
+// for client addresses in the blocklist.
+func renderBlocklist(cfg *config.ServerConfig) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "    geo %s {\n", blockedVariable(cfg))
+	b.WriteString("        default 0;\n")
+	for _, entry := range cfg.Blocklist {
+		fmt.Fprintf(&b, "        %s 1;\n", entry)
+	}
+	b.WriteString("    }")
+	return b.String()
+}
+
+// usesVariable reports whether text refers to the nginx variable, which
+// must not continue with another name character.
+func usesVariable(text, variable string) bool {
+	for i := strings.Index(text, variable); i >= 0; {
+		end := i + len(variable)
+		if end == len(text) || !isNameChar(text[end]) {
+			return true
+		}
+		next := strings.Index(text[end:], variable)
+		if next < 0 {
+			break
+		}
+		i = end + next
+	}
+	return false
+}
+
+// usesName reports whether text refers to an upstream, zone or log format
+// called name, which must not be part of a longer name.
+func usesName(text, name string) bool {
+	for i := 0; i < len(text); {
+		j := strings.Index(text[i:], name)
+		if j < 0 {
+			break
+		}
+		start, end := i+j, i+j+len(name)
+		if (start == 0 || !isRefChar(text[start-1])) && (end == len(text) || !isRefChar(text[end])) {
+			return true
+		}
+		i = start + 1
+	}
+	return false
+}
+
+func isRefChar(c byte) bool {
+	return isNameChar(c) || c == '.' || c == '-' || c == '$'
+}
+
+func isNameChar(c byte) bool {
+	return c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '_'
+}
@@ -0,0 +1,97 @@
+package generator
+
+import (
+	"fmt"
+	"strings"
+)
+
+// LintWarning is a deprecated or obsolete form found in nginx.conf.
+type LintWarning struct {
+	Line    int
+	Message string
+}
+
+// replacedDirectives maps directives nginx has deprecated or dropped to
+// what to use instead.
+var replacedDirectives = map[string]string{
+	"limit_zone":             "was removed in nginx 1.7.6; use limit_conn_zone",
+	"satisfy_any":            "was removed long ago; use satisfy any",
+	"open_file_cache_retest": "was renamed; use open_file_cache_valid",
+	"http2_max_field_size":   "is obsolete since nginx 1.19.7; use large_client_header_buffers",
+	"http2_max_header_size":  "is obsolete since nginx 1.19.7; use large_client_header_buffers",
+	"http2_idle_timeout":     "is obsolete since nginx 1.19.7; use keepalive_timeout",
+	"http2_recv_timeout":     "is obsolete since nginx 1.19.7; use client_header_timeout",
+	"http2_max_requests":     "is obsolete since nginx 1.19.7; use keepalive_requests",
+	"http2_push":             "is obsolete since nginx 1.25.1 and ignored",
+	"http2_push_preload":     "is obsolete since nginx 1.25.1 and ignored",
+}
+
+// insecureProtocols are ssl_protocols values browsers no longer accept.
+var insecureProtocols = []string{"SSLv2", "SSLv3", "TLSv1", "TLSv1.1"}
+
+// LintNginxConfig reads nginxPath and reports its deprecated directives.
+func (g *Generator) LintNginxConfig(nginxPath string) ([]LintWarning, error) {
+	content, err := readConfig(nginxPath)
+	if err != nil {
+		return nil, err
+	}
+	return Lint(content)
+}
+
+// Lint scans every directive of content, at any depth, for forms nginx has
+// deprecated or removed, such as "ssl on;" or the http2 listen parameter,
+// and says what replaces them. Commented-out directives are skipped.
+func Lint(content string) ([]LintWarning, error) {
+	directives, err := parseDirectives(content)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse nginx configuration: %w", err)
+	}
+	var warnings []LintWarning
+	lintDirectives(directives, &warnings)
+	return warnings, nil
+}
+
+func lintDirectives(directives []*directive, warnings *[]LintWarning) {
+	for _, d := range directives {
+		for _, message := range lintDirective(d) {
+			*warnings = append(*warnings, LintWarning{Line: d.line, Message: message})
+		}
+		lintDirectives(d.children, warnings)
+	}
+}
+
+func lintDirective(d *directive) []string {
+	if replacement, ok := replacedDirectives[d.name]; ok {
+		return []string{d.name + " " + replacement}
+	}
+
+	var messages []string
+	switch d.name {
+	case "ssl":
+		messages = append(messages, "the ssl directive is deprecated since nginx 1.15.0; add the ssl parameter to the listen directive instead")
+	case "listen":
+		for _, arg := range d.args[min(1, len(d.args)):] {
+			switch arg {
+			case "http2":
+				messages = append(messages, "the http2 listen parameter is deprecated since nginx 1.25.1; use \"http2 on;\" in the server block")
+			case "spdy":
+				messages = append(messages, "spdy was removed in nginx 1.9.5; use \"http2 on;\"")
+			case "default":
+				messages = append(messages, "the default listen parameter is an old spelling of default_server")
+			}
+		}
+	case "ssl_protocols":
+		var insecure []string
+		for _, arg := range d.args {
+			for _, protocol := range insecureProtocols {
+				if arg == protocol {
+					insecure = append(insecure, arg)
+				}
+			}
+		}
+		if len(insecure) > 0 {
+			messages = append(messages, fmt.Sprintf("ssl_protocols enables %s, which browsers no longer accept; use TLSv1.2 TLSv1.3", strings.Join(insecure, " ")))
+		}
+	}
+	return messages
+}
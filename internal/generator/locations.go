@@ -0,0 +1,53 @@
+package generator
+
+import (
+	"fmt"
+	"nginx_tool/internal/config"
+	"sort"
+)
+
+// OrderLocations sorts locations the way nginx evaluates them: exact matches
+// first, then prefixes from longest to shortest, then regular expressions in
+// the order given. It also returns a warning for each location that had to
+// move ahead of one listed before it.
+func OrderLocations(locations []config.LocationConfig) ([]config.LocationConfig, []string) {
+	ordered := append([]config.LocationConfig(nil), locations...)
+	sort.SliceStable(ordered, func(i, j int) bool {
+		ri, li := locationRank(ordered[i])
+		rj, lj := locationRank(ordered[j])
+		if ri != rj {
+			return ri < rj
+		}
+		return li > lj
+	})
+
+	var warnings []string
+	for i, l := range locations {
+		for _, earlier := range locations[:i] {
+			if locationBefore(l, earlier) {
+				warnings = append(warnings, fmt.Sprintf("location %s is listed after %s but nginx checks it first; it has been moved ahead", l.Path, earlier.Path))
+				break
+			}
+		}
+	}
+	return ordered, warnings
+}
+
+// locationRank returns the evaluation group of a location and, for prefix
+// groups, the length that breaks ties. Regular expressions keep their order.
+func locationRank(l config.LocationConfig) (int, int) {
+	modifier, uri := l.Modifier()
+	switch modifier {
+	case "=":
+		return 0, len(uri)
+	case "~", "~*":
+		return 2, 0
+	}
+	return 1, len(uri)
+}
+
+func locationBefore(a, b config.LocationConfig) bool {
+	ra, la := locationRank(a)
+	rb, lb := locationRank(b)
+	return ra < rb || (ra == rb && ra != 2 && la > lb)
+}
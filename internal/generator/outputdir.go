@@ -0,0 +1,283 @@
+package generator
+
+import (
+	"fmt"
+	"nginx_tool/internal/config"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// ServerFile is a server block written to a file of its own.
+type ServerFile struct {
+	Path    string
+	Content string
+	// Exists is set when Path is already there and will be overwritten.
+	Exists bool
+}
+
+// FilePlan describes what WriteServerFiles does: the files it writes and
+// the include it adds to the http block of nginx.conf, if one is missing.
+type FilePlan struct {
+	Files   []ServerFile
+	Include string
+	config  string
+	changed bool
+}
+
+// ServerFileName returns the file cfg is written to in an output directory:
+// its first server name with characters that do not belong in a file name
+// replaced, or default.conf for a server without one.
+func ServerFileName(cfg *config.ServerConfig) string {
+	for _, name := range cfg.Names() {
+		name = strings.Trim(strings.TrimPrefix(name, "*."), ".")
+		if name == "" || name == "_" || strings.HasPrefix(name, "~") {
+			continue
+		}
+		return strings.Map(func(r rune) rune {
+			if r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '.' || r == '-' {
+				return r
+			}
+			return '_'
+		}, name) + ".conf"
+	}
+	return "default.conf"
+}
+
+// PlanServerFiles renders one file per config for outputDir. Conflicts are
+// checked against nginx.conf, the other .conf files already in outputDir
+// and the earlier configs. Each file holds the http-level blocks its server
+// needs, such as upstreams and maps, unless nginx.conf defines them the
+// same way; since the files are replaced one by one, a block another file
+// in outputDir defines too is a conflict rather than being shared. An
+// existing file is only overwritten with Reapply.
+func (g *Generator) PlanServerFiles(cfgs []*config.ServerConfig, nginxPath, serverType, outputDir string) (*FilePlan, error) {
+	content, err := readConfig(nginxPath)
+	if err != nil {
+		return nil, err
+	}
+	dir, err := filepath.Abs(outputDir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve output directory: %w", err)
+	}
+
+	plan := &FilePlan{config: content}
+	planned := make(map[string]bool)
+	for _, cfg := range cfgs {
+		path := filepath.Join(dir, ServerFileName(cfg))
+		if planned[path] {
+			return nil, fmt.Errorf("%s would be written twice; give the servers distinct first server names", path)
+		}
+		planned[path] = true
+		file := ServerFile{Path: path}
+		if _, err := os.Stat(path); err == nil {
+			if !g.Reapply {
+				return nil, fmt.Errorf("%s already exists; pass -reapply to overwrite it", path)
+			}
+			file.Exists = true
+		}
+		plan.Files = append(plan.Files, file)
+	}
+
+	// The scratch copy of the http block holds everything nginx will see
+	// once the files are included, so the server checks apply across them.
+	// definedIn records which file defines each http-level block.
+	scratch := content
+	definedIn := make(map[string]string)
+	existing, _ := filepath.Glob(filepath.Join(dir, "*.conf"))
+	for _, path := range existing {
+		if planned[path] {
+			continue
+		}
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read %s: %w", path, err)
+		}
+		if err := recordDefinitions(definedIn, string(data), path); err != nil {
+			return nil, err
+		}
+		if scratch, err = appendToHTTP(scratch, string(data)); err != nil {
+			return nil, err
+		}
+	}
+
+	http, err := findHTTPBlock(content)
+	if err != nil {
+		return nil, err
+	}
+	for i, cfg := range cfgs {
+		serverBlock, err := g.GenerateServerBlock(cfg, serverType)
+		if err != nil {
+			return nil, err
+		}
+		all, err := findHTTPBlock(scratch)
+		if err != nil {
+			return nil, err
+		}
+		if err := checkBlockConflicts(all, serverBlock, nil); err != nil {
+			return nil, fmt.Errorf("failed to add server block: %w", err)
+		}
+		serverBlock, _, err = prepareBlock(content, http, serverBlock, nil)
+		if err != nil {
+			return nil, fmt.Errorf("failed to add server block: %w", err)
+		}
+		if err := recordDefinitions(definedIn, serverBlock, plan.Files[i].Path); err != nil {
+			return nil, fmt.Errorf("failed to add server block: %w", err)
+		}
+		if scratch, err = appendToHTTP(scratch, serverBlock); err != nil {
+			return nil, err
+		}
+		plan.Files[i].Content = dedent(serverBlock) + "\n"
+	}
+
+	if !includesAll(http, filepath.Dir(nginxPath), plan.Files) {
+		unit := g.Indent
+		if unit == "" {
+			unit = "    "
+		}
+		plan.Include = "include " + filepath.Join(dir, "*.conf") + ";"
+		if plan.config, err = appendToHTTP(content, unit+plan.Include); err != nil {
+			return nil, err
+		}
+		plan.changed = true
+	}
+	return plan, nil
+}
+
+// WriteServerFiles writes each config to its own file in outputDir, as
+// planned by PlanServerFiles, and adds the include for them to nginx.conf.
+// nginx.conf is only backed up and rewritten when it changes.
+func (g *Generator) WriteServerFiles(cfgs []*config.ServerConfig, nginxPath, serverType, outputDir string, backup bool) (*Result, error) {
+	if err := checkWritable(nginxPath); err != nil {
+		return nil, err
+	}
+	plan, err := g.PlanServerFiles(cfgs, nginxPath, serverType, outputDir)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &Result{}
+	if g.Harden {
+		before := plan.config
+		plan.config, result.Hardened, err = HardenHTTPBlock(plan.config)
+		if err != nil {
+			return nil, fmt.Errorf("failed to harden http block: %w", err)
+		}
+		plan.changed = plan.changed || plan.config != before
+	}
+
+	if plan.changed && backup {
+		if err := g.backup(nginxPath, result); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := os.MkdirAll(outputDir, 0755); err != nil {
+		return result, result.withBackup(fmt.Errorf("failed to create output directory: %w", err))
+	}
+	for _, file := range plan.Files {
+		if err := os.WriteFile(file.Path, []byte(file.Content), 0644); err != nil {
+			return result, result.withBackup(fmt.Errorf("failed to write %s: %w", file.Path, err))
+		}
+		if file.Exists {
+			result.Replaced++
+		}
+		result.ServerBlocks = append(result.ServerBlocks, file.Content)
+		result.Files = append(result.Files, file.Path)
+		result.Lines = append(result.Lines, blockLine(file.Content, file.Content))
+	}
+
+	if plan.changed {
+		if err := os.WriteFile(nginxPath, []byte(plan.config), 0644); err != nil {
+			return result, result.withBackup(fmt.Errorf("failed to write nginx config: %w", err))
+		}
+	}
+	return result, nil
+}
+
+// includesAll reports whether every file is already matched by an include
+// directive of the http block. Relative include paths are taken relative to
+// the directory of nginx.conf.
+func includesAll(http *directive, confDir string, files []ServerFile) bool {
+	var patterns []string
+	for _, d := range http.find("include") {
+		if len(d.args) == 0 {
+			continue
+		}
+		pattern := d.args[0]
+		if !filepath.IsAbs(pattern) {
+			pattern = filepath.Join(confDir, pattern)
+		}
+		patterns = append(patterns, pattern)
+	}
+
+	for _, file := range files {
+		matched := false
+		for _, pattern := range patterns {
+			if ok, _ := filepath.Match(pattern, file.Path); ok {
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			return false
+		}
+	}
+	return true
+}
+
+// recordDefinitions adds the http-level blocks of text, the contents of
+// path, to definedIn, and reports a block another file already defines.
+func recordDefinitions(definedIn map[string]string, text, path string) error {
+	directives, err := parseDirectives(text)
+	if err != nil {
+		return fmt.Errorf("failed to parse %s: %w", path, err)
+	}
+	for _, d := range directives {
+		key, ok := definitionName(d)
+		if !ok {
+			continue
+		}
+		if other, ok := definedIn[key]; ok {
+			return fmt.Errorf("%w: %s is also defined in %s; servers in separate files cannot share it, so define it once in nginx.conf", ErrConflict, key, other)
+		}
+		definedIn[key] = path
+	}
+	return nil
+}
+
+// appendToHTTP adds text at the end of the http block of content.
+func appendToHTTP(content, text string) (string, error) {
+	http, err := findHTTPBlock(content)
+	if err != nil {
+		return "", err
+	}
+	body := strings.TrimRight(content[http.bodyStart:http.bodyEnd], " \t\n")
+	return content[:http.bodyStart] + body + "\n\n" + strings.Trim(text, "\n") + "\n" + content[http.bodyEnd:], nil
+}
+
+// dedent removes the indentation shared by the non-blank lines of text, so
+// blocks generated for the http section start at the left margin.
+func dedent(text string) string {
+	lines := strings.Split(text, "\n")
+	common := -1
+	for _, line := range lines {
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+		if n := len(line) - len(strings.TrimLeft(line, " \t")); common < 0 || n < common {
+			common = n
+		}
+	}
+	if common <= 0 {
+		return text
+	}
+	for i, line := range lines {
+		if len(line) >= common {
+			lines[i] = line[common:]
+		} else {
+			lines[i] = ""
+		}
+	}
+	return strings.Join(lines, "\n")
+}
@@ -0,0 +1,168 @@
+package generator
+
+import (
+	"errors"
+	"nginx_tool/internal/config"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestPlanServerFiles(t *testing.T) {
+	site := func(name string, shared bool) *config.ServerConfig {
+		cfg := &config.ServerConfig{Listen: "80", ServerName: name, ProxyPort: "3000"}
+		if shared {
+			cfg.UpstreamGroups = []config.UpstreamGroup{{Name: "shared", Servers: []config.UpstreamServer{{Address: "10.0.0.5:8080"}}}}
+			cfg.Locations = []config.LocationConfig{{Path: "/v2/", Upstream: "shared"}}
+		}
+		return cfg
+	}
+
+	tests := []struct {
+		name string
+		cfgs []*config.ServerConfig
+		// inConf is added to nginx.conf and existing written to the output
+		// directory before planning.
+		inConf   *config.ServerConfig
+		existing []string
+		include  bool
+		reapply  bool
+		// files lists the planned file names, and shared the ones that
+		// define the shared upstream.
+		files    []string
+		shared   []string
+		exists   []string
+		wantErr  string
+		conflict bool
+	}{
+		{
+			name:   "one file per server",
+			cfgs:   []*config.ServerConfig{site("a.example.com", false), site("b.example.com", true)},
+			files:  []string{"a.example.com.conf", "b.example.com.conf"},
+			shared: []string{"b.example.com.conf"},
+		},
+		{
+			name:    "existing include",
+			cfgs:    []*config.ServerConfig{site("a.example.com", false)},
+			include: true,
+			files:   []string{"a.example.com.conf"},
+		},
+		{
+			name:   "block nginx.conf defines is left out",
+			cfgs:   []*config.ServerConfig{site("a.example.com", true)},
+			inConf: site("c.example.com", true),
+			files:  []string{"a.example.com.conf"},
+		},
+		{
+			name:     "block shared between files conflicts",
+			cfgs:     []*config.ServerConfig{site("a.example.com", true), site("b.example.com", true)},
+			conflict: true,
+		},
+		{
+			name:     "block defined by another file conflicts",
+			cfgs:     []*config.ServerConfig{site("a.example.com", true)},
+			existing: []string{"b.example.com"},
+			conflict: true,
+		},
+		{
+			name:     "existing file needs reapply",
+			cfgs:     []*config.ServerConfig{site("a.example.com", false)},
+			existing: []string{"a.example.com"},
+			wantErr:  "pass -reapply",
+		},
+		{
+			name:     "existing file with reapply",
+			cfgs:     []*config.ServerConfig{site("a.example.com", false)},
+			existing: []string{"a.example.com"},
+			reapply:  true,
+			files:    []string{"a.example.com.conf"},
+			exists:   []string{"a.example.com.conf"},
+		},
+		{
+			name:    "same file twice",
+			cfgs:    []*config.ServerConfig{site("a.example.com", false), {Listen: "8080", ServerName: "a.example.com www.a.example.com", ProxyPort: "4000"}},
+			wantErr: "written twice",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gen := New()
+			gen.Banner = false
+			gen.Reapply = tt.reapply
+			dir := filepath.Join(t.TempDir(), "sites")
+			if err := os.MkdirAll(dir, 0755); err != nil {
+				t.Fatal(err)
+			}
+
+			conf := baseConf
+			if tt.include {
+				conf = strings.Replace(conf, "include mime.types;", "include mime.types;\n    include "+dir+"/*.conf;", 1)
+			}
+			if tt.inConf != nil {
+				block, err := gen.GenerateServerBlock(tt.inConf, "proxy")
+				if err != nil {
+					t.Fatal(err)
+				}
+				if conf, err = InsertServerBlockAt(conf, block, false); err != nil {
+					t.Fatal(err)
+				}
+			}
+			nginxPath := filepath.Join(t.TempDir(), "nginx.conf")
+			if err := os.WriteFile(nginxPath, []byte(conf), 0644); err != nil {
+				t.Fatal(err)
+			}
+			for _, name := range tt.existing {
+				block, err := gen.GenerateServerBlock(site(name, true), "proxy")
+				if err != nil {
+					t.Fatal(err)
+				}
+				if err := os.WriteFile(filepath.Join(dir, name+".conf"), []byte(dedent(block)+"\n"), 0644); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			plan, err := gen.PlanServerFiles(tt.cfgs, nginxPath, "proxy", dir)
+			switch {
+			case tt.conflict:
+				if !errors.Is(err, ErrConflict) {
+					t.Fatalf("want a conflict, got %v", err)
+				}
+				return
+			case tt.wantErr != "":
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("want an error containing %q, got %v", tt.wantErr, err)
+				}
+				return
+			case err != nil:
+				t.Fatalf("PlanServerFiles: %v", err)
+			}
+
+			var files, shared, exists []string
+			for _, file := range plan.Files {
+				name := filepath.Base(file.Path)
+				files = append(files, name)
+				if strings.Contains(file.Content, "upstream shared") {
+					shared = append(shared, name)
+				}
+				if file.Exists {
+					exists = append(exists, name)
+				}
+				if !strings.HasPrefix(file.Content, "upstream") && !strings.HasPrefix(file.Content, "server {") {
+					t.Errorf("%s is not dedented:\n%s", name, file.Content)
+				}
+			}
+			for _, check := range []struct {
+				what      string
+				got, want []string
+			}{{"files", files, tt.files}, {"files defining the shared upstream", shared, tt.shared}, {"existing files", exists, tt.exists}} {
+				if strings.Join(check.got, " ") != strings.Join(check.want, " ") {
+					t.Errorf("%s = %q, want %q", check.what, check.got, check.want)
+				}
+			}
+			if wantInclude := !tt.include; (plan.Include != "") != wantInclude {
+				t.Errorf("include = %q, want one: %v", plan.Include, wantInclude)
+			}
+		})
+	}
+}
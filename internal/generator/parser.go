@@ -0,0 +1,91 @@
+package generator
+
+import (
+	"fmt"
+	"nginx_tool/internal/config"
+	"strings"
+)
+
+// directive is a single nginx directive. Block directives keep the offsets
+// of their body so callers can splice content without re-serializing.
+type directive struct {
+	name      string
+	args      []string
+	line      int
+	start     int
+	end       int
+	bodyStart int
+	bodyEnd   int
+	children  []*directive
+}
+
+func (d *directive) isBlock() bool {
+	return d.bodyStart >= 0
+}
+
+func (d *directive) find(name string) []*directive {
+	var found []*directive
+	for _, child := range d.children {
+		if child.name == name {
+			found = append(found, child)
+		}
+	}
+	return found
+}
+
+func parseDirectives(content string) ([]*directive, error) {
+	root, err := config.ParseNginx(content)
+	if err != nil {
+		return nil, err
+	}
+	return convertDirectives(root.Children), nil
+}
+
+func convertDirectives(parsed []*config.Directive) []*directive {
+	directives := make([]*directive, 0, len(parsed))
+	for _, d := range parsed {
+		if d.IsComment() {
+			continue
+		}
+		directives = append(directives, &directive{
+			name:      d.Name,
+			args:      d.Args,
+			line:      d.Line,
+			start:     d.Start,
+			end:       d.End,
+			bodyStart: d.BodyStart,
+			bodyEnd:   d.BodyEnd,
+			children:  convertDirectives(d.Children),
+		})
+	}
+	return directives
+}
+
+// validateBlock is a line-level sanity check for generated text: braces must
+// balance and every line that is not blank or a comment must end with ";",
+// "{" or "}". It catches template mistakes before anything is written.
+func validateBlock(block string) error {
+	depth := 0
+	for i, line := range strings.Split(block, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		depth += strings.Count(line, "{") - strings.Count(line, "}")
+		if depth < 0 {
+			return fmt.Errorf("line %d: unexpected \"}\"", i+1)
+		}
+		switch line[len(line)-1] {
+		case ';', '{', '}':
+		default:
+			return fmt.Errorf("line %d: %q does not end with \";\", \"{\" or \"}\"", i+1, line)
+		}
+	}
+	if depth != 0 {
+		return fmt.Errorf("%d unclosed \"{\"", depth)
+	}
+
+	_, err := parseDirectives(block)
+	return err
+}
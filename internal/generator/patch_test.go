@@ -0,0 +1,154 @@
+package generator
+
+import (
+	"nginx_tool/internal/config"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+const baseConf = `events {}
+http {
+    include mime.types;
+}
+`
+
+// addedServer returns nginx.conf with cfg added to baseConf, and the path
+// it was written to.
+func addedServer(t *testing.T, gen *Generator, cfg *config.ServerConfig, serverType string) (string, string) {
+	t.Helper()
+	block, err := gen.GenerateServerBlock(cfg, serverType)
+	if err != nil {
+		t.Fatalf("GenerateServerBlock: %v", err)
+	}
+	content, err := InsertServerBlockAt(baseConf, block, false)
+	if err != nil {
+		t.Fatalf("InsertServerBlockAt: %v", err)
+	}
+	path := filepath.Join(t.TempDir(), "nginx.conf")
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return content, path
+}
+
+func TestPatchRoundTrip(t *testing.T) {
+	tests := []struct {
+		name       string
+		serverType string
+		cfg        config.ServerConfig
+	}{
+		{"static", "static", config.ServerConfig{Root: "/srv/www", StaticCache: true, DenyDotfiles: true}},
+		{"proxy", "proxy", config.ServerConfig{ProxyPort: "3000", SecurityHeaders: true}},
+		{"keepalive", "proxy", config.ServerConfig{ProxyPort: "3000", Keepalive: 16}},
+		{"keepalive socket", "proxy", config.ServerConfig{ProxySocket: "/run/app.sock", Keepalive: 8}},
+		{"keepalive https", "proxy", config.ServerConfig{ProxyPass: "https://backend.internal/api/", Keepalive: 4}},
+		{"upstreams", "proxy", config.ServerConfig{
+			Upstreams: []config.UpstreamServer{
+				{Address: "10.0.0.1:3000", Weight: 3},
+				{Address: "10.0.0.2:3000", MaxFails: 2, FailTimeout: "5s"},
+				{Address: "10.0.0.3:3000", Backup: true},
+			},
+			Keepalive: 32,
+		}},
+		{"upstream group", "proxy", config.ServerConfig{
+			ProxyPort:      "3000",
+			UpstreamGroups: []config.UpstreamGroup{{Name: "api_v2", Servers: []config.UpstreamServer{{Address: "10.0.0.5:8080"}}}},
+			Locations:      []config.LocationConfig{{Path: "/v2/", Upstream: "api_v2"}},
+		}},
+		{"limit_conn", "proxy", config.ServerConfig{ProxyPort: "3000", LimitConn: 10, LimitConnSize: "20m"}},
+		{"proxy_cache", "proxy", config.ServerConfig{ProxyPort: "3000", ProxyCache: &config.CacheConfig{Size: "50m", MaxSize: "1g", Inactive: "60m", Valid: map[string]string{"200": "5m", "404": "1m"}}}},
+		{"access_log", "proxy", config.ServerConfig{ProxyPort: "3000", AccessLog: &config.AccessLogConfig{Format: "$remote_addr $status", Escape: "json", Buffer: "32k", Flush: "5s"}}},
+		{"blocklist", "proxy", config.ServerConfig{ProxyPort: "3000", Blocklist: []string{"10.0.0.1", "192.168.0.0/16"}}},
+		{"maps", "proxy", config.ServerConfig{
+			ProxyPort: "3000",
+			Headers:   map[string]string{"X-Variant": "$variant"},
+			Maps:      []config.MapConfig{{Source: "$http_host", Variable: "$variant", Default: "stable", Entries: map[string]string{"beta.example.com": "beta"}}},
+		}},
+		{"redirect", "redirect", config.ServerConfig{RedirectTo: "https://example.com"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.cfg.Listen = "80"
+			tt.cfg.ServerName = "api.example.com"
+			if err := tt.cfg.Validate(); err != nil {
+				t.Fatalf("Validate: %v", err)
+			}
+			gen := New()
+			gen.Banner = false
+			content, path := addedServer(t, gen, &tt.cfg, tt.serverType)
+
+			current, err := gen.CurrentServerBlock(path, []string{"api.example.com"})
+			if err != nil {
+				t.Fatalf("CurrentServerBlock: %v", err)
+			}
+			cfg, err := config.ParseServerBlock(current)
+			if err != nil {
+				t.Fatalf("ParseServerBlock: %v", err)
+			}
+			for _, warning := range cfg.Warnings {
+				t.Errorf("warning: %s", warning)
+			}
+			cfg.Merge(&config.ServerConfig{ServerName: "api.example.com"})
+			if err := cfg.Validate(); err != nil {
+				t.Fatalf("Validate after parsing: %v", err)
+			}
+			block, err := gen.GenerateServerBlock(cfg, tt.serverType)
+			if err != nil {
+				t.Fatalf("GenerateServerBlock after parsing: %v", err)
+			}
+			changes, err := ChangedDefinitions(current, block)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, change := range changes {
+				t.Errorf("change: %s", change)
+			}
+			updated, _, err := UpdateServer(content, block, cfg.Names())
+			if err != nil {
+				t.Fatalf("UpdateServer: %v", err)
+			}
+			if updated != content {
+				t.Errorf("a no-op patch changed nginx.conf\nbefore:\n%s\nafter:\n%s", content, updated)
+			}
+
+			// A patch that only turns gzip on leaves the rest as it was.
+			gzipped := tt.cfg
+			gzipped.Gzip = true
+			want, _ := addedServer(t, gen, &gzipped, tt.serverType)
+			cfg.Merge(&config.ServerConfig{ServerName: "api.example.com", Gzip: true})
+			block, err = gen.GenerateServerBlock(cfg, tt.serverType)
+			if err != nil {
+				t.Fatalf("GenerateServerBlock with gzip: %v", err)
+			}
+			updated, _, err = UpdateServer(content, block, cfg.Names())
+			if err != nil {
+				t.Fatalf("UpdateServer with gzip: %v", err)
+			}
+			if updated != want {
+				t.Errorf("a gzip patch changed more than gzip\nwant:\n%s\ngot:\n%s", want, updated)
+			}
+		})
+	}
+}
+
+func TestParseServerBlockRefusesLostKeepalive(t *testing.T) {
+	block := `    upstream api_example_com_backend {
+        least_conn;
+        server 127.0.0.1:3000;
+        keepalive 16;
+    }
+
+    server {
+        listen 80;
+        server_name api.example.com;
+        location / {
+            proxy_pass http://api_example_com_backend;
+            proxy_http_version 1.1;
+            proxy_set_header Connection "";
+        }
+    }`
+	if _, err := config.ParseServerBlock(block); err == nil {
+		t.Error("want an error for a keepalive upstream that cannot be read back")
+	}
+}
@@ -0,0 +1,83 @@
+package generator
+
+import (
+	"fmt"
+	"strings"
+)
+
+const markerPrefix = "# managed-by: nginx-tool"
+
+func markerLine(serverName string) string {
+	return fmt.Sprintf("%s server_name=%s", markerPrefix, serverName)
+}
+
+func blockMarkers(text string) []string {
+	var markers []string
+	for _, line := range strings.Split(text, "\n") {
+		if line = strings.TrimSpace(line); strings.HasPrefix(line, markerPrefix) {
+			markers = append(markers, line)
+		}
+	}
+	return markers
+}
+
+func findMarkedServers(content string, http *directive, marker string) []*directive {
+	var found []*directive
+	for _, server := range http.find("server") {
+		for _, line := range blockMarkers(content[server.bodyStart:server.bodyEnd]) {
+			if line == marker {
+				found = append(found, server)
+				break
+			}
+		}
+	}
+	return found
+}
+
+// replacedServers returns the existing server blocks that carry one of the
+// markers found in serverBlock.
+func replacedServers(content string, http *directive, serverBlock string) ([]*directive, error) {
+	var replaced []*directive
+	for _, marker := range blockMarkers(serverBlock) {
+		previous := findMarkedServers(content, http, marker)
+		if len(previous) > 1 {
+			return nil, fmt.Errorf("%d server blocks carry the marker %q; remove the duplicates before re-applying", len(previous), marker)
+		}
+		replaced = append(replaced, previous...)
+	}
+	return replaced, nil
+}
+
+// ReapplyServerBlock replaces the server block previously generated for the
+// same server_name in place, or appends serverBlock when there is none. It
+// reports whether an existing block was replaced.
+func ReapplyServerBlock(nginxContent, serverBlock string) (string, bool, error) {
+	return reapplyServerBlock(nginxContent, serverBlock, false)
+}
+
+func reapplyServerBlock(nginxContent, serverBlock string, top bool) (string, bool, error) {
+	http, err := findHTTPBlock(nginxContent)
+	if err != nil {
+		return "", false, err
+	}
+
+	previous, err := replacedServers(nginxContent, http, serverBlock)
+	if err != nil {
+		return "", false, err
+	}
+	if len(previous) == 0 {
+		result, err := InsertServerBlockAt(nginxContent, serverBlock, top)
+		return result, false, err
+	}
+
+	prepared, stale, err := prepareBlock(nginxContent, http, serverBlock, previous)
+	if err != nil {
+		return "", false, err
+	}
+
+	result, err := replaceServer(nginxContent, previous[0], prepared, serverBlock, stale)
+	if err != nil {
+		return "", false, err
+	}
+	return result, true, nil
+}
@@ -0,0 +1,72 @@
+package generator
+
+import (
+	"errors"
+	"fmt"
+)
+
+// namedServers returns the existing server blocks that share a server_name
+// with a server block in serverBlock, matched the way update matches them.
+// A new block whose names match more than one existing block is an error.
+func namedServers(http *directive, serverBlock string) ([]*directive, error) {
+	added, err := parseDirectives(serverBlock)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse server block: %w", err)
+	}
+	var replaced []*directive
+	for _, server := range added {
+		if server.name != "server" || !server.isBlock() {
+			continue
+		}
+		var names []string
+		for _, serverName := range server.find("server_name") {
+			names = append(names, serverName.args...)
+		}
+		if len(names) == 0 {
+			continue
+		}
+		match, err := findServerToUpdate(http, names)
+		if errors.Is(err, ErrNoMatchingServer) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		replaced = append(replaced, match)
+	}
+	return replaced, nil
+}
+
+// ReplaceServerBlock replaces the server block with the same server_name
+// in place, whether or not this tool wrote it, or appends serverBlock when
+// there is none. It reports whether an existing block was replaced.
+func ReplaceServerBlock(nginxContent, serverBlock string) (string, bool, error) {
+	return replaceServerBlock(nginxContent, serverBlock, false)
+}
+
+func replaceServerBlock(nginxContent, serverBlock string, top bool) (string, bool, error) {
+	http, err := findHTTPBlock(nginxContent)
+	if err != nil {
+		return "", false, err
+	}
+
+	previous, err := namedServers(http, serverBlock)
+	if err != nil {
+		return "", false, err
+	}
+	if len(previous) == 0 {
+		result, err := InsertServerBlockAt(nginxContent, serverBlock, top)
+		return result, false, err
+	}
+
+	prepared, stale, err := prepareBlock(nginxContent, http, serverBlock, previous)
+	if err != nil {
+		return "", false, err
+	}
+
+	result, err := replaceServer(nginxContent, previous[0], prepared, serverBlock, stale)
+	if err != nil {
+		return "", false, err
+	}
+	return result, true, nil
+}
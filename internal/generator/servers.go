@@ -0,0 +1,291 @@
+package generator
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"time"
+)
+
+type ServerInfo struct {
+	Line        int
+	Type        string
+	ServerNames []string
+	Listens     []string
+	Root        string
+	ProxyPass   string
+	Return      string
+}
+
+func (g *Generator) ListServerBlocks(nginxPath string) ([]ServerInfo, error) {
+	content, err := readConfig(nginxPath)
+	if err != nil {
+		return nil, err
+	}
+	return ListServers(content)
+}
+
+// ListUpstreams returns the names of the upstream blocks in the http
+// section of nginx.conf.
+func (g *Generator) ListUpstreams(nginxPath string) ([]string, error) {
+	content, err := readConfig(nginxPath)
+	if err != nil {
+		return nil, err
+	}
+	http, err := findHTTPBlock(content)
+	if err != nil {
+		return nil, err
+	}
+	var names []string
+	for _, d := range http.find("upstream") {
+		if d.isBlock() && len(d.args) > 0 {
+			names = append(names, d.args[0])
+		}
+	}
+	return names, nil
+}
+
+func (g *Generator) RemoveServerFromNginx(nginxPath, serverName string, backup bool) (*Result, error) {
+	if err := checkWritable(nginxPath); err != nil {
+		return nil, err
+	}
+
+	content, err := readConfig(nginxPath)
+	if err != nil {
+		return nil, err
+	}
+
+	remove := RemoveServerBlocks
+	if g.CommentOut {
+		remove = CommentOutServerBlocks
+	}
+	modifiedContent, removed, err := remove(content, serverName)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &Result{ServerBlocks: removed}
+	if backup {
+		if err := g.backup(nginxPath, result); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := os.WriteFile(nginxPath, []byte(modifiedContent), 0644); err != nil {
+		return result, result.withBackup(fmt.Errorf("failed to write nginx config: %w", err))
+	}
+
+	return result, nil
+}
+
+func (g *Generator) FindServerBlocks(nginxPath, serverName string) ([]string, error) {
+	content, err := readConfig(nginxPath)
+	if err != nil {
+		return nil, err
+	}
+	return FindServers(content, serverName)
+}
+
+// FindOrphanedDefinitions returns the http-level definitions of nginxPath
+// that removing the servers named serverName also removes.
+func (g *Generator) FindOrphanedDefinitions(nginxPath, serverName string) ([]string, error) {
+	content, err := readConfig(nginxPath)
+	if err != nil {
+		return nil, err
+	}
+	return OrphanedDefinitions(content, serverName)
+}
+
+// ListServers describes every server block in the http section of content.
+func ListServers(content string) ([]ServerInfo, error) {
+	http, err := findHTTPBlock(content)
+	if err != nil {
+		return nil, err
+	}
+
+	var servers []ServerInfo
+	for _, server := range http.find("server") {
+		servers = append(servers, newServerInfo(server))
+	}
+	return servers, nil
+}
+
+// FindServers returns the text of every server block whose server_name
+// includes serverName.
+func FindServers(content, serverName string) ([]string, error) {
+	matches, err := findServersByName(content, serverName)
+	if err != nil {
+		return nil, err
+	}
+
+	blocks := make([]string, 0, len(matches))
+	for _, match := range matches {
+		start, _ := blockBounds(content, match)
+		blocks = append(blocks, content[start:match.end])
+	}
+	return blocks, nil
+}
+
+// OrphanedDefinitions returns the text of the http-level definitions, such
+// as upstream and geo blocks, that only the server blocks whose server_name
+// includes serverName refer to. RemoveServerBlocks deletes them together
+// with those blocks.
+func OrphanedDefinitions(content, serverName string) ([]string, error) {
+	http, err := findHTTPBlock(content)
+	if err != nil {
+		return nil, err
+	}
+	var definitions []string
+	for _, d := range orphanedDefinitions(content, http, "", serversNamed(http, serverName)) {
+		start, _ := blockBounds(content, d)
+		definitions = append(definitions, content[start:d.end])
+	}
+	return definitions, nil
+}
+
+// RemoveServerBlocks deletes every server block whose server_name includes
+// serverName, along with the http-level definitions only they referred to,
+// and returns the new content along with the removed server blocks.
+func RemoveServerBlocks(content, serverName string) (string, []string, error) {
+	http, err := findHTTPBlock(content)
+	if err != nil {
+		return "", nil, err
+	}
+	matches := serversNamed(http, serverName)
+	if len(matches) == 0 {
+		return "", nil, fmt.Errorf("no server block with server_name %q found", serverName)
+	}
+
+	removed := make([]string, 0, len(matches))
+	for _, match := range matches {
+		start, _ := blockBounds(content, match)
+		removed = append(removed, content[start:match.end])
+	}
+	orphaned := orphanedDefinitions(content, http, "", matches)
+	return removeBlocks(content, append(matches, orphaned...)), removed, nil
+}
+
+// CommentOutServerBlocks is like RemoveServerBlocks but keeps the matching
+// blocks in content, each line prefixed with "# " and the block preceded by
+// a comment recording when it was disabled.
+func CommentOutServerBlocks(content, serverName string) (string, []string, error) {
+	matches, err := findServersByName(content, serverName)
+	if err != nil {
+		return "", nil, err
+	}
+	if len(matches) == 0 {
+		return "", nil, fmt.Errorf("no server block with server_name %q found", serverName)
+	}
+
+	sorted := append([]*directive(nil), matches...)
+	sort.Slice(sorted, func(i, j int) bool {
+		return sorted[i].start > sorted[j].start
+	})
+
+	stamp := time.Now().UTC().Format(time.RFC3339)
+	removed := make([]string, len(sorted))
+	for i, block := range sorted {
+		start, _ := blockBounds(content, block)
+		indent := content[start:block.start]
+		removed[len(sorted)-1-i] = content[start:block.end]
+
+		lines := strings.Split(content[block.start:block.end], "\n")
+		commented := []string{fmt.Sprintf("%s# Disabled by nginx-tool on %s", indent, stamp)}
+		for _, line := range lines {
+			line = strings.TrimPrefix(line, indent)
+			if strings.TrimSpace(line) == "" {
+				commented = append(commented, indent+"#")
+				continue
+			}
+			commented = append(commented, indent+"# "+line)
+		}
+		content = content[:start] + strings.Join(commented, "\n") + content[block.end:]
+	}
+	return content, removed, nil
+}
+
+func newServerInfo(server *directive) ServerInfo {
+	info := ServerInfo{Line: server.line, Type: "static"}
+
+	for _, listen := range server.find("listen") {
+		info.Listens = append(info.Listens, strings.Join(listen.args, " "))
+	}
+	for _, serverName := range server.find("server_name") {
+		info.ServerNames = append(info.ServerNames, serverName.args...)
+	}
+	if root := server.find("root"); len(root) > 0 && len(root[0].args) > 0 {
+		info.Root = root[0].args[0]
+	}
+	if ret := server.find("return"); len(ret) > 0 {
+		info.Return = strings.Join(ret[0].args, " ")
+		info.Type = "redirect"
+	}
+	for _, location := range server.find("location") {
+		if ret := location.find("return"); info.Return == "" && len(location.args) == 1 && location.args[0] == "/" && len(ret) > 0 {
+			info.Return = strings.Join(ret[0].args, " ")
+			info.Type = "redirect"
+		}
+		if grpcPass := location.find("grpc_pass"); len(grpcPass) > 0 && len(grpcPass[0].args) > 0 {
+			info.ProxyPass = grpcPass[0].args[0]
+			info.Type = "grpc"
+			break
+		}
+		if proxyPass := location.find("proxy_pass"); len(proxyPass) > 0 && len(proxyPass[0].args) > 0 {
+			info.ProxyPass = proxyPass[0].args[0]
+			info.Type = "proxy"
+			break
+		}
+	}
+
+	return info
+}
+
+func findServersByName(content, serverName string) ([]*directive, error) {
+	http, err := findHTTPBlock(content)
+	if err != nil {
+		return nil, err
+	}
+	return serversNamed(http, serverName), nil
+}
+
+func serversNamed(http *directive, serverName string) []*directive {
+	var matches []*directive
+	for _, server := range http.find("server") {
+		for _, name := range newServerInfo(server).ServerNames {
+			if strings.EqualFold(name, serverName) {
+				matches = append(matches, server)
+				break
+			}
+		}
+	}
+	return matches
+}
+
+func blockBounds(content string, block *directive) (int, int) {
+	start := block.start
+	for start > 0 && (content[start-1] == ' ' || content[start-1] == '\t') {
+		start--
+	}
+	end := block.end
+	if end < len(content) && content[end] == '\n' {
+		end++
+	}
+	return start, end
+}
+
+func removeBlocks(content string, blocks []*directive) string {
+	sorted := append([]*directive(nil), blocks...)
+	sort.Slice(sorted, func(i, j int) bool {
+		return sorted[i].start > sorted[j].start
+	})
+
+	for _, block := range sorted {
+		start, end := blockBounds(content, block)
+		if strings.HasSuffix(content[:start], "\n\n") {
+			start--
+		}
+		content = content[:start] + content[end:]
+	}
+	return content
+}
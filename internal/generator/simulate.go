@@ -0,0 +1,262 @@
+package generator
+
+import (
+	"fmt"
+	"path"
+	"regexp"
+	"strings"
+)
+
+var capturePattern = regexp.MustCompile(`\$([0-9])`)
+
+// Simulation is the outcome of running a request URI through a server
+// block: the location that handled it and where the request ends up.
+type Simulation struct {
+	// Location is the matched location as written, e.g. "^~ /static/", or
+	// empty when no location matched.
+	Location string
+	// Kind is "proxy", "grpc", "file", "return", "redirect" or "internal".
+	Kind   string
+	Target string
+	// Rewrites lists the rewrites applied on the way, as "old -> new".
+	Rewrites []string
+}
+
+// SimulateRequest picks the location nginx would use for uri in the server
+// block serverBlock and resolves its proxy_pass, grpc_pass, return or root.
+// Locations are matched the way nginx does it: an exact match wins, then the
+// longest prefix if it is marked ^~, then the first matching regular
+// expression in order, and finally the longest prefix. Regular expressions
+// are evaluated with Go's regexp package, which covers the usual PCRE
+// syntax but not look-arounds or backreferences.
+func SimulateRequest(serverBlock, uri string) (*Simulation, error) {
+	directives, err := parseDirectives(serverBlock)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse server block: %w", err)
+	}
+	var server *directive
+	for _, d := range directives {
+		if d.name == "server" && d.isBlock() {
+			server = d
+			break
+		}
+	}
+	if server == nil {
+		return nil, fmt.Errorf("no server block found")
+	}
+	if !strings.HasPrefix(uri, "/") {
+		uri = "/" + uri
+	}
+
+	sim := &Simulation{}
+	if ret := server.find("return"); len(ret) > 0 {
+		sim.Kind, sim.Target = "return", strings.Join(ret[0].args, " ")
+		return sim, nil
+	}
+
+	// rewrite ... last restarts the location search; nginx gives up after
+	// ten cycles, and so do we.
+	for cycle := 0; cycle < 10; cycle++ {
+		location := matchLocation(server.find("location"), uri)
+		scope := server
+		sim.Location = ""
+		if location != nil {
+			scope = location
+			sim.Location = strings.Join(location.args, " ")
+		}
+
+		rewritten, restart, done := applyRewrites(sim, scope, uri)
+		if done {
+			return sim, nil
+		}
+		if restart {
+			uri = rewritten
+			continue
+		}
+		resolveTarget(sim, server, location, rewritten, rewritten != uri)
+		return sim, nil
+	}
+	return nil, fmt.Errorf("rewrite or internal redirection cycle while processing %q", uri)
+}
+
+func matchLocation(locations []*directive, uri string) *directive {
+	var longest *directive
+	longestLen := -1
+	for _, location := range locations {
+		modifier, pattern := locationPattern(location)
+		switch modifier {
+		case "=":
+			if pattern == uri {
+				return location
+			}
+		case "", "^~":
+			if strings.HasPrefix(uri, pattern) && len(pattern) > longestLen {
+				longest, longestLen = location, len(pattern)
+			}
+		}
+	}
+	if longest != nil {
+		if modifier, _ := locationPattern(longest); modifier == "^~" {
+			return longest
+		}
+	}
+
+	for _, location := range locations {
+		modifier, pattern := locationPattern(location)
+		if modifier != "~" && modifier != "~*" {
+			continue
+		}
+		if modifier == "~*" {
+			pattern = "(?i)" + pattern
+		}
+		if re, err := regexp.Compile(pattern); err == nil && re.MatchString(uri) {
+			return location
+		}
+	}
+	return longest
+}
+
+func locationPattern(location *directive) (string, string) {
+	switch len(location.args) {
+	case 1:
+		if strings.HasPrefix(location.args[0], "@") {
+			return "@", location.args[0]
+		}
+		return "", location.args[0]
+	case 2:
+		return location.args[0], location.args[1]
+	}
+	return "@", ""
+}
+
+// applyRewrites runs the rewrite directives of scope over uri. It reports
+// the resulting URI, whether the location search starts over (last) and
+// whether the request was answered with a redirect.
+func applyRewrites(sim *Simulation, scope *directive, uri string) (string, bool, bool) {
+	for _, rewrite := range scope.find("rewrite") {
+		if len(rewrite.args) < 2 {
+			continue
+		}
+		re, err := regexp.Compile(rewrite.args[0])
+		if err != nil {
+			continue
+		}
+		match := re.FindStringSubmatchIndex(uri)
+		if match == nil {
+			continue
+		}
+		replacement := capturePattern.ReplaceAllString(rewrite.args[1], "$${$1}")
+		rewritten := string(re.ExpandString(nil, replacement, uri, match))
+		sim.Rewrites = append(sim.Rewrites, uri+" -> "+rewritten)
+
+		flag := ""
+		if len(rewrite.args) > 2 {
+			flag = rewrite.args[2]
+		}
+		switch {
+		case flag == "redirect" || flag == "permanent" || strings.HasPrefix(rewritten, "http://") || strings.HasPrefix(rewritten, "https://"):
+			code := "302"
+			if flag == "permanent" {
+				code = "301"
+			}
+			sim.Kind, sim.Target = "redirect", code+" "+rewritten
+			return rewritten, false, true
+		case flag == "last":
+			return rewritten, true, false
+		case flag == "break":
+			return rewritten, false, false
+		}
+		uri = rewritten
+	}
+	return uri, false, false
+}
+
+func resolveTarget(sim *Simulation, server, location *directive, uri string, rewritten bool) {
+	scope := server
+	if location != nil {
+		scope = location
+	}
+
+	switch {
+	case location != nil && len(location.find("internal")) > 0:
+		sim.Kind, sim.Target = "internal", "404 (internal locations only serve internal redirects)"
+	case len(scope.find("return")) > 0:
+		sim.Kind, sim.Target = "return", strings.Join(scope.find("return")[0].args, " ")
+	case len(scope.find("proxy_pass")) > 0 && len(scope.find("proxy_pass")[0].args) > 0:
+		sim.Kind, sim.Target = "proxy", proxiedURL(scope.find("proxy_pass")[0].args[0], location, uri, rewritten)
+	case len(scope.find("grpc_pass")) > 0 && len(scope.find("grpc_pass")[0].args) > 0:
+		sim.Kind, sim.Target = "grpc", scope.find("grpc_pass")[0].args[0]
+	case location != nil && len(location.find("alias")) > 0 && len(location.find("alias")[0].args) > 0:
+		sim.Kind, sim.Target = "file", aliasedPath(location, location.find("alias")[0].args[0], uri)
+	default:
+		root := inheritedArg(server, location, "root", "html")
+		file := uri
+		if strings.HasSuffix(file, "/") {
+			file += strings.Fields(inheritedArg(server, location, "index", "index.html"))[0]
+		}
+		sim.Kind, sim.Target = "file", path.Join(root, file)
+	}
+}
+
+// proxiedURL returns the URL nginx requests from the backend. A proxy_pass
+// with a URI part replaces the matched location prefix with it, unless the
+// URI was changed by a rewrite, in which case the full URI is passed.
+func proxiedURL(target string, location *directive, uri string, rewritten bool) string {
+	if strings.Contains(target, "$") {
+		return target
+	}
+	scheme, rest, ok := strings.Cut(target, "://")
+	if !ok {
+		return target + uri
+	}
+	host, targetPath, hasPath := strings.Cut(rest, "/")
+	if !hasPath {
+		return target + uri
+	}
+	base := scheme + "://" + host
+	if rewritten || location == nil {
+		return base + uri
+	}
+	modifier, pattern := locationPattern(location)
+	if modifier != "" && modifier != "^~" && modifier != "=" {
+		return base + uri
+	}
+	return base + "/" + targetPath + strings.TrimPrefix(uri, pattern)
+}
+
+// aliasedPath returns the file an alias location serves for uri: the alias
+// in place of the matched prefix, or with the captures of a regex location
+// filled in.
+func aliasedPath(location *directive, alias, uri string) string {
+	modifier, pattern := locationPattern(location)
+	switch modifier {
+	case "~", "~*":
+		if modifier == "~*" {
+			pattern = "(?i)" + pattern
+		}
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return alias
+		}
+		match := re.FindStringSubmatchIndex(uri)
+		if match == nil {
+			return alias
+		}
+		return string(re.ExpandString(nil, capturePattern.ReplaceAllString(alias, "$${$1}"), uri, match))
+	case "=":
+		return alias
+	}
+	return alias + strings.TrimPrefix(uri, pattern)
+}
+
+func inheritedArg(server, location *directive, name, fallback string) string {
+	for _, scope := range []*directive{location, server} {
+		if scope == nil {
+			continue
+		}
+		if found := scope.find(name); len(found) > 0 && len(found[0].args) > 0 {
+			return strings.Join(found[0].args, " ")
+		}
+	}
+	return fallback
+}
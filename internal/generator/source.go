@@ -0,0 +1,82 @@
+package generator
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+)
+
+type ConfigReader interface {
+	ReadConfig() (string, error)
+}
+
+type FileReader struct {
+	Path string
+}
+
+func (r FileReader) ReadConfig() (string, error) {
+	file, err := os.Open(r.Path)
+	if err != nil {
+		return "", fmt.Errorf("failed to read nginx config: %w", err)
+	}
+	defer file.Close()
+
+	data, err := io.ReadAll(file)
+	if err != nil {
+		return "", fmt.Errorf("failed to read nginx config: %w", err)
+	}
+	return string(data), nil
+}
+
+type HTTPReader struct {
+	URL    string
+	Client *http.Client
+}
+
+func (r HTTPReader) ReadConfig() (string, error) {
+	client := r.Client
+	if client == nil {
+		client = &http.Client{Timeout: 30 * time.Second}
+	}
+
+	resp, err := client.Get(r.URL)
+	if err != nil {
+		return "", fmt.Errorf("failed to fetch nginx config: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("failed to fetch nginx config: %s returned %s", r.URL, resp.Status)
+	}
+
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return "", fmt.Errorf("failed to fetch nginx config: %w", err)
+	}
+	return string(data), nil
+}
+
+func NewConfigReader(location string) ConfigReader {
+	if IsRemote(location) {
+		return HTTPReader{URL: location}
+	}
+	return FileReader{Path: location}
+}
+
+func IsRemote(location string) bool {
+	return strings.HasPrefix(location, "http://") || strings.HasPrefix(location, "https://")
+}
+
+func readConfig(nginxPath string) (string, error) {
+	return NewConfigReader(nginxPath).ReadConfig()
+}
+
+func checkWritable(nginxPath string) error {
+	if IsRemote(nginxPath) {
+		return fmt.Errorf("%s is a remote configuration and can only be previewed", nginxPath)
+	}
+	return nil
+}
@@ -0,0 +1,394 @@
+package generator
+
+import (
+	"embed"
+	"fmt"
+	"net/url"
+	"nginx_tool/internal/config"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/template"
+	"time"
+)
+
+//go:embed templates/*.tmpl
+var templateFS embed.FS
+
+var templateFuncs = template.FuncMap{
+	"join":  strings.Join,
+	"http2": withHTTP2,
+	"quote": quoteArg,
+}
+
+var builtinTemplates = template.Must(template.New("builtin").Funcs(templateFuncs).ParseFS(templateFS, "templates/*.tmpl"))
+
+// BuiltinTemplate returns the source of the embedded template for serverType,
+// as a starting point for a custom -template file.
+func BuiltinTemplate(serverType string) (string, error) {
+	text, err := templateFS.ReadFile("templates/" + serverType + ".conf.tmpl")
+	if err != nil {
+		return "", fmt.Errorf("no built-in template for server type %q", serverType)
+	}
+	return string(text), nil
+}
+
+func builtinTemplate(serverType string) (*template.Template, error) {
+	tmpl := builtinTemplates.Lookup(serverType + ".conf.tmpl")
+	if tmpl == nil {
+		return nil, fmt.Errorf("no built-in template for server type %q", serverType)
+	}
+	return tmpl, nil
+}
+
+// TemplateData is passed to server block templates. ServerConfig fields are
+// promoted, so templates can use {{.ServerName}}, {{.Root}} and so on, with
+// defaults already applied. ServerName holds every configured name joined by
+// spaces, NameLines the same names split over lines of reasonable length,
+// and ListenValues every listen value, with Listen set to the first. In the
+// built-in templates, HTTP2 asks for "http2 on;" in place of the http2 listen
+// parameter.
+type TemplateData struct {
+	config.ServerConfig
+	NameLines      []string
+	ProxyTarget    string
+	GRPCTarget     string
+	ListenValues   []string
+	ProxySSL       bool
+	HTTP2          bool
+	ProxyBackend   string
+	RedirectTarget string
+	AddHeaders     []Header
+	AuthHeaders    []AuthHeader
+	ErrorPages     []ErrorPage
+	CacheZone      string
+	CacheValid     []string
+	DotfilesPath   string
+	HostHeader     string
+	// LocationHost is the Host header of proxied extra locations. It is
+	// HostHeader before a keepalive upstream replaced $proxy_host with the
+	// host of location /, since their proxy_pass goes elsewhere.
+	LocationHost  string
+	BlockedVar    string
+	AccessLogArgs string
+	BufferSize    string
+	RawLines      []string
+}
+
+// Enabled reports whether a default proxy header or directive is kept, that
+// is, not listed in disable_headers.
+func (d TemplateData) Enabled(name string) bool {
+	for _, pattern := range d.DisableHeaders {
+		if config.MatchesDirective(pattern, name) {
+			return false
+		}
+	}
+	return true
+}
+
+func newTemplateData(cfg *config.ServerConfig) TemplateData {
+	data := TemplateData{
+		ServerConfig:   *cfg,
+		ProxyTarget:    proxyTarget(cfg),
+		RedirectTarget: strings.TrimRight(cfg.RedirectTo, "/"),
+		GRPCTarget:     grpcTarget(cfg),
+	}
+	data.ServerName = strings.Join(cfg.Names(), " ")
+	data.NameLines = serverNameLines(cfg.Names())
+	data.Index = strings.Join(cfg.IndexList(), " ")
+	data.ListenValues = cfg.ListenValues()
+	data.Listen = data.ListenValues[0]
+	data.Locations, _ = OrderLocations(cfg.AllLocations())
+	for i, location := range data.Locations {
+		if location.Upstream != "" {
+			data.Locations[i].ProxyPass = locationTarget(location)
+		}
+		// alias replaces the matched prefix, so a location ending in a
+		// slash needs an alias that ends in one as well.
+		if modifier, uri := location.Modifier(); location.Alias != "" && (modifier == "" || modifier == "^~") &&
+			strings.HasSuffix(uri, "/") && !strings.HasSuffix(location.Alias, "/") {
+			data.Locations[i].Alias += "/"
+		}
+	}
+	data.AddHeaders = responseHeaders(cfg)
+	data.AuthHeaders = authHeaders(cfg)
+	data.DotfilesPath = `~ /\.`
+	if data.ACMEChallenge {
+		data.DotfilesPath = `~ /\.(?!well-known/)`
+	}
+	data.ProxySSL = strings.HasPrefix(data.ProxyTarget, "https://")
+	data.HostHeader = hostHeader(cfg)
+	data.LocationHost = data.HostHeader
+	if upstream, target := upstreamFor(cfg); upstream != nil {
+		// Behind an upstream, $proxy_host is the upstream name, so keep
+		// sending the backend's own hostname for SNI.
+		if u, err := url.Parse(data.ProxyTarget); err == nil && data.ProxySSL && data.ProxySSLName == "" {
+			data.ProxySSLName = u.Hostname()
+		}
+		// $proxy_host would likewise be the upstream name; a single
+		// backend keeps its own.
+		if u, err := url.Parse(data.ProxyTarget); err == nil && data.HostHeader == "$proxy_host" && len(cfg.Upstreams) == 0 && u.Host != "" {
+			data.HostHeader = u.Host
+		}
+		data.ProxyTarget = target
+	}
+	if data.Resolver != "" {
+		if !strings.Contains(data.Resolver, "valid=") {
+			data.Resolver += " valid=30s"
+		}
+		data.ProxyBackend, data.ProxyTarget = resolvedTarget(data.ProxyTarget)
+	}
+	if data.LimitConn > 0 {
+		data.LimitConnZone = limitConnZone(cfg)
+	}
+	if cfg.AccessLog != nil {
+		data.AccessLogArgs = accessLogArgs(cfg)
+	}
+	data.BufferSize = cfg.ProxyBufferSize
+	if cfg.ProxyCache != nil {
+		data.CacheZone = cacheZone(cfg)
+		data.CacheValid = cacheValid(cfg.ProxyCache)
+	}
+	if cfg.WebDAV != nil {
+		data.WebDAV = webDAV(cfg.WebDAV)
+	}
+	if (data.Gzip || data.Brotli) && len(data.CompressTypes) == 0 {
+		data.CompressTypes = defaultCompressTypes
+	}
+	if data.Brotli && data.BrotliLevel == 0 {
+		data.BrotliLevel = 6
+	}
+	if data.MaintenanceFlag == "" {
+		data.MaintenanceFlag = "/etc/nginx/maintenance.on"
+	}
+	if data.MaintenancePage == "" {
+		data.MaintenancePage = "/maintenance.html"
+	}
+	if data.MaintenanceRoot == "" {
+		data.MaintenanceRoot = "/usr/share/nginx/html"
+	}
+	if data.ErrorRoot == "" {
+		data.ErrorRoot = "/usr/share/nginx/html"
+	}
+	if data.ProxySSLVerify && data.ProxySSLCA == "" {
+		data.ProxySSLCA = "/etc/ssl/certs/ca-certificates.crt"
+	}
+	if data.RedirectCode == 0 {
+		data.RedirectCode = 301
+	}
+	if len(data.CacheExtensions) == 0 {
+		data.CacheExtensions = []string{"jpg", "jpeg", "png", "gif", "svg", "ico", "css", "js", "woff2"}
+	}
+	if data.CacheExpires == "" {
+		data.CacheExpires = "30d"
+	}
+	data.ErrorPages = errorPages(&data.ServerConfig)
+	data.RawLines = rawLines(cfg.RawDirectives)
+	data.BlockedVar = blockedVariable(cfg)
+	return data
+}
+
+// webDAV returns a copy of dav with defaults applied. The temporary
+// directory defaults to one under /var/lib/nginx, which packaged nginx
+// already owns; PUT moves the upload into place, which is cheapest when
+// both are on the same file system.
+func webDAV(dav *config.WebDAVConfig) *config.WebDAVConfig {
+	out := *dav
+	out.Methods = dav.MethodList()
+	if out.Path == "" {
+		out.Path = "/webdav/"
+	}
+	if out.Access == "" {
+		out.Access = "user:rw"
+	}
+	if out.TempPath == "" {
+		out.TempPath = "/var/lib/nginx/dav_temp"
+	}
+	return &out
+}
+
+// rawLines splits raw directives into non-blank lines, removing the
+// indentation all lines of a snippet share so the template can indent them
+// as one block.
+func rawLines(raw []string) []string {
+	var out []string
+	for _, snippet := range raw {
+		lines := strings.Split(strings.Trim(snippet, "\n"), "\n")
+		common := -1
+		for _, line := range lines {
+			if strings.TrimSpace(line) == "" {
+				continue
+			}
+			if n := len(line) - len(strings.TrimLeft(line, " \t")); common < 0 || n < common {
+				common = n
+			}
+		}
+		for _, line := range lines {
+			line = strings.TrimRight(line, " \t")
+			if line == "" {
+				continue
+			}
+			out = append(out, line[common:])
+		}
+	}
+	return out
+}
+
+func (g *Generator) GenerateFromTemplate(cfg *config.ServerConfig, templatePath string) (string, error) {
+	text, err := os.ReadFile(templatePath)
+	if err != nil {
+		return "", fmt.Errorf("failed to read template: %w", err)
+	}
+
+	tmpl, err := template.New(filepath.Base(templatePath)).Funcs(templateFuncs).Parse(string(text))
+	if err != nil {
+		return "", fmt.Errorf("failed to parse template: %w", err)
+	}
+	return g.render(tmpl, cfg, newTemplateData(cfg))
+}
+
+func (g *Generator) render(tmpl *template.Template, cfg *config.ServerConfig, data TemplateData) (string, error) {
+	var b strings.Builder
+	if err := tmpl.Execute(&b, data); err != nil {
+		return "", fmt.Errorf("failed to render %s template: %w", tmpl.Name(), err)
+	}
+	return g.addBanner(strings.TrimRight(b.String(), " \t\n"), cfg), nil
+}
+
+// setHTTP2 moves the http2 listen parameter of the built-in templates into
+// "http2 on;", which nginx 1.25.1 and later expect, unless HTTP2Listen asks
+// for the parameter older versions need. required turns HTTP/2 on for a
+// server that cannot work without it, such as a gRPC proxy.
+func (g *Generator) setHTTP2(data *TemplateData, required bool) {
+	enabled := required
+	for i, listen := range data.ListenValues {
+		if g.HTTP2Listen {
+			if required {
+				data.ListenValues[i] = withHTTP2(listen)
+			}
+			continue
+		}
+		fields := strings.Fields(listen)
+		kept := fields[:min(1, len(fields))]
+		for _, param := range fields[len(kept):] {
+			if param == "http2" {
+				enabled = true
+				continue
+			}
+			kept = append(kept, param)
+		}
+		data.ListenValues[i] = strings.Join(kept, " ")
+	}
+	data.Listen = data.ListenValues[0]
+	data.HTTP2 = enabled && !g.HTTP2Listen
+}
+
+// addBanner inserts the generated-by comment and the reapply marker right
+// after the first "server {" line.
+func (g *Generator) addBanner(block string, cfg *config.ServerConfig) string {
+	if !g.Banner {
+		return block
+	}
+
+	lines := strings.Split(block, "\n")
+	for i, line := range lines {
+		if strings.TrimSpace(line) != "server {" {
+			continue
+		}
+
+		indent := line[:len(line)-len(strings.TrimLeft(line, " \t"))] + "    "
+		source := "interactive input"
+		if cfg.Source != "" {
+			source = filepath.Base(cfg.Source)
+		}
+		banner := []string{
+			fmt.Sprintf("%s# Generated by nginx-tool %s from %s on %s", indent, g.Version, source, time.Now().UTC().Format(time.RFC3339)),
+			indent + markerLine(strings.Join(cfg.Names(), " ")),
+		}
+
+		lines = append(lines[:i+1], append(banner, lines[i+1:]...)...)
+		break
+	}
+	return strings.Join(lines, "\n")
+}
+
+// serverNameLines splits names over several server_name directives once a
+// line would grow past maxServerNameLine bytes, which keeps configs with
+// hundreds of names readable and well within nginx's parser buffer.
+const maxServerNameLine = 512
+
+func serverNameLines(names []string) []string {
+	var lines []string
+	var line string
+	for _, name := range names {
+		if line != "" && len(line)+1+len(name) > maxServerNameLine {
+			lines = append(lines, line)
+			line = ""
+		}
+		if line != "" {
+			line += " "
+		}
+		line += name
+	}
+	return append(lines, line)
+}
+
+// resolvedTarget splits target into the host nginx should re-resolve at
+// runtime and a proxy_pass value that refers to it through $backend. A
+// variable in proxy_pass is what makes nginx consult the resolver, so a
+// host already built from variables, such as server_name captures, is kept.
+func resolvedTarget(target string) (string, string) {
+	u, err := url.Parse(target)
+	if err != nil || u.Host == "" || strings.Contains(u.Host, "$") {
+		return "", target
+	}
+	return u.Host, u.Scheme + "://$backend" + strings.TrimPrefix(target, u.Scheme+"://"+u.Host)
+}
+
+func grpcTarget(cfg *config.ServerConfig) string {
+	switch {
+	case cfg.GRPCPass != "":
+		return cfg.GRPCPass
+	case cfg.ProxySocket != "":
+		return "unix:" + cfg.ProxySocket
+	case cfg.ProxyPort != "":
+		return "grpc://127.0.0.1:" + cfg.ProxyPort
+	}
+	return ""
+}
+
+// withHTTP2 adds the http2 parameter to a listen value that lacks it, the
+// form nginx versions before 1.25.1 need instead of "http2 on;".
+func withHTTP2(listen string) string {
+	for _, param := range strings.Fields(listen) {
+		if param == "http2" {
+			return listen
+		}
+	}
+	return listen + " http2"
+}
+
+// hostHeader is the Host header location / sends to the backend: the one
+// the client asked for by default, the backend's own for "upstream", or
+// the configured value.
+func hostHeader(cfg *config.ServerConfig) string {
+	switch cfg.ProxyHost {
+	case "":
+		return "$host"
+	case "upstream":
+		return "$proxy_host"
+	}
+	return cfg.ProxyHost
+}
+
+func proxyTarget(cfg *config.ServerConfig) string {
+	switch {
+	case cfg.ProxyPass != "":
+		return cfg.ProxyPass
+	case cfg.ProxySocket != "":
+		return fmt.Sprintf("http://unix:%s:", cfg.ProxySocket)
+	case cfg.ProxyPort != "":
+		return fmt.Sprintf("http://127.0.0.1:%s", cfg.ProxyPort)
+	}
+	return ""
+}
@@ -0,0 +1,142 @@
+package generator
+
+import (
+	"nginx_tool/internal/config"
+	"strings"
+	"testing"
+)
+
+func TestBuiltinTemplatesLintClean(t *testing.T) {
+	tests := []struct {
+		serverType string
+		cfg        config.ServerConfig
+	}{
+		{"static", config.ServerConfig{Listen: "443 ssl http2", ServerName: "static.example.com", Root: "/srv/www"}},
+		{"proxy", config.ServerConfig{Listen: "443 ssl http2", ServerName: "proxy.example.com", ProxyPort: "3000"}},
+		{"grpc", config.ServerConfig{Listen: "443 ssl", ServerName: "grpc.example.com", GRPCPass: "grpc://127.0.0.1:50051"}},
+		{"redirect", config.ServerConfig{Listen: "443 ssl http2", ServerName: "old.example.com", RedirectTo: "https://example.com"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.serverType, func(t *testing.T) {
+			block, err := New().GenerateServerBlock(&tt.cfg, tt.serverType)
+			if err != nil {
+				t.Fatalf("GenerateServerBlock: %v", err)
+			}
+			warnings, err := Lint(block)
+			if err != nil {
+				t.Fatalf("Lint: %v", err)
+			}
+			for _, warning := range warnings {
+				t.Errorf("line %d: %s", warning.Line, warning.Message)
+			}
+			if !strings.Contains(block, "http2 on;") {
+				t.Errorf("block does not turn http2 on:\n%s", block)
+			}
+		})
+	}
+}
+
+func TestHTTP2ListenForOldNginx(t *testing.T) {
+	gen := New()
+	gen.HTTP2Listen = true
+	cfg := config.ServerConfig{Listen: "443 ssl", ServerName: "grpc.example.com", GRPCPass: "grpc://127.0.0.1:50051"}
+	block, err := gen.GenerateServerBlock(&cfg, "grpc")
+	if err != nil {
+		t.Fatalf("GenerateServerBlock: %v", err)
+	}
+	if !strings.Contains(block, "listen 443 ssl http2;") || strings.Contains(block, "http2 on;") {
+		t.Errorf("want the http2 listen parameter only, got:\n%s", block)
+	}
+}
+
+func TestProxySocketTarget(t *testing.T) {
+	tests := []struct {
+		name string
+		cfg  config.ServerConfig
+		want []string
+	}{
+		{
+			name: "socket",
+			cfg:  config.ServerConfig{ProxySocket: "/run/app.sock"},
+			want: []string{"proxy_pass http://unix:/run/app.sock:;"},
+		},
+		{
+			name: "socket URL",
+			cfg:  config.ServerConfig{ProxyPass: "http://unix:/run/app.sock:/"},
+			want: []string{"proxy_pass http://unix:/run/app.sock:/;"},
+		},
+		{
+			name: "socket upstream",
+			cfg:  config.ServerConfig{ProxySocket: "/run/app.sock", Keepalive: 8},
+			want: []string{
+				"upstream app_example_com_backend {",
+				"server unix:/run/app.sock;",
+				"proxy_pass http://app_example_com_backend;",
+			},
+		},
+		{
+			name: "upstream name",
+			cfg:  config.ServerConfig{ProxyPass: "http://backend"},
+			want: []string{"proxy_pass http://backend;"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.cfg.Listen = "80"
+			tt.cfg.ServerName = "app.example.com"
+			if err := tt.cfg.Validate(); err != nil {
+				t.Fatalf("Validate: %v", err)
+			}
+			block, err := New().GenerateServerBlock(&tt.cfg, "proxy")
+			if err != nil {
+				t.Fatalf("GenerateServerBlock: %v", err)
+			}
+			for _, want := range tt.want {
+				if !strings.Contains(block, want) {
+					t.Errorf("block lacks %q:\n%s", want, block)
+				}
+			}
+		})
+	}
+}
+
+func TestExtraLocationHostHeader(t *testing.T) {
+	tests := []struct {
+		name      string
+		proxyHost string
+		keepalive int
+		want      string
+	}{
+		{name: "default", want: "proxy_set_header Host $host;"},
+		{name: "upstream", proxyHost: "upstream", want: "proxy_set_header Host $proxy_host;"},
+		{name: "upstream behind keepalive", proxyHost: "upstream", keepalive: 8, want: "proxy_set_header Host $proxy_host;"},
+		{name: "literal", proxyHost: "internal.example.com", want: "proxy_set_header Host internal.example.com;"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := config.ServerConfig{
+				Listen:     "80",
+				ServerName: "app.example.com",
+				ProxyPass:  "http://app.internal:3000",
+				ProxyHost:  tt.proxyHost,
+				Keepalive:  tt.keepalive,
+				Locations:  []config.LocationConfig{{Path: "/files/", ProxyPass: "http://files.internal:9000"}},
+			}
+			if err := cfg.Validate(); err != nil {
+				t.Fatalf("Validate: %v", err)
+			}
+			block, err := New().GenerateServerBlock(&cfg, "proxy")
+			if err != nil {
+				t.Fatalf("GenerateServerBlock: %v", err)
+			}
+			_, location, ok := strings.Cut(block, "location /files/ {")
+			if !ok {
+				t.Fatalf("no extra location in:\n%s", block)
+			}
+			location, _, _ = strings.Cut(location, "}")
+			if !strings.Contains(location, tt.want) {
+				t.Errorf("extra location lacks %q:\n%s", tt.want, block)
+			}
+		})
+	}
+}
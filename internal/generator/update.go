@@ -0,0 +1,153 @@
+package generator
+
+import (
+	"errors"
+	"fmt"
+	"nginx_tool/internal/config"
+	"os"
+	"strings"
+)
+
+var ErrNoMatchingServer = errors.New("no matching server block")
+
+// UpdateServerBlock regenerates the server block whose server_name matches
+// one of cfg's names and writes it back in the same position. Unlike
+// -reapply it matches on the server_name directive, so blocks not written by
+// this tool can be updated too.
+func (g *Generator) UpdateServerBlock(cfg *config.ServerConfig, nginxPath, serverType string, backup bool) (*Result, error) {
+	if err := checkWritable(nginxPath); err != nil {
+		return nil, err
+	}
+
+	serverBlock, err := g.GenerateServerBlock(cfg, serverType)
+	if err != nil {
+		return nil, err
+	}
+
+	content, err := readConfig(nginxPath)
+	if err != nil {
+		return nil, err
+	}
+	modifiedContent, _, err := UpdateServer(content, serverBlock, g.matchNames(cfg))
+	if err != nil {
+		return nil, err
+	}
+
+	result := &Result{ServerBlocks: []string{serverBlock}, Replaced: 1}
+	if backup {
+		if err := g.backup(nginxPath, result); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := os.WriteFile(nginxPath, []byte(modifiedContent), 0644); err != nil {
+		return result, result.withBackup(fmt.Errorf("failed to write nginx config: %w", err))
+	}
+	result.Lines = []int{blockLine(modifiedContent, serverBlock)}
+	return result, nil
+}
+
+// PreviewUpdate returns the current server block that UpdateServerBlock
+// would replace and the block that would take its place.
+func (g *Generator) PreviewUpdate(cfg *config.ServerConfig, nginxPath, serverType string) (string, string, error) {
+	serverBlock, err := g.GenerateServerBlock(cfg, serverType)
+	if err != nil {
+		return "", "", err
+	}
+	content, err := readConfig(nginxPath)
+	if err != nil {
+		return "", "", err
+	}
+	_, previous, err := UpdateServer(content, serverBlock, g.matchNames(cfg))
+	if err != nil {
+		return "", "", err
+	}
+	return previous, serverBlock, nil
+}
+
+// CurrentServerBlock returns the text of the single server block whose
+// server_name includes one of names, the block UpdateServerBlock replaces.
+// The http-level definitions it refers to, such as its upstream, come first,
+// laid out as GenerateServerBlock writes them, so config.ParseServerBlock
+// can read both back.
+func (g *Generator) CurrentServerBlock(nginxPath string, names []string) (string, error) {
+	content, err := readConfig(nginxPath)
+	if err != nil {
+		return "", err
+	}
+	http, err := findHTTPBlock(content)
+	if err != nil {
+		return "", err
+	}
+	server, err := findServerToUpdate(http, names)
+	if err != nil {
+		return "", err
+	}
+
+	var blocks []string
+	for _, d := range http.children {
+		if ref, ok := definitionRef(d); ok && refersTo(content[server.start:server.end], ref) {
+			start, _ := blockBounds(content, d)
+			blocks = append(blocks, content[start:d.end])
+		}
+	}
+	start, _ := blockBounds(content, server)
+	return strings.Join(append(blocks, content[start:server.end]), "\n\n"), nil
+}
+
+func (g *Generator) matchNames(cfg *config.ServerConfig) []string {
+	if len(g.Match) > 0 {
+		return g.Match
+	}
+	return cfg.Names()
+}
+
+// UpdateServer replaces the single server block whose server_name includes
+// one of names with serverBlock and returns the new content along with the
+// text of the block it replaced.
+func UpdateServer(content, serverBlock string, names []string) (string, string, error) {
+	http, err := findHTTPBlock(content)
+	if err != nil {
+		return "", "", err
+	}
+
+	match, err := findServerToUpdate(http, names)
+	if err != nil {
+		return "", "", err
+	}
+
+	prepared, stale, err := prepareBlock(content, http, serverBlock, []*directive{match})
+	if err != nil {
+		return "", "", err
+	}
+
+	start, _ := blockBounds(content, match)
+	result, err := replaceServer(content, match, prepared, serverBlock, stale)
+	if err != nil {
+		return "", "", err
+	}
+	return result, content[start:match.end], nil
+}
+
+func findServerToUpdate(http *directive, names []string) (*directive, error) {
+	var matches []*directive
+	for _, name := range names {
+		for _, server := range serversNamed(http, name) {
+			if !containsDirective(matches, server) {
+				matches = append(matches, server)
+			}
+		}
+	}
+
+	switch len(matches) {
+	case 0:
+		return nil, fmt.Errorf("%w for server_name %s; use add to create it", ErrNoMatchingServer, strings.Join(names, " "))
+	case 1:
+		return matches[0], nil
+	}
+	lines := make([]string, 0, len(matches))
+	for _, match := range matches {
+		lines = append(lines, fmt.Sprint(match.line))
+	}
+	return nil, fmt.Errorf("%d server blocks match server_name %s (lines %s); remove the extras before updating", len(matches), strings.Join(names, " "), strings.Join(lines, ", "))
+}
@@ -0,0 +1,170 @@
+package generator
+
+import (
+	"fmt"
+	"net/url"
+	"nginx_tool/internal/config"
+	"strings"
+)
+
+type upstreamSpec struct {
+	name      string
+	servers   []config.UpstreamServer
+	keepalive int
+	// maxFails and failTimeout apply to servers that do not set their own.
+	maxFails    int
+	failTimeout string
+}
+
+// upstreamFor returns the upstream block cfg proxies through, together with
+// the proxy_pass that refers to it, or nil when the server proxies directly.
+func upstreamFor(cfg *config.ServerConfig) (*upstreamSpec, string) {
+	target := proxyTarget(cfg)
+	if len(cfg.Upstreams) > 0 {
+		return balancedUpstream(cfg, target)
+	}
+	if cfg.Keepalive == 0 || target == "" {
+		return nil, target
+	}
+
+	spec := newUpstreamSpec(cfg)
+	if rest, ok := strings.CutPrefix(target, "http://unix:"); ok {
+		socket, uri, _ := strings.Cut(rest, ":")
+		spec.servers = []config.UpstreamServer{{Address: "unix:" + socket}}
+		return spec, "http://" + spec.name + uri
+	}
+
+	u, err := url.Parse(target)
+	if err != nil || u.Host == "" {
+		return nil, target
+	}
+	server := u.Host
+	if u.Port() == "" && u.Scheme == "https" {
+		server += ":443"
+	}
+	spec.servers = []config.UpstreamServer{{Address: server}}
+	return spec, u.Scheme + "://" + spec.name + strings.TrimPrefix(target, u.Scheme+"://"+u.Host)
+}
+
+// balancedUpstream builds the upstream for an explicit upstreams list. A
+// proxy_pass, if any, only supplies the scheme and URI; its host is replaced
+// by the upstream name.
+func balancedUpstream(cfg *config.ServerConfig, target string) (*upstreamSpec, string) {
+	spec := newUpstreamSpec(cfg)
+	spec.servers = cfg.Upstreams
+
+	u, err := url.Parse(target)
+	if err != nil || u.Host == "" {
+		return spec, "http://" + spec.name
+	}
+	return spec, u.Scheme + "://" + spec.name + strings.TrimPrefix(target, u.Scheme+"://"+u.Host)
+}
+
+// locationUpstreams returns the upstream groups referenced by cfg's
+// locations, each once and in the order they are defined.
+func locationUpstreams(cfg *config.ServerConfig) []*upstreamSpec {
+	used := make(map[string]bool)
+	for _, location := range cfg.Locations {
+		used[location.Upstream] = location.Upstream != ""
+	}
+
+	var specs []*upstreamSpec
+	for _, group := range cfg.UpstreamGroups {
+		if used[group.Name] {
+			specs = append(specs, &upstreamSpec{
+				name:        group.Name,
+				servers:     group.Servers,
+				maxFails:    cfg.MaxFails,
+				failTimeout: cfg.FailTimeout,
+			})
+		}
+	}
+	return specs
+}
+
+// locationTarget is the proxy_pass of a location routed to an upstream
+// group. A proxy_pass on the location supplies the scheme and URI.
+func locationTarget(location config.LocationConfig) string {
+	u, err := url.Parse(location.ProxyPass)
+	if err != nil || u.Host == "" {
+		return "http://" + location.Upstream
+	}
+	return u.Scheme + "://" + location.Upstream + strings.TrimPrefix(location.ProxyPass, u.Scheme+"://"+u.Host)
+}
+
+func newUpstreamSpec(cfg *config.ServerConfig) *upstreamSpec {
+	return &upstreamSpec{
+		name:        upstreamName(cfg),
+		keepalive:   cfg.Keepalive,
+		maxFails:    cfg.MaxFails,
+		failTimeout: cfg.FailTimeout,
+	}
+}
+
+func (spec *upstreamSpec) serverArgs(server config.UpstreamServer) string {
+	if server.MaxFails == 0 {
+		server.MaxFails = spec.maxFails
+	}
+	if server.FailTimeout == "" {
+		server.FailTimeout = spec.failTimeout
+	}
+
+	args := []string{server.Address}
+	if server.Weight > 0 {
+		args = append(args, fmt.Sprintf("weight=%d", server.Weight))
+	}
+	if server.MaxFails > 0 {
+		args = append(args, fmt.Sprintf("max_fails=%d", server.MaxFails))
+	}
+	if server.FailTimeout != "" {
+		args = append(args, "fail_timeout="+server.FailTimeout)
+	}
+	if server.Backup {
+		args = append(args, "backup")
+	}
+	return strings.Join(args, " ")
+}
+
+// upstreamName is the configured upstream name or one derived from the first
+// server name, e.g. api_example_com_backend.
+func upstreamName(cfg *config.ServerConfig) string {
+	if cfg.Upstream != "" {
+		return cfg.Upstream
+	}
+	if slug := serverSlug(cfg); slug != "" {
+		return slug + "_backend"
+	}
+	return "backend"
+}
+
+// serverSlug turns the first plain server name into an identifier usable in
+// generated upstream and zone names, e.g. api_example_com. It is empty when
+// every name is a regular expression.
+func serverSlug(cfg *config.ServerConfig) string {
+	for _, name := range cfg.Names() {
+		name = strings.Trim(strings.TrimPrefix(name, "*."), ".")
+		if name == "" || strings.HasPrefix(name, "~") {
+			continue
+		}
+		return strings.Map(func(r rune) rune {
+			if r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' {
+				return r
+			}
+			return '_'
+		}, name)
+	}
+	return ""
+}
+
+func renderUpstream(spec *upstreamSpec) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "    upstream %s {\n", spec.name)
+	for _, server := range spec.servers {
+		fmt.Fprintf(&b, "        server %s;\n", spec.serverArgs(server))
+	}
+	if spec.keepalive > 0 {
+		fmt.Fprintf(&b, "        keepalive %d;\n", spec.keepalive)
+	}
+	b.WriteString("    }")
+	return b.String()
+}
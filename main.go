@@ -2,6 +2,8 @@ package main
 
 import (
 	"bufio"
+	"encoding/json"
+	"errors"
 	"flag"
 	"fmt"
 	"io"
@@ -10,89 +12,813 @@ import (
 	"nginx_tool/internal/generator"
 	"os"
 	"os/exec"
+	"path/filepath"
+	"strconv"
 	"strings"
+	"time"
+
+	"gopkg.in/yaml.v2"
 )
 
+var version = "1.0.0"
+
 func main() {
-	if os.Geteuid() != 0 {
-		fmt.Println("Please run this tool as root.")
-		return
+	err := run(os.Args[1:])
+	if errors.Is(err, errCancelled) {
+		fmt.Fprintln(stderr, "Operation cancelled.")
+	} else if err != nil && !errors.Is(err, flag.ErrHelp) {
+		fmt.Fprintf(stderr, "Error: %v\n", err)
+		if errors.Is(err, generator.ErrNoHTTPBlock) && !followIncludes {
+			fmt.Fprintln(stderr, "Hint: if the http block lives in an included file, re-run with -follow-includes; otherwise add an \"http { }\" block to the configuration.")
+		}
+	}
+	os.Exit(exitCode(err))
+}
+
+func run(args []string) error {
+	if len(args) == 0 || strings.HasPrefix(args[0], "-") {
+		return runAdd(args)
+	}
+
+	command, rest := args[0], args[1:]
+	switch command {
+	case "add":
+		return runAdd(rest)
+	case "update":
+		return runUpdate(rest)
+	case "remove":
+		return runRemove(rest)
+	case "list":
+		return runList(rest)
+	case "manage":
+		return runManage(rest)
+	case "validate":
+		return runValidate(rest)
+	case "format":
+		return runFormat(rest)
+	case "rollback":
+		return runRollback(rest)
+	case "check-reload":
+		return runCheckReload(rest)
+	case "backups", "list-backups":
+		return runBackups(rest)
+	case "diff-backups":
+		return runDiffBackups(rest)
+	case "help":
+		showUsage()
+		return nil
+	default:
+		return withExitCode(exitUsage, "unknown command %q (run with -help for usage)", command)
 	}
+}
+
+func runAdd(args []string) error {
+	fs := flag.NewFlagSet("add", flag.ContinueOnError)
 	var (
-		configPath  = flag.String("config", "", "Path to server configuration JSON/YAML file")
-		nginxPath   = flag.String("nginx", "", "Path to existing nginx.conf file (auto-detected if not specified)")
-		serverType  = flag.String("type", "static", "Server type: 'static' or 'proxy'")
-		interactive = flag.Bool("interactive", false, "Manual input mode via terminal")
-		preview     = flag.Bool("preview", true, "Show preview before applying changes")
-		backup      = flag.Bool("backup", true, "Create backup of nginx.conf before modification")
-		autoDetect  = flag.Bool("auto-detect", true, "Auto-detect nginx configuration file")
-		help        = flag.Bool("help", false, "Show help message")
+		configPath   = fs.String("config", "", "Path to server configuration JSON/YAML/.env file")
+		configDir    = fs.String("config-dir", "", "Directory of server configuration JSON/YAML/.env files to apply together")
+		serverType   = fs.String("type", "static", "Server type: 'static', 'proxy', 'grpc' or 'redirect'")
+		interactive  = fs.Bool("interactive", false, "Manual input mode via terminal")
+		preview      = fs.Bool("preview", true, "Show preview before applying changes")
+		backup       = fs.Bool("backup", true, "Create backup of nginx.conf before modification")
+		position     = fs.String("position", "bottom", "Where to insert new server blocks in the http section: 'top' or 'bottom'")
+		backupReuse  = fs.Duration("backup-reuse", 0, "Reuse the latest backup instead of creating one if it is younger than this (e.g. 5m)")
+		checkPort    = fs.Bool("check-port", false, "Warn if the listen port is already bound by a non-nginx process")
+		noBanner     = fs.Bool("no-banner", false, "Omit the 'Generated by' comment from generated server blocks")
+		templatePath = fs.String("template", "", "Go text/template file used to render the server block instead of the built-in one")
+		reapply      = fs.Bool("reapply", false, "Replace the block previously generated for the same server_name instead of appending")
+		replace      = fs.Bool("replace", false, "Replace an existing block with the same server_name, as update does, or add the block if there is none")
+		printTmpl    = fs.String("print-template", "", "Print the built-in template for a server type and exit")
+		jsonOutput   = fs.Bool("json", false, "Print the result as a JSON object on stdout; the preview goes to stderr")
+		certbot      = fs.Bool("certbot", false, "Run 'certbot --nginx' for the server names after writing the block to obtain and install a certificate")
+		check        = fs.Bool("check", false, "Only load, validate and render the configuration; nginx is not needed and nothing is written")
+		indent       = fs.String("indent", "auto", "Indentation of generated blocks: 'auto' (match nginx.conf), 'tab' or a number of spaces")
+		harden       = fs.Bool("harden", false, "Enable the security header preset and make sure the http block sets 'server_tokens off;'")
+		quiet        = fs.Bool("quiet", false, "Skip the summary of where blocks were inserted and the next steps after applying")
+		printConfig  = fs.String("print-config", "", "Print the loaded configuration after defaults and flags are applied as 'json' or 'yaml' and exit")
+		simulate     = fs.String("simulate", "", "Show which location of the generated block would handle this request URL and where it goes, then exit")
+		explain      = fs.Bool("explain", false, "Annotate the generated blocks in the preview with comments explaining each directive")
+		mkroot       = fs.Bool("mkroot", false, "Create a missing root directory with a placeholder index file before writing the config")
+		strict       = fs.Bool("strict", false, "Fail on configuration keys that do not match any known field instead of ignoring them")
+		preHook      = fs.String("pre-hook", "", "Shell command to run before writing; a failure aborts the apply")
+		postHook     = fs.String("post-hook", "", "Shell command to run after the changes were written, e.g. to reload nginx")
+		generateFull = fs.Bool("generate-full", false, "Print a complete standalone nginx.conf holding the server blocks to stdout and exit")
+		configFormat = fs.String("config-format", "", "Format of -config: 'json', 'yaml', 'env' or 'auto' to detect it from the contents (default: by extension)")
+		outputDir    = fs.String("output-dir", "", "Write each server block to <server_name>.conf in this directory and include the directory from nginx.conf")
+		resultFile   = fs.String("result-file", "", "Append a JSON record of the apply (time, servers, backup, outcome) to this file")
+		lint         = fs.Bool("lint", false, "Warn about deprecated directives in nginx.conf, such as 'ssl on;', before the preview")
+		proxyFrom    = fs.String("proxy-from", "", "Fetch the backend address from this discovery URL (e.g. a Consul service) and use it as proxy_pass")
+		help         = fs.Bool("help", false, "Show help message")
 	)
-	flag.Parse()
+	var appendRaw stringList
+	fs.Var(&appendRaw, "append-raw", "Directive(s) to insert verbatim at the end of the server block, or @file to read them from a file; repeatable")
+	nginxPath, autoDetect := addNginxFlags(fs)
+	addConfirmFlags(fs)
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
 
 	if *help {
 		showUsage()
-		return
+		return nil
 	}
 
-	if *nginxPath == "" && *autoDetect {
-		detectedPath, err := detectNginxConfig()
+	if *printTmpl != "" {
+		text, err := generator.BuiltinTemplate(*printTmpl)
 		if err != nil {
-			log.Printf("Warning: Could not auto-detect nginx config: %v", err)
-			log.Fatal("Error: nginx path is required. Use -nginx flag to specify manually.")
+			return withExitCode(exitUsage, "%v", err)
 		}
-		*nginxPath = detectedPath
-		fmt.Printf("🔍 Auto-detected nginx config: %s\n", *nginxPath)
-	} else if *nginxPath == "" {
-		log.Fatal("Error: nginx path is required when auto-detection is disabled")
+		fmt.Print(text)
+		return nil
+	}
+
+	offline := *check || *simulate != "" || *printConfig != "" || *generateFull
+	if !offline {
+		if err := requireRoot(); err != nil {
+			return err
+		}
+	}
+
+	switch *serverType {
+	case "static", "proxy", "grpc", "redirect":
+	default:
+		return withExitCode(exitValidation, "type must be one of 'static', 'proxy', 'grpc' or 'redirect'")
+	}
+
+	if !offline {
+		if err := resolveNginxPath(nginxPath, *autoDetect); err != nil {
+			return err
+		}
+	}
+
+	if *printConfig != "" && *printConfig != "json" && *printConfig != "yaml" {
+		return withExitCode(exitUsage, "-print-config must be 'json' or 'yaml'")
+	}
+
+	if *position != "top" && *position != "bottom" {
+		return withExitCode(exitUsage, "-position must be 'top' or 'bottom'")
+	}
+
+	if *reapply && *noBanner {
+		return withExitCode(exitUsage, "-reapply relies on the generated banner and cannot be combined with -no-banner")
+	}
+
+	if *replace && *reapply {
+		return withExitCode(exitUsage, "-replace and -reapply both replace existing blocks; use -replace to match any block by server_name, or -reapply to match only generated ones")
+	}
+
+	if *replace && *outputDir != "" {
+		return withExitCode(exitUsage, "-replace matches server blocks in nginx.conf and cannot be combined with -output-dir; use -reapply to overwrite existing files")
+	}
+
+	if *generateFull && (*outputDir != "" || *reapply) {
+		return withExitCode(exitUsage, "-generate-full writes a new nginx.conf to stdout and cannot be combined with -output-dir or -reapply")
+	}
+
+	if *outputDir != "" && *position == "top" {
+		return withExitCode(exitUsage, "-position only applies to blocks inserted into nginx.conf and cannot be combined with -output-dir")
+	}
+
+	if *explain && !*preview {
+		return withExitCode(exitUsage, "-explain annotates the preview and cannot be combined with -preview=false")
 	}
 
-	var cfg *config.ServerConfig
-	var err error
+	if *configDir != "" && (*configPath != "" || *interactive) {
+		return withExitCode(exitUsage, "-config-dir cannot be combined with -config or -interactive")
+	}
+
+	cfgs, err := loadConfigs(*configPath, *configDir, *configFormat, *interactive, *strict, *serverType)
+	if err != nil {
+		return err
+	}
+	if err := appendRawDirectives(cfgs, appendRaw); err != nil {
+		return err
+	}
+	if err := applyProxyFrom(cfgs, *proxyFrom, *serverType); err != nil {
+		return err
+	}
+	if !*quiet {
+		warnMissingPaths(cfgs, *mkroot)
+		if !offline {
+			warnUnknownUpstreams(cfgs, *nginxPath)
+			warnMissingBrotli(cfgs, *nginxPath)
+		}
+	}
+	if *lint && !offline {
+		printLint(*nginxPath)
+	}
+
+	gen := generator.New()
+	gen.Banner = !*noBanner
+	gen.Version = version
+	gen.Reapply = *reapply
+	gen.Replace = *replace
+	gen.TemplatePath = *templatePath
+	gen.BackupReuse = *backupReuse
+	gen.OnBackup = reportBackup
+	gen.Top = *position == "top"
+	gen.Harden = *harden
+	gen.HTTP2Listen = usesHTTP2(cfgs, *serverType) && legacyHTTP2()
+	gen.OutputDir = *outputDir
+	if gen.Indent, err = indentUnit(*indent, *nginxPath); err != nil {
+		return err
+	}
+	if *harden {
+		for _, cfg := range cfgs {
+			cfg.SecurityHeaders = true
+		}
+	}
+
+	if *printConfig != "" {
+		return printConfigs(cfgs, *printConfig)
+	}
+	if *simulate != "" {
+		return simulateRequest(gen, cfgs, *serverType, *simulate)
+	}
+	if *check {
+		return checkConfigs(gen, cfgs, *serverType)
+	}
+	if *generateFull {
+		content, err := gen.GenerateFullConfig(cfgs, *serverType, nginxUser(""))
+		if err != nil {
+			return withExitCode(applyExitCode(err), "generating nginx.conf: %w", err)
+		}
+		fmt.Print(content)
+		return nil
+	}
 
-	if *interactive {
-		cfg, err = getInteractiveConfig(*serverType)
+	if *checkPort {
+		for _, cfg := range cfgs {
+			for _, listen := range cfg.ListenValues() {
+				checkPortAvailable(listen)
+			}
+		}
+	}
+
+	if *jsonOutput {
+		stdout = stderr
+	}
+
+	remote := generator.IsRemote(*nginxPath)
+	if *certbot && !remote {
+		if _, err := exec.LookPath("certbot"); err != nil {
+			return withExitCode(exitFailure, "certbot not found in PATH; install it (e.g. apt install certbot python3-certbot-nginx) or run without -certbot")
+		}
+	}
+
+	if *harden {
+		fmt.Fprintln(stderr, sym("🔒")+"-harden: 'server_tokens off;' will be ensured in the http block")
+	}
+
+	if *preview || remote {
+		if err := showPreview(gen, cfgs, *nginxPath, *serverType, *explain); err != nil {
+			if *jsonOutput {
+				writeJSON(newApplyResult(cfgs, *nginxPath, *serverType, nil, err))
+			}
+			return withExitCode(applyExitCode(err), "generating preview: %w", err)
+		}
+		if remote {
+			fmt.Fprintln(stderr, sym("ℹ️")+"Remote nginx configuration is read-only; nothing was written.")
+			return nil
+		}
+
+		shouldProceed, err := confirm("Do you want to proceed with these changes?")
 		if err != nil {
-			log.Fatalf("Error getting interactive config: %v", err)
+			return err
+		}
+		if !shouldProceed {
+			return errCancelled
+		}
+	}
+
+	if err := runHook("pre", *preHook, *nginxPath, "", cfgs); err != nil {
+		return withExitCode(exitApply, "pre-hook failed, nothing was written: %w", err)
+	}
+
+	if *mkroot {
+		workerUser := nginxUser(*nginxPath)
+		for _, cfg := range cfgs {
+			if err := ensureDocumentRoot(cfg, workerUser); err != nil {
+				return withExitCode(exitFailure, "preparing document root: %w", err)
+			}
+		}
+	}
+
+	result, err := gen.AddServersToNginx(cfgs, *nginxPath, *serverType, *backup)
+	appendResult(*resultFile, "add", newApplyResult(cfgs, *nginxPath, *serverType, result, err))
+	if *jsonOutput {
+		if err := writeJSON(newApplyResult(cfgs, *nginxPath, *serverType, result, err)); err != nil {
+			return err
+		}
+	}
+	if err != nil {
+		return withExitCode(applyExitCode(err), "adding server to nginx config: %w", err)
+	}
+
+	for _, line := range result.Hardened {
+		fmt.Fprintf(stderr, "%sSet %s in the http block\n", sym("🔒"), line)
+	}
+	switch {
+	case result.Replaced > 0 && *replace:
+		fmt.Fprintf(stderr, "%sReplaced %d existing server block(s) with the same server_name in place\n", sym("🔄"), result.Replaced)
+	case result.Replaced > 0:
+		fmt.Fprintf(stderr, "%sReplaced %d previously generated server block(s) in place\n", sym("🔄"), result.Replaced)
+	}
+
+	target := *nginxPath
+	if *outputDir != "" {
+		target = *outputDir
+	}
+	if len(cfgs) == 1 {
+		fmt.Fprintf(stderr, "%sServer block added successfully to: %s\n", sym("✅"), target)
+		fmt.Fprintf(stderr, "%sServer type: %s\n", sym("📋"), *serverType)
+		fmt.Fprintf(stderr, "%sServer name: %s\n", sym("🌐"), strings.Join(cfgs[0].Names(), " "))
+	} else {
+		fmt.Fprintf(stderr, "%s%d server blocks added successfully to: %s\n", sym("✅"), len(cfgs), target)
+		fmt.Fprintf(stderr, "%sServer type: %s\n", sym("📋"), *serverType)
+		for _, cfg := range cfgs {
+			fmt.Fprintf(stderr, "%sServer name: %s (%s)\n", sym("🌐"), strings.Join(cfg.Names(), " "), cfg.Source)
+		}
+	}
+
+	if *certbot {
+		for _, cfg := range cfgs {
+			if err := runCertbot(*nginxPath, cfg); err != nil {
+				return err
+			}
+		}
+	}
+
+	if err := runHook("post", *postHook, *nginxPath, result.BackupPath, cfgs); err != nil {
+		return withExitCode(exitFailure, "post-hook failed (the changes were written): %w", err)
+	}
+
+	if !*quiet {
+		printNextSteps(*nginxPath, cfgs, result)
+	}
+	return nil
+}
+
+// printNextSteps tells the user where each block landed and how to test,
+// load and, if needed, undo the change.
+func printNextSteps(nginxPath string, cfgs []*config.ServerConfig, result *generator.Result) {
+	fmt.Fprintln(stderr)
+	for i, cfg := range cfgs {
+		if i < len(result.Lines) && result.Lines[i] > 0 {
+			path := nginxPath
+			if i < len(result.Files) {
+				path = result.Files[i]
+			}
+			fmt.Fprintf(stderr, "%s%s written at %s:%d\n", sym("📍"), strings.Join(cfg.Names(), " "), path, result.Lines[i])
+		}
+	}
+	if result.BackupPath != "" {
+		fmt.Fprintf(stderr, "%sBackup: %s\n", sym("💾"), result.BackupPath)
+	}
+	fmt.Fprintln(stderr, sym("👉")+"Next steps:")
+	fmt.Fprintln(stderr, "   nginx -t && nginx -s reload")
+	if result.BackupPath != "" {
+		fmt.Fprintf(stderr, "   To undo: nginx-server-manager rollback -nginx %s -backup-file %s\n", nginxPath, result.BackupPath)
+	}
+}
+
+type applyResult struct {
+	Status     string          `json:"status"`
+	Error      string          `json:"error,omitempty"`
+	NginxPath  string          `json:"nginx_path"`
+	BackupPath string          `json:"backup_path,omitempty"`
+	Type       string          `json:"type"`
+	Replaced   int             `json:"replaced"`
+	Servers    []appliedServer `json:"servers"`
+}
+
+type appliedServer struct {
+	ServerName string `json:"server_name"`
+	Source     string `json:"source,omitempty"`
+	Line       int    `json:"line,omitempty"`
+}
+
+// ServerInfo describes one server block in the output of list.
+type ServerInfo struct {
+	Line        int      `json:"line" yaml:"line"`
+	Type        string   `json:"type" yaml:"type"`
+	Listen      []string `json:"listen" yaml:"listen"`
+	ServerNames []string `json:"server_names" yaml:"server_names"`
+	Root        string   `json:"root,omitempty" yaml:"root,omitempty"`
+	ProxyPass   string   `json:"proxy_pass,omitempty" yaml:"proxy_pass,omitempty"`
+	Return      string   `json:"return,omitempty" yaml:"return,omitempty"`
+}
+
+func newApplyResult(cfgs []*config.ServerConfig, nginxPath, serverType string, result *generator.Result, err error) applyResult {
+	out := applyResult{Status: "ok", NginxPath: nginxPath, Type: serverType, Servers: []appliedServer{}}
+	if err != nil {
+		out.Status = "error"
+		out.Error = err.Error()
+	}
+	if result != nil {
+		out.BackupPath = result.BackupPath
+		out.Replaced = result.Replaced
+	}
+	for i, cfg := range cfgs {
+		server := appliedServer{ServerName: strings.Join(cfg.Names(), " "), Source: cfg.Source}
+		if result != nil && i < len(result.Lines) {
+			server.Line = result.Lines[i]
 		}
+		out.Servers = append(out.Servers, server)
+	}
+	return out
+}
+
+// resultRecord is one line of a -result-file: the apply result with the
+// time and the command that produced it.
+type resultRecord struct {
+	Time    string `json:"time"`
+	Command string `json:"command"`
+	applyResult
+}
+
+// appendResult adds a record of out to the JSON Lines file at path, creating
+// it if needed. A record that cannot be written only warns, so the exit code
+// still reflects the change itself.
+func appendResult(path, command string, out applyResult) {
+	if path == "" {
+		return
+	}
+	line, err := json.Marshal(resultRecord{Time: time.Now().UTC().Format(time.RFC3339), Command: command, applyResult: out})
+	if err == nil {
+		var f *os.File
+		if f, err = os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644); err == nil {
+			_, err = f.Write(append(line, '\n'))
+			if closeErr := f.Close(); err == nil {
+				err = closeErr
+			}
+		}
+	}
+	if err != nil {
+		fmt.Fprintf(stderr, "%sCould not record the result in %s: %v\n", sym("⚠️"), path, err)
+	}
+}
+
+func writeJSON(v any) error {
+	enc := json.NewEncoder(stdout)
+	enc.SetIndent("", "  ")
+	return enc.Encode(v)
+}
+
+// indentUnit turns an -indent value into one level of indentation. "auto"
+// follows the existing nginx.conf and falls back to four spaces.
+func indentUnit(value, nginxPath string) (string, error) {
+	switch value {
+	case "auto":
+		if nginxPath == "" {
+			return "", nil
+		}
+		return generator.DetectFileIndent(nginxPath), nil
+	case "tab":
+		return "\t", nil
+	}
+	n, err := strconv.Atoi(value)
+	if err != nil || n < 1 || n > 8 {
+		return "", withExitCode(exitUsage, "-indent must be 'auto', 'tab' or a number of spaces from 1 to 8")
+	}
+	return strings.Repeat(" ", n), nil
+}
+
+// reportBackup is the generator's OnBackup hook. It runs before nginx.conf
+// is written, so the backup is announced even when the write fails.
+func reportBackup(path string, reused bool) {
+	if reused {
+		fmt.Fprintf(stderr, "%sReusing recent backup: %s\n", sym("📋"), path)
 	} else {
-		if *configPath == "" {
-			log.Fatal("Error: config path is required when not using interactive mode")
+		fmt.Fprintf(stderr, "%sBackup created: %s\n", sym("📋"), path)
+	}
+}
+
+func loadConfigs(configPath, configDir, format string, interactive, strict bool, serverType string) ([]*config.ServerConfig, error) {
+	if !config.IsConfigFormat(format) {
+		return nil, withExitCode(exitUsage, "-config-format must be 'json', 'yaml', 'env' or 'auto'")
+	}
+	if format != "" && configDir != "" {
+		return nil, withExitCode(exitUsage, "-config-format applies to -config; files in -config-dir are read by extension")
+	}
+
+	var cfgs []*config.ServerConfig
+
+	switch {
+	case interactive:
+		cfg, err := getInteractiveConfig(serverType)
+		if err != nil {
+			return nil, withExitCode(exitConfig, "getting interactive config: %w", err)
 		}
-		cfg, err = config.Load(*configPath)
+		cfgs = append(cfgs, cfg)
+	case configDir != "":
+		loaded, err := config.LoadDir(configDir, strict)
 		if err != nil {
-			log.Fatalf("Error loading configuration: %v", err)
+			return nil, withExitCode(exitConfig, "loading configuration directory: %w", err)
 		}
+		cfgs = loaded
+	default:
+		if configPath == "" {
+			return nil, withExitCode(exitUsage, "config path is required when not using interactive mode")
+		}
+		cfg, err := config.Load(configPath, strict, format)
+		if err != nil {
+			return nil, withExitCode(exitConfig, "loading configuration: %w", err)
+		}
+		cfgs = append(cfgs, cfg)
 	}
 
-	if *serverType != "static" && *serverType != "proxy" {
-		log.Fatal("Error: type must be either 'static' or 'proxy'")
+	for _, cfg := range cfgs {
+		if err := checkConfig(cfg, serverType); err != nil {
+			return nil, err
+		}
 	}
 
-	gen := generator.New()
+	return cfgs, nil
+}
+
+// checkConfig prints the warnings for cfg and validates it for serverType.
+func checkConfig(cfg *config.ServerConfig, serverType string) error {
+	for _, warning := range cfg.Warnings {
+		fmt.Fprintf(stderr, "%s%s: %s\n", sym("⚠️"), filepath.Base(cfg.Source), warning)
+	}
+	if err := cfg.ValidateFor(serverType); err != nil {
+		return withExitCode(exitValidation, "invalid configuration for %s: %w", strings.Join(cfg.Names(), " "), err)
+	}
+	_, warnings := generator.OrderLocations(cfg.Locations)
+	for _, warning := range warnings {
+		fmt.Fprintf(stderr, "%s%s: %s\n", sym("⚠️"), strings.Join(cfg.Names(), " "), warning)
+	}
+	return nil
+}
 
-	if *preview {
-		shouldProceed, err := showPreview(gen, cfg, *nginxPath, *serverType)
+// printConfigs writes the effective configurations to stdout: a single
+// object for one configuration, a list for several.
+func printConfigs(cfgs []*config.ServerConfig, format string) error {
+	var value any = cfgs
+	if len(cfgs) == 1 {
+		value = cfgs[0]
+	}
+
+	if format == "json" {
+		return writeJSON(value)
+	}
+	data, err := yaml.Marshal(value)
+	if err != nil {
+		return withExitCode(exitFailure, "encoding configuration: %w", err)
+	}
+	fmt.Print(string(data))
+	return nil
+}
+
+// warnMissingPaths prints the paths each configuration refers to that do
+// not exist. A missing root is left out when -mkroot will create it.
+func warnMissingPaths(cfgs []*config.ServerConfig, mkroot bool) {
+	for _, cfg := range cfgs {
+		check := *cfg
+		if mkroot {
+			check.Root = ""
+		}
+		for _, warning := range check.MissingPaths() {
+			fmt.Fprintf(stderr, "%s%s: %s\n", sym("⚠️"), strings.Join(cfg.Names(), " "), warning)
+		}
+	}
+}
+
+// warnUnknownUpstreams checks every proxy_pass that names an upstream, such
+// as http://my-upstream, against the upstream blocks of nginx.conf and the
+// ones the configurations define themselves. Nothing is reported when
+// nginx.conf cannot be parsed.
+func warnUnknownUpstreams(cfgs []*config.ServerConfig, nginxPath string) {
+	names, err := generator.New().ListUpstreams(nginxPath)
+	if err != nil {
+		debugf("upstream check skipped: %v", err)
+		return
+	}
+	defined := make(map[string]bool)
+	for _, name := range names {
+		defined[name] = true
+	}
+	for _, cfg := range cfgs {
+		defined[cfg.Upstream] = cfg.Upstream != ""
+		for _, group := range cfg.UpstreamGroups {
+			defined[group.Name] = true
+		}
+	}
+
+	for _, cfg := range cfgs {
+		upstream := cfg.ProxyUpstream()
+		switch {
+		case upstream == "":
+		case defined[upstream] && cfg.Keepalive > 0:
+			fmt.Fprintf(stderr, "%s%s: keepalive wraps the existing upstream %s in a new upstream block; set keepalive in %s instead\n", sym("⚠️"), strings.Join(cfg.Names(), " "), upstream, upstream)
+		case !defined[upstream] && !strings.Contains(upstream, "."):
+			fmt.Fprintf(stderr, "%s%s: proxy_pass names %s, but %s has no upstream %s block; nginx will look it up as a host name\n", sym("⚠️"), strings.Join(cfg.Names(), " "), upstream, nginxPath, upstream)
+		}
+	}
+}
+
+// printLint prints the deprecated directives of nginx.conf to stderr and
+// returns how many were found. A config that cannot be read or parsed is
+// left to the commands' own error handling.
+func printLint(nginxPath string) int {
+	warnings, err := generator.New().LintNginxConfig(nginxPath)
+	if err != nil {
+		debugf("lint skipped: %v", err)
+		return 0
+	}
+	for _, warning := range warnings {
+		fmt.Fprintf(stderr, "%s%s:%d: %s\n", sym("⚠️"), nginxPath, warning.Line, warning.Message)
+	}
+	return len(warnings)
+}
+
+// checkConfigs renders every configuration into an empty http block, which
+// catches template errors, malformed output and conflicts between the
+// configurations themselves without reading nginx.conf.
+func checkConfigs(gen *generator.Generator, cfgs []*config.ServerConfig, serverType string) error {
+	serverBlocks := make([]string, 0, len(cfgs))
+	for _, cfg := range cfgs {
+		serverBlock, err := gen.GenerateServerBlock(cfg, serverType)
 		if err != nil {
-			log.Fatalf("Error generating preview: %v", err)
+			return withExitCode(exitValidation, "rendering %s: %w", strings.Join(cfg.Names(), " "), err)
 		}
-		if !shouldProceed {
-			fmt.Println("Operation cancelled.")
-			return
+		serverBlocks = append(serverBlocks, serverBlock)
+	}
+
+	if _, err := generator.InsertServerBlock("http {\n}\n", strings.Join(serverBlocks, "\n\n")); err != nil {
+		return withExitCode(exitValidation, "checking generated server blocks: %w", err)
+	}
+
+	fmt.Fprintf(stderr, "%s%d configuration(s) valid\n", sym("✅"), len(cfgs))
+	return nil
+}
+
+func addNginxFlags(fs *flag.FlagSet) (*string, *bool) {
+	fs.BoolVar(&verbose, "verbose", false, "Log each detection and parsing step to stderr")
+	nginxPath := fs.String("nginx", "", "Path or http(s) URL of nginx.conf (auto-detected if not specified; URLs are preview-only)")
+	autoDetect := fs.Bool("auto-detect", true, "Auto-detect nginx configuration file")
+	fs.BoolVar(&noColor, "no-color", false, "Print status messages without emoji, even on a terminal")
+	fs.BoolVar(&followIncludes, "follow-includes", false, "Follow include directives to find the file that holds the http block")
+	return nginxPath, autoDetect
+}
+
+// stringList is a flag that may be given several times.
+type stringList []string
+
+func (l *stringList) String() string {
+	return strings.Join(*l, ", ")
+}
+
+func (l *stringList) Set(value string) error {
+	*l = append(*l, value)
+	return nil
+}
+
+// appendRawDirectives adds the -append-raw snippets to every configuration.
+// A value starting with "@" names a file holding the snippet.
+func appendRawDirectives(cfgs []*config.ServerConfig, values []string) error {
+	for _, value := range values {
+		if path, ok := strings.CutPrefix(value, "@"); ok {
+			data, err := os.ReadFile(path)
+			if err != nil {
+				return withExitCode(exitConfig, "reading -append-raw file: %w", err)
+			}
+			value = string(data)
+		}
+		if err := config.ValidateRawDirective(value); err != nil {
+			return withExitCode(exitValidation, "-append-raw: %w", err)
+		}
+		for _, cfg := range cfgs {
+			cfg.RawDirectives = append(cfg.RawDirectives, value)
 		}
 	}
+	return nil
+}
+
+func parseFlags(fs *flag.FlagSet, args []string) error {
+	if err := applyDefaults(fs); err != nil {
+		return err
+	}
+	if err := fs.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return &exitError{code: exitOK, err: err}
+		}
+		return withExitCode(exitUsage, "%w", err)
+	}
+	if fs.NArg() > 0 {
+		return withExitCode(exitUsage, "unexpected arguments: %s", strings.Join(fs.Args(), " "))
+	}
+	return nil
+}
+
+// parseFlagsAndArgs is parseFlags for commands that take arguments besides
+// flags, and returns them. Flags may come before, between or after them.
+func parseFlagsAndArgs(fs *flag.FlagSet, args []string) ([]string, error) {
+	if err := applyDefaults(fs); err != nil {
+		return nil, err
+	}
+	var positional []string
+	for {
+		if err := fs.Parse(args); err != nil {
+			if errors.Is(err, flag.ErrHelp) {
+				return nil, &exitError{code: exitOK, err: err}
+			}
+			return nil, withExitCode(exitUsage, "%w", err)
+		}
+		if fs.NArg() == 0 {
+			return positional, nil
+		}
+		positional = append(positional, fs.Arg(0))
+		args = fs.Args()[1:]
+	}
+}
+
+var (
+	verbose        bool
+	followIncludes bool
+)
+
+func debugf(format string, args ...any) {
+	if verbose {
+		log.Printf("[debug] "+format, args...)
+	}
+}
 
-	if err := gen.AddServerToNginx(cfg, *nginxPath, *serverType, *backup); err != nil {
-		log.Fatalf("Error adding server to nginx config: %v", err)
+func requireRoot() error {
+	if os.Geteuid() != 0 {
+		return withExitCode(exitPermission, "please run this tool as root")
 	}
+	return nil
+}
+
+func resolveNginxPath(nginxPath *string, autoDetect bool) error {
+	if *nginxPath == "" {
+		if !autoDetect {
+			return withExitCode(exitUsage, "nginx path is required when auto-detection is disabled")
+		}
 
-	fmt.Printf("✅ Server block added successfully to: %s\n", *nginxPath)
-	fmt.Printf("📋 Server type: %s\n", *serverType)
-	fmt.Printf("🌐 Server name: %s\n", cfg.ServerName)
+		detectedPath, err := detectNginxConfig()
+		if err != nil {
+			log.Printf("Warning: Could not auto-detect nginx config: %v", err)
+			return withExitCode(exitNginxNotFound, "nginx path is required. Use -nginx flag to specify manually")
+		}
+		*nginxPath = detectedPath
+		fmt.Fprintf(stderr, "%sAuto-detected nginx config: %s\n", sym("🔍"), *nginxPath)
+	}
+
+	if followIncludes {
+		httpPath, err := generator.FindHTTPConfig(*nginxPath)
+		if err != nil {
+			return withExitCode(exitConfig, "following includes: %w", err)
+		}
+		if httpPath != *nginxPath {
+			fmt.Fprintf(stderr, "%shttp block found in included file: %s\n", sym("📎"), httpPath)
+			*nginxPath = httpPath
+		}
+	}
+	return nil
+}
+
+var (
+	assumeYes  bool
+	defaultYes bool
+)
+
+// stdin is shared by every prompt, so answers typed or piped ahead are not
+// lost in the buffer of an earlier reader.
+var stdin = bufio.NewReader(os.Stdin)
+
+func addConfirmFlags(fs *flag.FlagSet) {
+	fs.BoolVar(&assumeYes, "yes", false, "Answer yes to the confirmation prompt; the preview is still shown")
+	fs.BoolVar(&defaultYes, "default-yes", false, "Treat an empty answer to the confirmation prompt as yes")
+}
+
+func confirm(prompt string) (bool, error) {
+	if assumeYes {
+		fmt.Fprintf(stderr, "%s yes (-yes)\n", prompt)
+		return true, nil
+	}
+
+	choices := "y/N"
+	if defaultYes {
+		choices = "Y/n"
+	}
+	fmt.Fprintf(stderr, "%s (%s): ", prompt, choices)
+	response, err := stdin.ReadString('\n')
+	if err != nil {
+		return false, err
+	}
+
+	response = strings.ToLower(strings.TrimSpace(response))
+	if response == "" {
+		return defaultYes, nil
+	}
+	return response == "y" || response == "yes", nil
 }
 
 func detectNginxConfig() (string, error) {
-	fmt.Println("🔍 Auto-detecting nginx configuration...")
+	fmt.Fprintln(stderr, sym("🔍")+"Auto-detecting nginx configuration...")
 
 	commonPaths := []string{
 		"/etc/nginx/nginx.conf",
@@ -102,23 +828,35 @@ func detectNginxConfig() (string, error) {
 		"/etc/nginx.conf",
 	}
 
+	debugf("step 1: checking common config paths")
 	for _, path := range commonPaths {
-		if _, err := os.Stat(path); err == nil {
-			if isValidNginxConfig(path) {
-				return path, nil
-			}
+		if _, err := os.Stat(path); err != nil {
+			debugf("  %s: %v", path, err)
+			continue
+		}
+		if isValidNginxConfig(path) {
+			debugf("  %s: found and looks like an nginx config", path)
+			return path, nil
 		}
+		debugf("  %s: exists but does not look like an nginx config", path)
 	}
 
-	if nginxBinary, err := findNginxBinary(); err == nil {
-		if configPath, err := getNginxConfigFromBinary(nginxBinary); err == nil {
-			return configPath, nil
-		}
+	debugf("step 2: asking the nginx binary for its config path")
+	nginxBinary, err := findNginxBinary()
+	if err != nil {
+		debugf("  %v", err)
+	} else if configPath, err := getNginxConfigFromBinary(nginxBinary); err != nil {
+		debugf("  %v", err)
+	} else {
+		return configPath, nil
 	}
 
-	if configPath, err := getNginxConfigFromProcess(); err == nil {
+	debugf("step 3: inspecting the running nginx master process")
+	configPath, err := getNginxConfigFromProcess()
+	if err == nil {
 		return configPath, nil
 	}
+	debugf("  %v", err)
 
 	return "", fmt.Errorf("no nginx configuration file found")
 }
@@ -136,11 +874,13 @@ func findNginxBinary() (string, error) {
 
 	for _, path := range commonBinPaths {
 		if _, err := os.Stat(path); err == nil {
+			debugf("  nginx binary: %s", path)
 			return path, nil
 		}
 	}
 
 	if path, err := exec.LookPath("nginx"); err == nil {
+		debugf("  nginx binary (from PATH): %s", path)
 		return path, nil
 	}
 
@@ -148,11 +888,11 @@ func findNginxBinary() (string, error) {
 }
 
 func getNginxConfigFromBinary(nginxBinary string) (string, error) {
-	cmd := exec.Command(nginxBinary, "-t")
-	output, err := cmd.CombinedOutput()
+	output, err := runTimed((*exec.Cmd).CombinedOutput, nginxBinary, "-t")
+	debugf("  %s -t returned %v:\n%s", nginxBinary, err, strings.TrimSpace(string(output)))
 	if err != nil {
-		cmd = exec.Command(nginxBinary, "-T")
-		output, err = cmd.CombinedOutput()
+		output, err = runTimed((*exec.Cmd).CombinedOutput, nginxBinary, "-T")
+		debugf("  %s -T returned %v", nginxBinary, err)
 		if err != nil {
 			return "", fmt.Errorf("failed to get config from nginx binary: %v", err)
 		}
@@ -163,12 +903,14 @@ func getNginxConfigFromBinary(nginxBinary string) (string, error) {
 
 	for _, line := range lines {
 		if strings.Contains(line, "configuration file") && strings.Contains(line, "nginx.conf") {
+			debugf("  matched line: %s", line)
 			parts := strings.Fields(line)
 			for _, part := range parts {
 				if strings.HasSuffix(part, "nginx.conf") {
 					if _, err := os.Stat(part); err == nil {
 						return part, nil
 					}
+					debugf("  %s: %v", part, err)
 				}
 			}
 		}
@@ -178,8 +920,7 @@ func getNginxConfigFromBinary(nginxBinary string) (string, error) {
 }
 
 func getNginxConfigFromProcess() (string, error) {
-	cmd := exec.Command("ps", "aux")
-	output, err := cmd.Output()
+	output, err := runTimed((*exec.Cmd).Output, "ps", "aux")
 	if err != nil {
 		return "", fmt.Errorf("failed to run ps command: %v", err)
 	}
@@ -187,6 +928,7 @@ func getNginxConfigFromProcess() (string, error) {
 	lines := strings.Split(string(output), "\n")
 	for _, line := range lines {
 		if strings.Contains(line, "nginx: master process") {
+			debugf("  matched process: %s", line)
 			fields := strings.Fields(line)
 			for i, field := range fields {
 				if field == "-c" && i+1 < len(fields) {
@@ -229,24 +971,32 @@ func isValidNginxConfig(path string) bool {
 		}
 	}
 
+	debugf("  %s: %d of %d nginx keywords present", path, keywordCount, len(nginxKeywords))
 	return keywordCount >= 2
 }
 
 func getInteractiveConfig(serverType string) (*config.ServerConfig, error) {
-	reader := bufio.NewReader(os.Stdin)
+	reader := stdin
 	cfg := &config.ServerConfig{}
 
-	fmt.Println("🔧 Interactive Configuration Mode")
-	fmt.Println("=" + strings.Repeat("=", 40))
+	fmt.Fprintln(stderr, sym("🔧")+"Interactive Configuration Mode")
+	fmt.Fprintln(stderr, "="+strings.Repeat("=", 40))
 
-	fmt.Print("Enter server name (e.g., example.com): ")
+	fmt.Fprint(stderr, "Enter server name(s), space-separated (e.g., example.com www.example.com): ")
 	serverName, err := reader.ReadString('\n')
 	if err != nil {
 		return nil, err
 	}
 	cfg.ServerName = strings.TrimSpace(serverName)
 
-	fmt.Print("Enter listen port [80]: ")
+	fmt.Fprint(stderr, "Enter bind address (optional, e.g., 192.168.1.10 or ::1) [all]: ")
+	bindAddress, err := reader.ReadString('\n')
+	if err != nil {
+		return nil, err
+	}
+	bindAddress = strings.TrimSpace(bindAddress)
+
+	fmt.Fprint(stderr, "Enter listen port [80]: ")
 	listen, err := reader.ReadString('\n')
 	if err != nil {
 		return nil, err
@@ -255,18 +1005,24 @@ func getInteractiveConfig(serverType string) (*config.ServerConfig, error) {
 	if listen == "" {
 		listen = "80"
 	}
+	if bindAddress != "" {
+		if strings.Contains(bindAddress, ":") && !strings.HasPrefix(bindAddress, "[") {
+			bindAddress = "[" + bindAddress + "]"
+		}
+		listen = bindAddress + ":" + listen
+	}
 	cfg.Listen = listen
 
 	switch serverType {
 	case "static":
-		fmt.Print("Enter document root (e.g., /var/www/html): ")
+		fmt.Fprint(stderr, "Enter document root (e.g., /var/www/html): ")
 		root, err := reader.ReadString('\n')
 		if err != nil {
 			return nil, err
 		}
 		cfg.Root = strings.TrimSpace(root)
 
-		fmt.Print("Enter index file [index.html]: ")
+		fmt.Fprint(stderr, "Enter index file [index.html]: ")
 		index, err := reader.ReadString('\n')
 		if err != nil {
 			return nil, err
@@ -278,79 +1034,183 @@ func getInteractiveConfig(serverType string) (*config.ServerConfig, error) {
 		cfg.Index = index
 
 	case "proxy":
-		fmt.Print("Enter proxy target (e.g., 8084 or http://127.0.0.1:8084): ")
+		fmt.Fprint(stderr, "Enter proxy target (e.g., 8084, http://127.0.0.1:8084 or /run/app.sock): ")
 		proxy, err := reader.ReadString('\n')
 		if err != nil {
 			return nil, err
 		}
 		proxy = strings.TrimSpace(proxy)
 
-		if strings.HasPrefix(proxy, "http://") || strings.HasPrefix(proxy, "https://") {
+		switch {
+		case strings.HasPrefix(proxy, "http://") || strings.HasPrefix(proxy, "https://"):
 			cfg.ProxyPass = proxy
-		} else {
+		case strings.HasPrefix(proxy, "/"):
+			cfg.ProxySocket = proxy
+		default:
 			cfg.ProxyPort = proxy
 		}
+
+	case "grpc":
+		fmt.Fprint(stderr, "Enter gRPC backend (e.g., 50051, grpc://127.0.0.1:50051 or grpcs://api.internal:443): ")
+		backend, err := reader.ReadString('\n')
+		if err != nil {
+			return nil, err
+		}
+		backend = strings.TrimSpace(backend)
+
+		if strings.Contains(backend, "://") {
+			cfg.GRPCPass = backend
+		} else {
+			cfg.ProxyPort = backend
+		}
+
+	case "redirect":
+		fmt.Fprint(stderr, "Enter redirect target (e.g., https://example.com): ")
+		target, err := reader.ReadString('\n')
+		if err != nil {
+			return nil, err
+		}
+		cfg.RedirectTo = strings.TrimSpace(target)
+
+		fmt.Fprint(stderr, "Enter redirect status code (301 or 302) [301]: ")
+		code, err := reader.ReadString('\n')
+		if err != nil {
+			return nil, err
+		}
+		code = strings.TrimSpace(code)
+		if code == "" {
+			code = "301"
+		}
+		cfg.RedirectCode, err = strconv.Atoi(code)
+		if err != nil {
+			return nil, fmt.Errorf("invalid redirect status code: %s", code)
+		}
 	}
 
-	fmt.Println()
+	fmt.Fprintln(stderr)
 	return cfg, nil
 }
 
-func showPreview(gen *generator.Generator, cfg *config.ServerConfig, nginxPath, serverType string) (bool, error) {
-	reader := bufio.NewReader(os.Stdin)
+func showPreview(gen *generator.Generator, cfgs []*config.ServerConfig, nginxPath, serverType string, explain bool) error {
+	fmt.Fprintln(stdout, sym("📋")+"Configuration Preview")
+	fmt.Fprintln(stdout, "="+strings.Repeat("=", 50))
 
-	fmt.Println("📋 Configuration Preview")
-	fmt.Println("=" + strings.Repeat("=", 50))
+	serverBlocks := make([]string, 0, len(cfgs))
+	for _, cfg := range cfgs {
+		if cfg.Source != "" && len(cfgs) > 1 {
+			fmt.Fprintf(stdout, "Source: %s\n", cfg.Source)
+		}
+		fmt.Fprintf(stdout, "Server Name: %s\n", strings.Join(cfg.Names(), " "))
+		fmt.Fprintf(stdout, "Listen Port: %s\n", strings.Join(cfg.ListenValues(), ", "))
+		fmt.Fprintf(stdout, "Server Type: %s\n", serverType)
 
-	fmt.Printf("Server Name: %s\n", cfg.ServerName)
-	fmt.Printf("Listen Port: %s\n", cfg.Listen)
-	fmt.Printf("Server Type: %s\n", serverType)
+		switch serverType {
+		case "static":
+			fmt.Fprintf(stdout, "Document Root: %s\n", cfg.Root)
+			fmt.Fprintf(stdout, "Index File: %s\n", strings.Join(cfg.IndexList(), " "))
+		case "redirect":
+			fmt.Fprintf(stdout, "Redirect Target: %s\n", cfg.RedirectTo)
+		case "grpc":
+			if cfg.GRPCPass != "" {
+				fmt.Fprintf(stdout, "gRPC Backend: %s\n", cfg.GRPCPass)
+			} else {
+				fmt.Fprintf(stdout, "gRPC Port: %s\n", cfg.ProxyPort)
+			}
+		default:
+			switch {
+			case len(cfg.Upstreams) > 0:
+				addresses := make([]string, 0, len(cfg.Upstreams))
+				for _, server := range cfg.Upstreams {
+					addresses = append(addresses, server.Address)
+				}
+				fmt.Fprintf(stdout, "Upstream Servers: %s\n", strings.Join(addresses, ", "))
+			case cfg.ProxyPass != "":
+				fmt.Fprintf(stdout, "Proxy Target: %s\n", cfg.ProxyPass)
+			case cfg.ProxySocket != "":
+				fmt.Fprintf(stdout, "Proxy Socket: %s\n", cfg.ProxySocket)
+			default:
+				fmt.Fprintf(stdout, "Proxy Port: %s\n", cfg.ProxyPort)
+			}
+		}
 
-	if serverType == "static" {
-		fmt.Printf("Document Root: %s\n", cfg.Root)
-		fmt.Printf("Index File: %s\n", cfg.Index)
-	} else {
-		if cfg.ProxyPass != "" {
-			fmt.Printf("Proxy Target: %s\n", cfg.ProxyPass)
-		} else {
-			fmt.Printf("Proxy Port: %s\n", cfg.ProxyPort)
+		fmt.Fprintln(stdout)
+
+		serverBlock, err := gen.GenerateServerBlock(cfg, serverType)
+		if err != nil {
+			return err
 		}
+		if explain {
+			serverBlock = generator.Explain(serverBlock)
+		}
+		serverBlocks = append(serverBlocks, serverBlock)
 	}
 
-	fmt.Println()
-
-	var serverBlock string
-	switch serverType {
-	case "static":
-		serverBlock = gen.GenerateStaticServerBlock(cfg)
-	case "proxy":
-		serverBlock = gen.GenerateProxyServerBlock(cfg)
+	if gen.OutputDir != "" {
+		return showFilesPreview(gen, cfgs, nginxPath, serverType, explain)
 	}
 
-	preview, err := gen.GeneratePreview(nginxPath, serverBlock)
+	preview, err := gen.GeneratePreview(nginxPath, strings.Join(serverBlocks, "\n\n"))
 	if err != nil {
-		return false, fmt.Errorf("failed to generate preview: %w", err)
+		return fmt.Errorf("failed to generate preview: %w", err)
 	}
 
-	fmt.Println("🔍 Nginx Configuration Preview")
-	fmt.Println("=" + strings.Repeat("=", 50))
-	fmt.Println(preview)
-	fmt.Println("=" + strings.Repeat("=", 50))
+	fmt.Fprintln(stdout, sym("🔍")+"Nginx Configuration Preview")
+	fmt.Fprintln(stdout, "="+strings.Repeat("=", 50))
+	fmt.Fprintln(stdout, preview)
+	fmt.Fprintln(stdout, "="+strings.Repeat("=", 50))
 
-	fmt.Print("Do you want to proceed with these changes? (y/N): ")
-	response, err := reader.ReadString('\n')
+	return nil
+}
+
+// showFilesPreview prints the files -output-dir writes and the include
+// added to nginx.conf for them.
+func showFilesPreview(gen *generator.Generator, cfgs []*config.ServerConfig, nginxPath, serverType string, explain bool) error {
+	plan, err := gen.PlanServerFiles(cfgs, nginxPath, serverType, gen.OutputDir)
 	if err != nil {
-		return false, err
+		return fmt.Errorf("failed to generate preview: %w", err)
 	}
 
-	response = strings.ToLower(strings.TrimSpace(response))
-	return response == "y" || response == "yes", nil
+	fmt.Fprintln(stdout, sym("🔍")+"Server Files Preview")
+	fmt.Fprintln(stdout, "="+strings.Repeat("=", 50))
+	for _, file := range plan.Files {
+		content := file.Content
+		if explain {
+			content = generator.Explain(content)
+		}
+		if file.Exists {
+			fmt.Fprintf(stdout, "%s%s (overwritten)\n", sym("📄"), file.Path)
+		} else {
+			fmt.Fprintf(stdout, "%s%s\n", sym("📄"), file.Path)
+		}
+		fmt.Fprintln(stdout, strings.TrimRight(content, "\n"))
+		fmt.Fprintln(stdout)
+	}
+	if plan.Include != "" {
+		fmt.Fprintf(stdout, "%s%s will be added to the http block of %s\n", sym("➕"), plan.Include, nginxPath)
+	} else {
+		fmt.Fprintf(stdout, "%s%s already includes these files\n", sym("✔️"), nginxPath)
+	}
+	fmt.Fprintln(stdout, "="+strings.Repeat("=", 50))
+	return nil
 }
 
 func showUsage() {
 	fmt.Println("Nginx Server Manager")
 	fmt.Println("Add new server blocks to existing nginx configuration")
 	fmt.Println()
+	fmt.Println("Commands:")
+	fmt.Println("  add           Add server block(s) to nginx.conf (default when no command is given)")
+	fmt.Println("  update        Regenerate the server block matching the config's server_name in place")
+	fmt.Println("  remove        Remove the server block(s) matching -server-name")
+	fmt.Println("  list          List the server blocks in the http section as a table, JSON or YAML")
+	fmt.Println("  manage        Pick a server block from a numbered menu to edit, remove or comment out")
+	fmt.Println("  validate      Check nginx.conf structure and run 'nginx -t' when nginx is installed")
+	fmt.Println("  check-reload  Run 'nginx -t' on nginx.conf as a reload would, and reload with -reload")
+	fmt.Println("  format        Pretty-print nginx.conf, or rewrite it in place with -write")
+	fmt.Println("  rollback      Restore nginx.conf from the latest backup or -backup-file")
+	fmt.Println("  backups       List the backups of nginx.conf with their dates, sizes and checksums")
+	fmt.Println("  diff-backups  Show a unified diff between two backups, or a backup and nginx.conf")
+	fmt.Println()
 	fmt.Println("Usage:")
 	fmt.Println("  # Auto-detect nginx config (Linux)")
 	fmt.Println("  nginx-server-manager -interactive -type <server_type>")
@@ -361,18 +1221,112 @@ func showUsage() {
 	fmt.Println("  # Interactive configuration")
 	fmt.Println("  nginx-server-manager -interactive -nginx <nginx_conf> -type <server_type>")
 	fmt.Println()
-	fmt.Println("Options:")
-	fmt.Println("  -config        Path to server configuration file (.json/.yaml)")
+	fmt.Println("  # Other commands")
+	fmt.Println("  nginx-server-manager list [-format table|json|yaml] [-nginx <nginx_conf>]")
+	fmt.Println("  nginx-server-manager update -config <config_file> -type <server_type> [-nginx <nginx_conf>]")
+	fmt.Println("  nginx-server-manager update -config <partial_config> -patch [-nginx <nginx_conf>]")
+	fmt.Println("  nginx-server-manager remove -server-name <name> [-nginx <nginx_conf>]")
+	fmt.Println("  nginx-server-manager manage [-nginx <nginx_conf>]")
+	fmt.Println("  nginx-server-manager validate [-nginx <nginx_conf>]")
+	fmt.Println("  nginx-server-manager check-reload [-reload] [-nginx <nginx_conf>]")
+	fmt.Println("  nginx-server-manager format [-write] [-nginx <nginx_conf>]")
+	fmt.Println("  nginx-server-manager rollback [-backup-file <backup>] [-nginx <nginx_conf>]")
+	fmt.Println("  nginx-server-manager backups [-since <duration>] [-json] [-nginx <nginx_conf>]")
+	fmt.Println("  nginx-server-manager diff-backups [<a>] [<b>] [-nginx <nginx_conf>]")
+	fmt.Println()
+	fmt.Println("Add Options:")
+	fmt.Println("  -config        Path to server configuration file (.json/.yaml/.env)")
+	fmt.Println("                 or a file in Git: git+https://host/repo.git[?ref=<ref>]#<path>")
+	fmt.Println("  -config-dir    Directory of configuration files to apply in one run (sorted by filename)")
 	fmt.Println("  -nginx         Path to existing nginx.conf file (auto-detected if not specified)")
+	fmt.Println("                 An http(s) URL is fetched read-only: add only previews, list and validate work as usual")
 	fmt.Println("  -type          Server type:")
-	fmt.Println("                   static - Static file server")
-	fmt.Println("                   proxy  - Reverse proxy server")
+	fmt.Println("                   static   - Static file server")
+	fmt.Println("                   proxy    - Reverse proxy server")
+	fmt.Println("                   grpc     - gRPC proxy (grpc_pass over HTTP/2)")
+	fmt.Println("                   redirect - Redirect every request to another host")
 	fmt.Println("  -interactive   Manual input mode via terminal")
 	fmt.Println("  -auto-detect   Auto-detect nginx configuration file (default: true)")
 	fmt.Println("  -preview       Show preview before applying changes (default: true)")
 	fmt.Println("  -backup        Create backup before modifying (default: true)")
+	fmt.Println("  -backup-reuse  Reuse the latest backup if it is younger than this duration (e.g. 5m)")
+	fmt.Println("  -result-file   Append a JSON line recording each apply (time, servers, backup, outcome) to a file")
+	fmt.Println("  -proxy-from    Fetch the backend address from a discovery URL (text, JSON or a Consul service) as proxy_pass")
+	fmt.Println("  -lint          Warn about deprecated directives in nginx.conf, such as 'ssl on;' or 'listen ... http2'")
+	fmt.Println("  -check-port    Warn if the listen port is already bound by a non-nginx process")
+	fmt.Println("  -no-banner     Omit the 'Generated by' comment from generated server blocks")
+	fmt.Println("  -position      Insert new blocks at the 'top' or 'bottom' (default) of the http section")
+	fmt.Println("  -reapply       Replace the block previously generated for the same server_name in place")
+	fmt.Println("  -replace       Replace any block with the same server_name in place, as update does, or add it if there is none")
+	fmt.Println("                 Without either flag a block clashing with an existing listen and server_name is rejected;")
+	fmt.Println("                 -reapply only replaces blocks this tool generated (by marker), -replace any block by name.")
+	fmt.Println("                 There is no option to append a duplicate, as nginx would ignore it")
+	fmt.Println("  -template      Render the server block from a Go text/template file instead of the built-in one")
+	fmt.Println("  -json          Print the result as JSON on stdout (the preview goes to stderr)")
+	fmt.Println("  -certbot       Obtain and install a certificate with 'certbot --nginx' after adding the block")
+	fmt.Println("  -check         Only validate and render the configuration (no nginx.conf, no root, nothing written)")
+	fmt.Println("  -indent        Indentation of generated blocks: auto (default, matches nginx.conf), tab or 1-8 spaces")
+	fmt.Println("  -harden        Add the security header preset and ensure 'server_tokens off;' in the http block")
+	fmt.Println("  -quiet         Skip missing path warnings and the post-apply summary (insert location, backup and next steps)")
+	fmt.Println("  -append-raw <directives|@file>")
+	fmt.Println("                 Insert directives verbatim at the end of the server block (repeatable)")
+	fmt.Println("  -print-config <json|yaml>")
+	fmt.Println("                 Print the configuration as loaded, with defaults and flags applied, and exit")
+	fmt.Println("  -simulate <url>")
+	fmt.Println("                 Report the location and proxy_pass/root that would handle the request (no nginx needed)")
+	fmt.Println("  -explain       Add comments explaining each generated directive to the preview (never written)")
+	fmt.Println("  -mkroot        Create a missing root directory and placeholder index before writing")
+	fmt.Println("  -output-dir    Write each server block to <server_name>.conf in a directory included from nginx.conf")
+	fmt.Println("  -generate-full Print a complete standalone nginx.conf with the server blocks and exit")
+	fmt.Println("  -pre-hook      Shell command run before writing; a non-zero exit aborts the apply")
+	fmt.Println("  -post-hook     Shell command run after writing, e.g. 'nginx -t && nginx -s reload'")
+	fmt.Println("  -strict        Fail on unknown configuration keys, listing every offending key")
+	fmt.Println("  -config-format Format of -config: json, yaml, env or auto (detect from contents)")
+	fmt.Println("  -print-template <type>")
+	fmt.Println("                 Print the built-in template for static, proxy, grpc or redirect and exit")
 	fmt.Println("  -help          Show this help message")
 	fmt.Println()
+	fmt.Println("Remove Options:")
+	fmt.Println("  -server-name   server_name of the block(s) to remove")
+	fmt.Println("  -preview       Show the matching blocks and ask for confirmation (default: true)")
+	fmt.Println("  -backup        Create backup before modifying (default: true)")
+	fmt.Println("  -backup-reuse  Reuse the latest backup if it is younger than this duration")
+	fmt.Println("  -comment-out   Comment the blocks out (with a timestamped marker) instead of deleting them")
+	fmt.Println()
+	fmt.Println("Rollback Options:")
+	fmt.Println("  -backup-file   Backup to restore (default: most recent nginx.conf.backup.*)")
+	fmt.Println("  -preview       Ask for confirmation before restoring (default: true)")
+	fmt.Println()
+	fmt.Println("Backups Options:")
+	fmt.Println("  -since         Only list backups younger than this duration (e.g. 24h)")
+	fmt.Println("  -json          Print the backups as a JSON array")
+	fmt.Println()
+	fmt.Println("Diff-Backups Arguments:")
+	fmt.Println("  [<a>] [<b>]    Versions to compare: current (nginx.conf), latest, latest~N (N backups before it),")
+	fmt.Println("                 previous (latest~1), a backup's Unix timestamp or a path. Defaults: latest and current")
+	fmt.Println()
+	fmt.Println("List and Validate Options:")
+	fmt.Println("  -lint          Also warn about deprecated directives in nginx.conf")
+	fmt.Println()
+	fmt.Println("All commands accept -nginx, -auto-detect, -verbose (log each detection step),")
+	fmt.Println("-follow-includes (use the included file that holds the http block) and -no-color")
+	fmt.Println("(plain output; also automatic when output is not a terminal or NO_COLOR is set).")
+	fmt.Println("add, remove and rollback also accept -yes (answer the confirmation prompt with yes)")
+	fmt.Println("and -default-yes (an empty answer means yes).")
+	fmt.Println("Flag defaults are read from ~/.config/nginx-tool/config.yaml or ~/.nginx-tool.yaml")
+	fmt.Println("($NGINX_TOOL_DEFAULTS overrides the path); flags on the command line win.")
+	fmt.Println()
+	fmt.Println("Exit Codes:")
+	fmt.Println("  0  Success")
+	fmt.Println("  1  Unexpected error")
+	fmt.Println("  2  Usage error (missing or conflicting flags)")
+	fmt.Println("  3  Server configuration could not be loaded or parsed")
+	fmt.Println("  4  nginx configuration file not found")
+	fmt.Println("  5  Validation failure")
+	fmt.Println("  6  Failed to generate or write the nginx configuration")
+	fmt.Println("  7  Operation cancelled at the preview prompt")
+	fmt.Println("  8  Not running as root")
+	fmt.Println()
 	fmt.Println("Auto-Detection (Linux):")
 	fmt.Println("  The tool automatically searches for nginx.conf in common locations:")
 	fmt.Println("    • /etc/nginx/nginx.conf")
@@ -0,0 +1,314 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"nginx_tool/internal/config"
+	"nginx_tool/internal/generator"
+	"strconv"
+	"strings"
+)
+
+// runManage is a numbered menu over the server blocks of nginx.conf: pick a
+// block, then edit its basic fields or remove it, until q is entered.
+func runManage(args []string) error {
+	fs := flag.NewFlagSet("manage", flag.ContinueOnError)
+	var (
+		backup      = fs.Bool("backup", true, "Create backup of nginx.conf before each modification")
+		backupReuse = fs.Duration("backup-reuse", 0, "Reuse the latest backup instead of creating one if it is younger than this (e.g. 5m)")
+		noBanner    = fs.Bool("no-banner", false, "Omit the 'Generated by' comment from edited server blocks")
+		indent      = fs.String("indent", "auto", "Indentation of edited blocks: 'auto' (match nginx.conf), 'tab' or a number of spaces")
+	)
+	nginxPath, autoDetect := addNginxFlags(fs)
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+
+	if err := requireRoot(); err != nil {
+		return err
+	}
+	if err := resolveNginxPath(nginxPath, *autoDetect); err != nil {
+		return err
+	}
+	if generator.IsRemote(*nginxPath) {
+		return withExitCode(exitUsage, "remote nginx configurations are read-only")
+	}
+
+	gen := generator.New()
+	gen.Banner = !*noBanner
+	gen.Version = version
+	gen.BackupReuse = *backupReuse
+	gen.OnBackup = reportBackup
+	gen.HTTP2Listen = legacyHTTP2()
+	var err error
+	if gen.Indent, err = indentUnit(*indent, *nginxPath); err != nil {
+		return err
+	}
+
+	changed := false
+	for {
+		servers, err := gen.ListServerBlocks(*nginxPath)
+		if err != nil {
+			return withExitCode(exitApply, "listing server blocks: %w", err)
+		}
+		server, err := pickServer(servers)
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return err
+		}
+
+		fmt.Fprintf(stderr, "[e]dit, [r]emove, [c]omment out or [b]ack: ")
+		action, err := readLine()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return err
+		}
+
+		var done bool
+		switch strings.ToLower(action) {
+		case "e", "edit":
+			done, err = editServer(gen, *nginxPath, server, *backup)
+		case "r", "remove":
+			done, err = removeServer(gen, *nginxPath, server, false, *backup)
+		case "c", "comment", "comment out":
+			done, err = removeServer(gen, *nginxPath, server, true, *backup)
+		}
+		if err != nil {
+			fmt.Fprintf(stderr, "%s%v\n", sym("❌"), err)
+			continue
+		}
+		changed = changed || done
+	}
+
+	if changed {
+		fmt.Fprintln(stderr, sym("👉")+"Next steps:")
+		fmt.Fprintln(stderr, "   nginx -t && nginx -s reload")
+	}
+	return nil
+}
+
+// pickServer lists servers with a number each and returns the one chosen.
+// It returns io.EOF when the user quits. Blocks without a server_name are
+// listed but cannot be picked, since update and remove find blocks by name.
+func pickServer(servers []generator.ServerInfo) (generator.ServerInfo, error) {
+	for {
+		fmt.Fprintln(stderr)
+		fmt.Fprintln(stderr, sym("📋")+"Server blocks")
+		if len(servers) == 0 {
+			fmt.Fprintln(stderr, "   (none)")
+		}
+		for i, server := range servers {
+			names := strings.Join(server.ServerNames, " ")
+			if names == "" {
+				names = "(no server_name)"
+			}
+			fmt.Fprintf(stderr, "  %2d) line %-5d %-8s %-30s %s\n", i+1, server.Line, server.Type, names, serverTarget(server))
+		}
+		fmt.Fprint(stderr, "Select a server block by number, or q to quit: ")
+		answer, err := readLine()
+		if err != nil {
+			return generator.ServerInfo{}, err
+		}
+		if answer == "q" || answer == "quit" {
+			return generator.ServerInfo{}, io.EOF
+		}
+
+		n, err := strconv.Atoi(answer)
+		switch {
+		case err != nil || n < 1 || n > len(servers):
+			fmt.Fprintf(stderr, "%sEnter a number from 1 to %d\n", sym("⚠️"), len(servers))
+		case len(servers[n-1].ServerNames) == 0:
+			fmt.Fprintln(stderr, sym("⚠️")+"This block has no server_name; edit it in nginx.conf directly")
+		default:
+			return servers[n-1], nil
+		}
+	}
+}
+
+func serverTarget(server generator.ServerInfo) string {
+	switch server.Type {
+	case "proxy", "grpc":
+		return server.ProxyPass
+	case "redirect":
+		return server.Return
+	}
+	return server.Root
+}
+
+// editServer asks for the basic fields of server, showing the current value
+// as the default, and regenerates the block with them through the update
+// path. It reports whether nginx.conf was written.
+func editServer(gen *generator.Generator, nginxPath string, server generator.ServerInfo, backup bool) (bool, error) {
+	cfg, serverType, err := promptServerConfig(server)
+	if err != nil {
+		return false, err
+	}
+	if err := cfg.ValidateFor(serverType); err != nil {
+		return false, fmt.Errorf("invalid configuration: %w", err)
+	}
+
+	gen.Match = server.ServerNames
+	defer func() { gen.Match = nil }()
+	current, updated, err := gen.PreviewUpdate(cfg, nginxPath, serverType)
+	if err != nil {
+		return false, fmt.Errorf("preparing update: %w", err)
+	}
+
+	fmt.Fprintln(stdout, sym("📄")+"Current server block")
+	fmt.Fprintln(stdout, "="+strings.Repeat("=", 50))
+	fmt.Fprintln(stdout, current)
+	fmt.Fprintln(stdout, "="+strings.Repeat("=", 50))
+	fmt.Fprintln(stdout, sym("✏️")+"Updated server block")
+	fmt.Fprintln(stdout, "="+strings.Repeat("=", 50))
+	fmt.Fprintln(stdout, updated)
+	fmt.Fprintln(stdout, "="+strings.Repeat("=", 50))
+	fmt.Fprintln(stderr, sym("⚠️")+"The block is regenerated from these fields; anything else in it, such as ssl_certificate or extra locations, is dropped")
+
+	shouldProceed, err := confirm("Do you want to replace this server block?")
+	if err != nil || !shouldProceed {
+		return false, err
+	}
+	if _, err := gen.UpdateServerBlock(cfg, nginxPath, serverType, backup); err != nil {
+		return false, fmt.Errorf("updating server in nginx config: %w", err)
+	}
+	fmt.Fprintf(stderr, "%sUpdated server block for %s in: %s\n", sym("✅"), strings.Join(cfg.Names(), " "), nginxPath)
+	return true, nil
+}
+
+// promptServerConfig builds a config from the fields of server, asking for
+// each one with the value found in the block as the default.
+func promptServerConfig(server generator.ServerInfo) (*config.ServerConfig, string, error) {
+	cfg := &config.ServerConfig{}
+	serverType, err := promptDefault("Server type (static, proxy, grpc, redirect)", server.Type)
+	if err != nil {
+		return nil, "", err
+	}
+	switch serverType {
+	case "static", "proxy", "grpc", "redirect":
+	default:
+		return nil, "", fmt.Errorf("type must be one of 'static', 'proxy', 'grpc' or 'redirect'")
+	}
+
+	if cfg.ServerName, err = promptDefault("Server name(s), space-separated", strings.Join(server.ServerNames, " ")); err != nil {
+		return nil, "", err
+	}
+	listens, err := promptDefault("Listen value(s), comma-separated", strings.Join(server.Listens, ", "))
+	if err != nil {
+		return nil, "", err
+	}
+	for _, listen := range strings.Split(listens, ",") {
+		if listen = strings.TrimSpace(listen); listen != "" {
+			cfg.Listens = append(cfg.Listens, config.ListenSpec{Address: listen})
+		}
+	}
+	if len(cfg.Listens) == 1 {
+		cfg.Listen, cfg.Listens = cfg.Listens[0].Address, nil
+	}
+
+	switch serverType {
+	case "static":
+		if cfg.Root, err = promptDefault("Document root", server.Root); err != nil {
+			return nil, "", err
+		}
+		if cfg.Index, err = promptDefault("Index file", "index.html"); err != nil {
+			return nil, "", err
+		}
+	case "proxy":
+		if cfg.ProxyPass, err = promptDefault("Proxy target URL", server.ProxyPass); err != nil {
+			return nil, "", err
+		}
+	case "grpc":
+		target := server.ProxyPass
+		if server.Type != "grpc" {
+			target = ""
+		}
+		if cfg.GRPCPass, err = promptDefault("gRPC backend URL", target); err != nil {
+			return nil, "", err
+		}
+	case "redirect":
+		code, target := "301", ""
+		if fields := strings.Fields(server.Return); len(fields) == 2 {
+			code, target = fields[0], strings.TrimSuffix(fields[1], "$request_uri")
+		}
+		if cfg.RedirectTo, err = promptDefault("Redirect target", target); err != nil {
+			return nil, "", err
+		}
+		if code, err = promptDefault("Redirect status code (301 or 302)", code); err != nil {
+			return nil, "", err
+		}
+		if cfg.RedirectCode, err = strconv.Atoi(code); err != nil {
+			return nil, "", fmt.Errorf("invalid redirect status code: %s", code)
+		}
+	}
+	return cfg, serverType, nil
+}
+
+// removeServer removes or comments out the blocks named like server after
+// showing them. It reports whether nginx.conf was written.
+func removeServer(gen *generator.Generator, nginxPath string, server generator.ServerInfo, commentOut bool, backup bool) (bool, error) {
+	name := server.ServerNames[0]
+	blocks, err := gen.FindServerBlocks(nginxPath, name)
+	if err != nil {
+		return false, fmt.Errorf("finding server blocks: %w", err)
+	}
+
+	action := "remove"
+	if commentOut {
+		action = "comment out"
+	}
+	fmt.Fprintf(stdout, "%sServer blocks to %s\n", sym("🗑️"), action)
+	fmt.Fprintln(stdout, "="+strings.Repeat("=", 50))
+	fmt.Fprintln(stdout, strings.Join(blocks, "\n\n"))
+	fmt.Fprintln(stdout, "="+strings.Repeat("=", 50))
+
+	shouldProceed, err := confirm(fmt.Sprintf("Do you want to %s these server blocks?", action))
+	if err != nil || !shouldProceed {
+		return false, err
+	}
+
+	gen.CommentOut = commentOut
+	result, err := gen.RemoveServerFromNginx(nginxPath, name, backup)
+	if err != nil {
+		return false, fmt.Errorf("removing server from nginx config: %w", err)
+	}
+	if commentOut {
+		fmt.Fprintf(stderr, "%sCommented out %d server block(s) for %s in: %s\n", sym("✅"), len(result.ServerBlocks), name, nginxPath)
+	} else {
+		fmt.Fprintf(stderr, "%sRemoved %d server block(s) for %s from: %s\n", sym("✅"), len(result.ServerBlocks), name, nginxPath)
+	}
+	return true, nil
+}
+
+// promptDefault asks for a value and returns fallback when the answer is
+// empty.
+func promptDefault(prompt, fallback string) (string, error) {
+	if fallback != "" {
+		fmt.Fprintf(stderr, "%s [%s]: ", prompt, fallback)
+	} else {
+		fmt.Fprintf(stderr, "%s: ", prompt)
+	}
+	answer, err := readLine()
+	if err != nil {
+		return "", err
+	}
+	if answer == "" {
+		return fallback, nil
+	}
+	return answer, nil
+}
+
+// readLine reads one trimmed line from stdin. A last line without a newline
+// is still returned; io.EOF is only reported once nothing is left.
+func readLine() (string, error) {
+	line, err := stdin.ReadString('\n')
+	if err != nil && !(errors.Is(err, io.EOF) && line != "") {
+		return "", err
+	}
+	return strings.TrimSpace(line), nil
+}
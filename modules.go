@@ -0,0 +1,136 @@
+package main
+
+import (
+	"fmt"
+	"nginx_tool/internal/config"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// warnMissingBrotli warns when a configuration turns brotli on but nginx
+// neither has the module built in, according to nginx -V, nor loads it with
+// a load_module directive in nginx.conf or the files it includes at the top
+// level, such as Debian's modules-enabled/*.conf. Without nginx nothing is
+// reported.
+func warnMissingBrotli(cfgs []*config.ServerConfig, nginxPath string) {
+	var names []string
+	for _, cfg := range cfgs {
+		if cfg.Brotli {
+			names = append(names, strings.Join(cfg.Names(), " "))
+		}
+	}
+	if len(names) == 0 {
+		return
+	}
+
+	nginxBinary, err := findNginxBinary()
+	if err != nil {
+		debugf("brotli check skipped: %v", err)
+		return
+	}
+	output, err := runTimed((*exec.Cmd).CombinedOutput, nginxBinary, "-V")
+	if err != nil {
+		debugf("brotli check skipped: %v", err)
+		return
+	}
+	if strings.Contains(string(output), "brotli") || loadsModule(nginxPath, "brotli") {
+		return
+	}
+	fmt.Fprintf(stderr, "%s%s: brotli is on, but this nginx has no brotli module; nginx -t will fail with unknown directive \"brotli\"\n", sym("⚠️"), strings.Join(names, ", "))
+}
+
+// loadsModule reports whether a load_module directive in nginxPath, or in a
+// file it includes outside the http block, names a module containing name.
+func loadsModule(nginxPath, name string) bool {
+	files := []string{nginxPath}
+	for i := 0; i < len(files); i++ {
+		content, err := os.ReadFile(files[i])
+		if err != nil {
+			continue
+		}
+		root, err := config.ParseNginx(string(content))
+		if err != nil {
+			continue
+		}
+		for _, directive := range root.Find("load_module") {
+			if len(directive.Args) > 0 && strings.Contains(directive.Args[0], name) {
+				return true
+			}
+		}
+		if i > 0 {
+			continue
+		}
+		for _, include := range root.Find("include") {
+			if len(include.Args) == 0 {
+				continue
+			}
+			pattern := include.Args[0]
+			if !filepath.IsAbs(pattern) {
+				pattern = filepath.Join(filepath.Dir(nginxPath), pattern)
+			}
+			matches, _ := filepath.Glob(pattern)
+			files = append(files, matches...)
+		}
+	}
+	return false
+}
+
+// usesHTTP2 reports whether any of cfgs turns HTTP/2 on, which a gRPC
+// server always does.
+func usesHTTP2(cfgs []*config.ServerConfig, serverType string) bool {
+	if serverType == "grpc" {
+		return true
+	}
+	for _, cfg := range cfgs {
+		for _, listen := range cfg.ListenValues() {
+			if fields := strings.Fields(listen); len(fields) > 1 && slices.Contains(fields[1:], "http2") {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// legacyHTTP2 reports whether the installed nginx predates 1.25.1 and so
+// needs http2 as a listen parameter rather than "http2 on;". Without nginx,
+// or when nginx -v cannot be read, the current form is used.
+func legacyHTTP2() bool {
+	nginxBinary, err := findNginxBinary()
+	if err != nil {
+		debugf("nginx version check skipped: %v", err)
+		return false
+	}
+	output, err := runTimed((*exec.Cmd).CombinedOutput, nginxBinary, "-v")
+	if err != nil {
+		debugf("nginx version check skipped: %v", err)
+		return false
+	}
+	_, version, ok := strings.Cut(strings.TrimSpace(string(output)), "/")
+	if !ok {
+		debugf("nginx version check skipped: unexpected output %q", output)
+		return false
+	}
+	version, _, _ = strings.Cut(version, " ")
+	debugf("  nginx version: %s", version)
+	return versionBefore(version, []int{1, 25, 1})
+}
+
+// versionBefore reports whether the dotted version is older than want.
+// Parts that are not numbers count as 0.
+func versionBefore(version string, want []int) bool {
+	parts := strings.Split(version, ".")
+	for i, w := range want {
+		n := 0
+		if i < len(parts) {
+			n, _ = strconv.Atoi(parts[i])
+		}
+		if n != w {
+			return n < w
+		}
+	}
+	return false
+}
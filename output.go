@@ -0,0 +1,42 @@
+package main
+
+import (
+	"io"
+	"os"
+	"strings"
+)
+
+var noColor bool
+
+var (
+	stdout io.Writer = os.Stdout
+	stderr io.Writer = os.Stderr
+)
+
+// sym returns emoji followed by the space that separates it from the
+// message, or "" when plainOutput reports that the emoji cannot be expected
+// to render on stdout or stderr. Only the tool's own decorations go through
+// sym; previews, configs and other data are written unchanged.
+func sym(emoji string) string {
+	if plainOutput(os.Stdout) || plainOutput(os.Stderr) {
+		return ""
+	}
+	// Emoji ending in a variation selector, such as ⚠️, are drawn one
+	// column wide by most terminals and get a second space.
+	if strings.HasSuffix(emoji, "\uFE0F") {
+		return emoji + "  "
+	}
+	return emoji + " "
+}
+
+func plainOutput(f *os.File) bool {
+	if noColor || os.Getenv("NO_COLOR") != "" || os.Getenv("TERM") == "dumb" {
+		return true
+	}
+	return !isTerminal(f)
+}
+
+func isTerminal(f *os.File) bool {
+	info, err := f.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
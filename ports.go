@@ -0,0 +1,95 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"os/exec"
+	"strings"
+	"syscall"
+)
+
+func listenAddress(listen string) string {
+	fields := strings.Fields(listen)
+	if len(fields) == 0 {
+		return ":80"
+	}
+
+	addr := fields[0]
+	switch {
+	case strings.HasPrefix(addr, "unix:"):
+		return ""
+	case strings.HasPrefix(addr, "["):
+		if !strings.Contains(addr, "]:") {
+			return addr + ":80"
+		}
+		return addr
+	case strings.Contains(addr, ":"):
+		return strings.Replace(addr, "*:", ":", 1)
+	case isPort(addr):
+		return ":" + addr
+	default:
+		return addr + ":80"
+	}
+}
+
+func isPort(s string) bool {
+	if s == "" {
+		return false
+	}
+	for _, r := range s {
+		if r < '0' || r > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+func checkPortAvailable(listen string) {
+	addr := listenAddress(listen)
+	if addr == "" {
+		debugf("skipping port check for %q", listen)
+		return
+	}
+
+	ln, err := net.Listen("tcp", addr)
+	if err == nil {
+		ln.Close()
+		debugf("port check: %s is free", addr)
+		return
+	}
+
+	if !errors.Is(err, syscall.EADDRINUSE) {
+		fmt.Fprintf(stderr, "%sCould not probe %s: %v\n", sym("⚠️"), addr, err)
+		return
+	}
+
+	owner := portOwner(addr)
+	switch {
+	case strings.Contains(owner, "nginx"):
+		debugf("port check: %s is held by nginx: %s", addr, owner)
+	case owner != "":
+		fmt.Fprintf(stderr, "%s%s is already in use by %s; nginx may fail to bind on reload\n", sym("⚠️"), addr, owner)
+	default:
+		fmt.Fprintf(stderr, "%s%s is already in use; if it is not nginx, nginx may fail to bind on reload\n", sym("⚠️"), addr)
+	}
+}
+
+func portOwner(addr string) string {
+	_, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		return ""
+	}
+
+	output, err := runTimed((*exec.Cmd).Output, "ss", "-Hltnp", "sport = :"+port)
+	if err != nil {
+		return ""
+	}
+
+	for _, line := range strings.Split(string(output), "\n") {
+		if idx := strings.Index(line, "users:"); idx >= 0 {
+			return strings.TrimSpace(line[idx:])
+		}
+	}
+	return ""
+}
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"fmt"
+	"net/url"
+	"nginx_tool/internal/config"
+	"nginx_tool/internal/generator"
+	"strings"
+)
+
+// simulateRequest renders the server block that would answer rawURL and
+// reports which location handles it and where the request goes.
+func simulateRequest(gen *generator.Generator, cfgs []*config.ServerConfig, serverType, rawURL string) error {
+	if !strings.Contains(rawURL, "://") {
+		rawURL = "http://" + rawURL
+	}
+	u, err := url.Parse(rawURL)
+	if err != nil || u.Host == "" {
+		return withExitCode(exitUsage, "-simulate needs a request URL such as http://example.com/path")
+	}
+	host := u.Hostname()
+
+	cfg := cfgs[0]
+	matched := false
+	for _, candidate := range cfgs {
+		for _, name := range candidate.Names() {
+			if serverNameMatches(name, host) {
+				cfg, matched = candidate, true
+				break
+			}
+		}
+		if matched {
+			break
+		}
+	}
+
+	serverBlock, err := gen.GenerateServerBlock(cfg, serverType)
+	if err != nil {
+		return withExitCode(exitValidation, "generating server block: %w", err)
+	}
+	uri := u.Path
+	if uri == "" {
+		uri = "/"
+	}
+	sim, err := generator.SimulateRequest(serverBlock, uri)
+	if err != nil {
+		return withExitCode(exitValidation, "simulating request: %w", err)
+	}
+
+	fmt.Fprintf(stdout, "%sSimulating GET %s\n", sym("🧭"), u.String())
+	if matched {
+		fmt.Fprintf(stdout, "Server:   %s\n", strings.Join(cfg.Names(), " "))
+	} else {
+		fmt.Fprintf(stdout, "Server:   %s (no server_name matches %s; this is what the default server would do)\n", strings.Join(cfg.Names(), " "), host)
+	}
+	for _, rewrite := range sim.Rewrites {
+		fmt.Fprintf(stdout, "Rewrite:  %s\n", rewrite)
+	}
+	if sim.Location != "" {
+		fmt.Fprintf(stdout, "Location: %s\n", sim.Location)
+	} else {
+		fmt.Fprintln(stdout, "Location: none (server level)")
+	}
+
+	target := sim.Target
+	if u.RawQuery != "" && (sim.Kind == "proxy" || sim.Kind == "grpc") {
+		target += "?" + u.RawQuery
+	}
+	switch sim.Kind {
+	case "proxy":
+		fmt.Fprintf(stdout, "Proxy:    %s\n", target)
+	case "grpc":
+		fmt.Fprintf(stdout, "gRPC:     %s\n", target)
+	case "file":
+		fmt.Fprintf(stdout, "File:     %s\n", target)
+	case "return", "redirect":
+		fmt.Fprintf(stdout, "Return:   %s\n", target)
+	case "internal":
+		fmt.Fprintf(stdout, "Result:   %s\n", target)
+	}
+	return nil
+}
+
+// serverNameMatches reports whether host is served by name, following
+// nginx's exact, leading "*." and trailing ".*" wildcard forms. Regex names
+// are not evaluated.
+func serverNameMatches(name, host string) bool {
+	name, host = strings.ToLower(name), strings.ToLower(host)
+	switch {
+	case strings.HasPrefix(name, "*."):
+		return strings.HasSuffix(host, name[1:])
+	case strings.HasPrefix(name, "."):
+		return host == name[1:] || strings.HasSuffix(host, name)
+	case strings.HasSuffix(name, ".*"):
+		return strings.HasPrefix(host, name[:len(name)-1])
+	}
+	return name == host
+}